@@ -1,7 +1,7 @@
 package bitxid
 
 import (
-	"crypto/sha256"
+	"context"
 	"fmt"
 	"strings"
 
@@ -13,8 +13,8 @@ var _ Doc = (*AccountDoc)(nil)
 
 // AccountDoc represents account identity information
 type AccountDoc struct {
-	BasicDoc
-	Service string `json:"service"`
+	BasicDoc `pb:"1"`
+	Service  string `json:"service" pb:"2"`
 }
 
 // Marshal marshals account doc
@@ -51,7 +51,7 @@ var _ TableItem = (*AccountItem)(nil)
 // AccountItem reperesentis a did item, element of registry table.
 // Registry table is used together with docdb.
 type AccountItem struct {
-	BasicItem
+	BasicItem `pb:"1"`
 }
 
 // Marshal marshals account item
@@ -70,18 +70,29 @@ func (di *AccountItem) GetID() DID {
 }
 
 var _ AccountDIDManager = (*AccountDIDRegistry)(nil)
+var _ AccountDIDManagerContext = (*AccountDIDRegistry)(nil)
 
 // AccountDIDRegistry for DID Identifier,
 // Every appchain should use this DID Registry module.
 type AccountDIDRegistry struct {
-	Mode                     RegistryMode  `json:"mode"`
-	SelfChainDID             DID           `json:"method"` // method of the registry
-	Admins                   []DID         `json:"admins"` // admins of the registry
-	Table                    RegistryTable `json:"table"`
-	Docdb                    DocDB         `json:"docdb"`
-	GenesisAccountDID        DID           `json:"genesis_account_did"`
-	GenesisAccountDocInfo    DocInfo       `json:"genesis_account_doc_info"`
-	GenesisAccountDocContent Doc           `json:"genesis_account_doc_content"`
+	Mode                     RegistryMode     `json:"mode"`
+	SelfChainDID             DID              `json:"method"` // method of the registry
+	AdminSet                                  // admins and the policy of changing them
+	Table                    RegistryTable    `json:"table"`
+	Docdb                    DocDB            `json:"docdb"`
+	GenesisAccountDID        DID              `json:"genesis_account_did"`
+	GenesisAccountDocInfo    DocInfo          `json:"genesis_account_doc_info"`
+	GenesisAccountDocContent Doc              `json:"genesis_account_doc_content"`
+	Codec                    Codec            `json:"codec"`
+	RequireKeyProof          bool             `json:"require_key_proof"`
+	Migrator                 *Migrator        `json:"-"`
+	Fetcher                  DocFetcher       `json:"-"` // fetches docs under ExternalDocDB mode
+	Events                   EventSink        `json:"-"` // receives state change events if set
+	AuditLog                 *AuditLog        `json:"-"` // records admin actions if set
+	Governance               *Governance      `json:"-"` // makes admin actions go through proposals if set
+	ChainResolver            ChainDIDResolver `json:"-"` // checks the chain did of the registry if set
+	RBAC                     *RBAC            `json:"-"` // checks permissions of callers if set
+	docCache                 *docCache
 	logger                   logrus.FieldLogger
 	// config *DIDConfig
 }
@@ -95,10 +106,12 @@ func NewAccountDIDRegistry(
 	db, _ := NewKVDocDB(nil)
 	// doc := genesisAccountDoc()
 	ar := &AccountDIDRegistry{
-		Mode:   ExternalDocDB,
-		Table:  rt,
-		Docdb:  db,
-		logger: l,
+		Mode:     ExternalDocDB,
+		Table:    rt,
+		Docdb:    db,
+		Codec:    DefaultCodec(),
+		docCache: newDocCache(),
+		logger:   l,
 		// Admins:            []DID{doc.GetID()},
 		// GenesisAccountDID: doc.GetID(),
 		// GenesisAccountDoc: DocInfo{
@@ -112,6 +125,10 @@ func NewAccountDIDRegistry(
 	for _, option := range options {
 		option(ar)
 	}
+	setCodec(ar.Table, ar.Codec)
+	setCodec(ar.Docdb, ar.Codec)
+	setMigrator(ar.Table, ar.Migrator)
+	setMigrator(ar.Docdb, ar.Migrator)
 
 	return ar, nil
 }
@@ -125,6 +142,97 @@ func WithAccountDocStorage(ds storage.Storage) func(*AccountDIDRegistry) {
 	}
 }
 
+// WithAccountDocDB used for InternalDocDB mode with a custom docdb
+func WithAccountDocDB(db DocDB) func(*AccountDIDRegistry) {
+	return func(ar *AccountDIDRegistry) {
+		ar.Docdb = db
+		ar.Mode = InternalDocDB
+	}
+}
+
+// WithAccountGovernance used for making admin actions go through proposals of g
+func WithAccountGovernance(g *Governance) func(*AccountDIDRegistry) {
+	return func(r *AccountDIDRegistry) {
+		r.Governance = g
+		g.registry = r
+	}
+}
+
+// WithAccountRBAC used for checking permissions of callers by roles in rb,
+// admins of the registry have all permissions within it only
+func WithAccountRBAC(rb *RBAC) func(*AccountDIDRegistry) {
+	return func(ar *AccountDIDRegistry) {
+		ar.RBAC = rb.bind(ar.GetAdmins)
+	}
+}
+
+// WithAccountAuditLog used for recording admin actions to l
+func WithAccountAuditLog(l *AuditLog) func(*AccountDIDRegistry) {
+	return func(r *AccountDIDRegistry) {
+		r.AuditLog = l
+	}
+}
+
+// WithAccountEventSink used for emitting state change events to sink
+func WithAccountEventSink(sink EventSink) func(*AccountDIDRegistry) {
+	return func(r *AccountDIDRegistry) {
+		r.Events = sink
+	}
+}
+
+// WithAccountDocFetcher used for fetching docs by ResolveFull under ExternalDocDB mode
+func WithAccountDocFetcher(f DocFetcher) func(*AccountDIDRegistry) {
+	return func(ar *AccountDIDRegistry) {
+		ar.Fetcher = f
+	}
+}
+
+// WithAccountMigrator used for lazy migration of table items and docs on read
+func WithAccountMigrator(m *Migrator) func(*AccountDIDRegistry) {
+	return func(ar *AccountDIDRegistry) {
+		ar.Migrator = m
+	}
+}
+
+// WithAccountCodec used for codec setup of table items and docs
+func WithAccountCodec(c Codec) func(*AccountDIDRegistry) {
+	return func(ar *AccountDIDRegistry) {
+		ar.Codec = c
+	}
+}
+
+// WithAccountAdminPolicy used for constraining changes of admins by p
+func WithAccountAdminPolicy(p AdminPolicy) func(*AccountDIDRegistry) {
+	return func(ar *AccountDIDRegistry) {
+		ar.AdminPolicy = p
+	}
+}
+
+// WithAccountSnapshot used for restoring the admin set kept in the manifest
+// of an imported snapshot
+func WithAccountSnapshot(m *SnapshotManifest) func(*AccountDIDRegistry) {
+	return func(ar *AccountDIDRegistry) {
+		ar.AdminSet = m.adminSet()
+	}
+}
+
+// WithChainDIDResolver used for binding the registry to its chain did in res:
+// account dids are registered and updated only under the chain did of the
+// registry which should be Normal, and they resolve Frozen while it is frozen.
+func WithChainDIDResolver(res ChainDIDResolver) func(*AccountDIDRegistry) {
+	return func(ar *AccountDIDRegistry) {
+		ar.ChainResolver = res
+	}
+}
+
+// WithAccountKeyProof used for requiring registrations to prove the control
+// of the keys dids are derived from, proofs are carried by ContextWithKeyProof
+func WithAccountKeyProof() func(*AccountDIDRegistry) {
+	return func(ar *AccountDIDRegistry) {
+		ar.RequireKeyProof = true
+	}
+}
+
 // WithDIDAdmin used for admin setup
 func WithDIDAdmin(a DID) func(*AccountDIDRegistry) {
 	return func(ar *AccountDIDRegistry) {
@@ -150,29 +258,35 @@ func WithGenesisAccountDocContent(doc Doc) func(*AccountDIDRegistry) {
 
 // SetupGenesis set up genesis to boot the whole did registry
 func (r *AccountDIDRegistry) SetupGenesis() error {
+	return r.SetupGenesisContext(context.Background())
+}
+
+// SetupGenesisContext is SetupGenesis with context
+func (r *AccountDIDRegistry) SetupGenesisContext(ctx context.Context) error {
+	// genesis is made by the registry itself instead of proposals
+	ctx = withGovernance(ctx)
 	if r.GenesisAccountDID == "" {
-		return fmt.Errorf("genesis AccountDID is null")
+		return &InvalidFormatError{What: "genesis", Reason: "genesis AccountDID is null"}
 	}
 	if len(r.Admins) == 0 {
-		return fmt.Errorf("no admins")
+		return &InvalidFormatError{What: "genesis", Reason: "no admins"}
 	}
 	// if r.GenesisAccountDID != r.GenesisAccountDoc.Content.GetID() {
 	// 	return fmt.Errorf("genesis: admin DID not matched with doc")
 	// }
+	r.SelfChainDID = DID(r.GenesisAccountDID.GetChainDID())
 	// register genesis did
 	var err error
 	if r.Mode == ExternalDocDB {
-		_, _, err = r.Register(r.GenesisAccountDID, r.GenesisAccountDocInfo.Addr, r.GenesisAccountDocInfo.Hash)
+		_, _, err = r.RegisterContext(ctx, r.GenesisAccountDID, r.GenesisAccountDocInfo.Addr, r.GenesisAccountDocInfo.Hash)
 	} else {
-		_, _, err = r.RegisterWithDoc(r.GenesisAccountDocContent)
+		_, _, err = r.RegisterWithDocContext(ctx, r.GenesisAccountDocContent)
 	}
 
 	if err != nil {
 		return fmt.Errorf("genesis: %w", err)
 	}
 
-	r.SelfChainDID = DID(r.GenesisAccountDID.GetChainDID())
-
 	return nil
 }
 
@@ -188,22 +302,72 @@ func (r *AccountDIDRegistry) GetAdmins() []DID {
 
 // AddAdmin adds an admin for the registry
 func (r *AccountDIDRegistry) AddAdmin(caller DID) error {
-	if r.HasAdmin(caller) {
-		return fmt.Errorf("caller %s is already an admin", caller)
+	return r.AddAdminContext(context.Background(), caller)
+}
+
+// AddAdminContext is AddAdmin with context
+func (r *AccountDIDRegistry) AddAdminContext(ctx context.Context, caller DID) error {
+	if err := checkGoverned(ctx, r.Governance, ActionAddAdmin); err != nil {
+		return err
 	}
-	r.Admins = append(r.Admins, caller)
-	return nil
+	if err := checkPermission(ctx, r.RBAC, PermAdmin); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return r.change(ctx, r.AuditLog, ActionAddAdmin, caller)
 }
 
 // RemoveAdmin removes an admin for the registry
 func (r *AccountDIDRegistry) RemoveAdmin(caller DID) error {
-	for i, admin := range r.Admins {
-		if admin == caller {
-			r.Admins = append(r.Admins[:i], r.Admins[i+1:]...)
-			return nil
-		}
+	return r.RemoveAdminContext(context.Background(), caller)
+}
+
+// RemoveAdminContext is RemoveAdmin with context
+func (r *AccountDIDRegistry) RemoveAdminContext(ctx context.Context, caller DID) error {
+	if err := checkGoverned(ctx, r.Governance, ActionRemoveAdmin); err != nil {
+		return err
+	}
+	if err := checkPermission(ctx, r.RBAC, PermAdmin); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return r.change(ctx, r.AuditLog, ActionRemoveAdmin, caller)
+}
+
+// ApplyAdminChanges applies admin changes whose timelock has passed
+func (r *AccountDIDRegistry) ApplyAdminChanges() ([]*AdminChange, error) {
+	return r.ApplyAdminChangesContext(context.Background())
+}
+
+// ApplyAdminChangesContext is ApplyAdminChanges with context
+func (r *AccountDIDRegistry) ApplyAdminChangesContext(ctx context.Context) ([]*AdminChange, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return r.applyDue(ctx, r.AuditLog)
+}
+
+// CancelAdminChange cancels the pending change of admin a during its timelock
+func (r *AccountDIDRegistry) CancelAdminChange(a DID) error {
+	return r.CancelAdminChangeContext(context.Background(), a)
+}
+
+// CancelAdminChangeContext is CancelAdminChange with context
+func (r *AccountDIDRegistry) CancelAdminChangeContext(ctx context.Context, a DID) error {
+	if err := checkGoverned(ctx, r.Governance, ActionCancelAdminChange); err != nil {
+		return err
+	}
+	if err := checkPermission(ctx, r.RBAC, PermAdmin); err != nil {
+		return err
 	}
-	return fmt.Errorf("caller %s is not an admin", caller)
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return r.cancel(ctx, r.AuditLog, a)
 }
 
 // HasAdmin checks whether caller is an admin of the registry
@@ -216,6 +380,44 @@ func (r *AccountDIDRegistry) HasAdmin(caller DID) bool {
 	return false
 }
 
+// GrantRole grants role to did, RBAC should be set
+func (r *AccountDIDRegistry) GrantRole(did DID, role Role) error {
+	return r.GrantRoleContext(context.Background(), did, role)
+}
+
+// GrantRoleContext is GrantRole with context
+func (r *AccountDIDRegistry) GrantRoleContext(ctx context.Context, did DID, role Role) error {
+	if err := checkGoverned(ctx, r.Governance, ActionGrantRole); err != nil {
+		return err
+	}
+	if err := checkPermission(ctx, r.RBAC, PermAdmin); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return grantRole(ctx, r.RBAC, r.AuditLog, ActionGrantRole, did, role)
+}
+
+// RevokeRole revokes role of did, RBAC should be set
+func (r *AccountDIDRegistry) RevokeRole(did DID, role Role) error {
+	return r.RevokeRoleContext(context.Background(), did, role)
+}
+
+// RevokeRoleContext is RevokeRole with context
+func (r *AccountDIDRegistry) RevokeRoleContext(ctx context.Context, did DID, role Role) error {
+	if err := checkGoverned(ctx, r.Governance, ActionRevokeRole); err != nil {
+		return err
+	}
+	if err := checkPermission(ctx, r.RBAC, PermAdmin); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return grantRole(ctx, r.RBAC, r.AuditLog, ActionRevokeRole, did, role)
+}
+
 // GetChainDID get chain did of the registry
 func (r *AccountDIDRegistry) GetChainDID() DID {
 	return r.SelfChainDID
@@ -224,36 +426,79 @@ func (r *AccountDIDRegistry) GetChainDID() DID {
 // Register ties did name to a did doc
 // ATN: only did who owns did-name should call this
 func (r *AccountDIDRegistry) Register(accountDID DID, addr string, hash []byte) (string, []byte, error) {
-	return r.updateByStatus(accountDID, addr, hash, nil, Initial)
+	return r.RegisterContext(context.Background(), accountDID, addr, hash)
+}
+
+// RegisterContext is Register with context
+func (r *AccountDIDRegistry) RegisterContext(ctx context.Context, accountDID DID, addr string, hash []byte) (string, []byte, error) {
+	return r.updateByStatus(ctx, accountDID, addr, hash, nil, Initial)
 }
 
 // RegisterWithDoc registers with doc
 func (r *AccountDIDRegistry) RegisterWithDoc(doc Doc) (string, []byte, error) {
+	return r.RegisterWithDocContext(context.Background(), doc)
+}
+
+// RegisterWithDocContext is RegisterWithDoc with context
+func (r *AccountDIDRegistry) RegisterWithDocContext(ctx context.Context, doc Doc) (string, []byte, error) {
 	if !doc.IsValidFormat() {
-		return "", nil, fmt.Errorf("invalid doc format")
+		return "", nil, &InvalidFormatError{What: "doc", Reason: string(doc.GetID())}
 	}
-	return r.updateByStatus("", "", []byte{}, doc, Initial)
+	return r.updateByStatus(ctx, "", "", []byte{}, doc, Initial)
 }
 
 // Update updates data of an account did
 // ATN: only caller who owns did should call this
 func (r *AccountDIDRegistry) Update(accountDID DID, addr string, hash []byte) (string, []byte, error) {
-	return r.updateByStatus(accountDID, addr, hash, nil, Normal)
+	return r.UpdateContext(context.Background(), accountDID, addr, hash)
+}
+
+// UpdateContext is Update with context
+func (r *AccountDIDRegistry) UpdateContext(ctx context.Context, accountDID DID, addr string, hash []byte) (string, []byte, error) {
+	return r.updateByStatus(ctx, accountDID, addr, hash, nil, Normal)
 }
 
 // UpdateWithDoc updates with doc
 func (r *AccountDIDRegistry) UpdateWithDoc(doc Doc) (string, []byte, error) {
-	return r.updateByStatus("", "", []byte{}, doc, Normal)
+	return r.UpdateWithDocContext(context.Background(), doc)
 }
 
-func (r *AccountDIDRegistry) updateByStatus(did DID, docAddr string, docHash []byte, doc Doc, expectedStatus StatusType) (string, []byte, error) {
-	docAddr, docHash, did, err := r.updateDocdbOrNot(did, docAddr, docHash, doc, expectedStatus)
+// UpdateWithDocContext is UpdateWithDoc with context
+func (r *AccountDIDRegistry) UpdateWithDocContext(ctx context.Context, doc Doc) (string, []byte, error) {
+	return r.updateByStatus(ctx, "", "", []byte{}, doc, Normal)
+}
+
+func (r *AccountDIDRegistry) updateByStatus(ctx context.Context, did DID, docAddr string, docHash []byte, doc Doc, expectedStatus StatusType) (string, []byte, error) {
+	if doc != nil {
+		if err := checkSelfOrPermission(ctx, r.RBAC, doc.GetID(), PermRegister); err != nil {
+			return "", nil, err
+		}
+	} else if err := checkSelfOrPermission(ctx, r.RBAC, did, PermRegister); err != nil {
+		return "", nil, err
+	}
+	if doc != nil {
+		if err := r.checkChainDID(ctx, doc.GetID()); err != nil {
+			return "", nil, err
+		}
+	} else if err := r.checkChainDID(ctx, did); err != nil {
+		return "", nil, err
+	}
+	if expectedStatus == Initial && r.RequireKeyProof {
+		t, err := r.keyProofTarget(did, docAddr, docHash, doc)
+		if err != nil {
+			return "", nil, err
+		}
+		if err := checkKeyProof(ctx, t); err != nil {
+			return "", nil, err
+		}
+	}
+	docAddr, docHash, did, err := r.updateDocdbOrNot(ctx, did, docAddr, docHash, doc, expectedStatus)
 	if err != nil {
 		return "", nil, err
 	}
 
 	if expectedStatus == Initial { // register
-		err := r.Table.CreateItem(
+		err := r.table().CreateItemContext(ctx,
 			&AccountItem{BasicItem{
 				ID:      did,
 				Status:  Normal,
@@ -265,23 +510,47 @@ func (r *AccountDIDRegistry) updateByStatus(did DID, docAddr string, docHash []b
 			return docAddr, docHash, fmt.Errorf("register DID on table: %w", err)
 		}
 	} else { // update
-		item, err := r.Table.GetItem(did, AccountDIDType)
+		item, err := r.table().GetItemContext(ctx, did, AccountDIDType)
 		if err != nil {
 			return docAddr, docHash, fmt.Errorf("DID table get: %w", err)
 		}
 		itemD := item.(*AccountItem)
 		itemD.DocAddr = docAddr
 		itemD.DocHash = docHash
-		err = r.Table.UpdateItem(itemD)
+		err = r.table().UpdateItemContext(ctx, itemD)
 		if err != nil {
 			return docAddr, docHash, fmt.Errorf("update DID on table: %w", err)
 		}
 	}
 
+	kind := EventUpdated
+	if expectedStatus == Initial {
+		kind = EventRegistered
+	}
+	if err := r.emit(ctx, kind, did, Normal); err != nil {
+		return docAddr, docHash, err
+	}
 	return docAddr, docHash, nil
 }
 
+// keyProofTarget gets the target of key proofs registering did with
+// the doc at docAddr of docHash, or registering doc under InternalDocDB mode
+func (r *AccountDIDRegistry) keyProofTarget(did DID, docAddr string, docHash []byte, doc Doc) (*KeyProofTarget, error) {
+	if r.Mode != InternalDocDB {
+		return &KeyProofTarget{Registry: r.SelfChainDID, DID: did, DocAddr: docAddr, DocHash: docHash}, nil
+	}
+	if doc == nil {
+		return nil, &InvalidFormatError{What: "doc", Reason: "doc content is nil"}
+	}
+	hash, err := HashDoc(r.Codec, doc)
+	if err != nil {
+		return nil, err
+	}
+	return &KeyProofTarget{Registry: r.SelfChainDID, DID: doc.GetID(), DocHash: hash}, nil
+}
+
 func (r *AccountDIDRegistry) updateDocdbOrNot(
+	ctx context.Context,
 	did DID,
 	docAddr string,
 	docHash []byte,
@@ -289,53 +558,62 @@ func (r *AccountDIDRegistry) updateDocdbOrNot(
 	expectedStatus StatusType) (string, []byte, DID, error) {
 	if r.Mode == InternalDocDB {
 		if doc == nil {
-			return "", nil, "", fmt.Errorf("doc content is nil")
+			return "", nil, "", &InvalidFormatError{What: "doc", Reason: "doc content is nil"}
 		}
 		doc := doc.(*AccountDoc)
 		did = doc.GetID()
 
 		// check exist
-		exist := r.HasAccountDID(did)
+		exist, err := r.HasAccountDIDContext(ctx, did)
+		if err != nil {
+			return "", nil, "", err
+		}
 		if expectedStatus == Initial && exist {
-			return "", nil, "", fmt.Errorf("did %s already existed", did)
+			return "", nil, "", &AlreadyExistsError{ID: string(did)}
 		} else if expectedStatus == Normal && !exist {
-			return "", nil, "", fmt.Errorf("did %s not existed", did)
+			return "", nil, "", &NotFoundError{ID: string(did)}
 		}
 
-		status := r.getDIDStatus(did)
+		status, err := r.getDIDStatus(ctx, did)
+		if err != nil {
+			return "", nil, "", err
+		}
 		if status != expectedStatus {
-			return "", nil, "", fmt.Errorf("did %s is under status: %s, expectd status: %s", did, status, expectedStatus)
+			return "", nil, "", &InvalidStatusError{ID: did, Current: status, Expected: []StatusType{expectedStatus}}
 		}
 
-		docBytes, err := doc.Marshal()
+		docHash, err = HashDoc(r.Codec, doc)
 		if err != nil {
 			r.logger.Error("DID doc marshal:", err)
 			return "", nil, "", err
 		}
 
 		if expectedStatus == Initial { // register
-			docAddr, err = r.Docdb.Create(doc)
+			docAddr, err = r.docdb().CreateContext(ctx, doc)
 			if err != nil {
 				return "", nil, "", fmt.Errorf("register DID on docdb: %w", err)
 			}
 		} else { // update
-			docAddr, err = r.Docdb.Update(doc)
+			stored, err := r.docdb().GetContext(ctx, did, AccountDIDType)
+			if err != nil {
+				return "", nil, "", fmt.Errorf("DID docdb get: %w", err)
+			}
+			if err := checkKeysKept(ctx, &stored.(*AccountDoc).BasicDoc, &doc.BasicDoc); err != nil {
+				return "", nil, "", err
+			}
+			docAddr, err = r.docdb().UpdateContext(ctx, doc)
 			if err != nil {
 				return "", nil, "", fmt.Errorf("update DID on docdb: %w", err)
 			}
 		}
-
-		docHash32 := sha256.Sum256(docBytes)
-		docHash = docHash32[:]
 	} else {
-		status := r.getDIDStatus(did)
+		status, err := r.getDIDStatus(ctx, did)
+		if err != nil {
+			return "", nil, "", err
+		}
 		if status != expectedStatus {
 			return "", nil, "",
-				fmt.Errorf(
-					"SelfChainDID %s is under status: %s, expectd status: %s",
-					did,
-					status,
-					expectedStatus)
+				&InvalidStatusError{ID: did, Current: status, Expected: []StatusType{expectedStatus}}
 		}
 	}
 	return docAddr, docHash, did, nil
@@ -344,39 +622,83 @@ func (r *AccountDIDRegistry) updateDocdbOrNot(
 // Freeze freezes an account did
 // ATN: only admin should call this.
 func (r *AccountDIDRegistry) Freeze(did DID) error {
-	exist := r.HasAccountDID(did)
+	return r.FreezeContext(context.Background(), did)
+}
+
+// FreezeContext is Freeze with context
+func (r *AccountDIDRegistry) FreezeContext(ctx context.Context, did DID) error {
+	if err := checkGoverned(ctx, r.Governance, ActionFreeze); err != nil {
+		return err
+	}
+	if err := checkPermission(ctx, r.RBAC, PermFreeze); err != nil {
+		return err
+	}
+	exist, err := r.HasAccountDIDContext(ctx, did)
+	if err != nil {
+		return err
+	}
 	if !exist {
-		return fmt.Errorf("did %s not existed", did)
+		return &NotFoundError{ID: string(did)}
 	}
-	return r.auditStatus(did, Frozen)
+	return r.auditStatus(ctx, ActionFreeze, EventFrozen, did, Frozen)
+}
+
+// FreezeWithReason is Freeze recording the reason of the decision
+func (r *AccountDIDRegistry) FreezeWithReason(did DID, reason Reason) error {
+	return r.FreezeContext(ContextWithReason(context.Background(), reason), did)
 }
 
 // UnFreeze unfreezes an account did
 // ATN: only admin should call this.
 func (r *AccountDIDRegistry) UnFreeze(did DID) error {
-	exist := r.HasAccountDID(did)
+	return r.UnFreezeContext(context.Background(), did)
+}
+
+// UnFreezeContext is UnFreeze with context
+func (r *AccountDIDRegistry) UnFreezeContext(ctx context.Context, did DID) error {
+	if err := checkGoverned(ctx, r.Governance, ActionUnFreeze); err != nil {
+		return err
+	}
+	if err := checkPermission(ctx, r.RBAC, PermFreeze); err != nil {
+		return err
+	}
+	exist, err := r.HasAccountDIDContext(ctx, did)
+	if err != nil {
+		return err
+	}
 	if !exist {
-		return fmt.Errorf("did %s not existed", did)
+		return &NotFoundError{ID: string(did)}
 	}
-	return r.auditStatus(did, Normal)
+	return r.auditStatus(ctx, ActionUnFreeze, EventUnFrozen, did, Normal)
 }
 
 // Resolve looks up local-chain to resolve did.
 // @*AccountDoc returns nil if mode is ExternalDocDB
 func (r *AccountDIDRegistry) Resolve(did DID) (*AccountItem, *AccountDoc, bool, error) {
-	exist := r.HasAccountDID(did)
+	return r.ResolveContext(context.Background(), did)
+}
+
+// ResolveContext is Resolve with context
+func (r *AccountDIDRegistry) ResolveContext(ctx context.Context, did DID) (*AccountItem, *AccountDoc, bool, error) {
+	exist, err := r.HasAccountDIDContext(ctx, did)
+	if err != nil {
+		return nil, nil, false, err
+	}
 	if !exist {
-		return nil, nil, false, fmt.Errorf("did %s not existed", did)
+		return nil, nil, false, &NotFoundError{ID: string(did)}
 	}
 
-	item, err := r.Table.GetItem(did, AccountDIDType)
+	item, err := r.table().GetItemContext(ctx, did, AccountDIDType)
 	if err != nil {
 		return nil, nil, false, fmt.Errorf("resolve DID table get: %w", err)
 	}
-	itemD := item.(*AccountItem)
+	itemD, err := r.cascadeChainStatus(ctx, item.(*AccountItem))
+	if err != nil {
+		return nil, nil, false, err
+	}
 
 	if r.Mode == InternalDocDB {
-		doc, err := r.Docdb.Get(did, AccountDIDType)
+		doc, err := r.docdb().GetContext(ctx, did, AccountDIDType)
 		if err != nil {
 			return itemD, nil, true, fmt.Errorf("resolve DID docdb get: %w", err)
 		}
@@ -387,54 +709,241 @@ func (r *AccountDIDRegistry) Resolve(did DID) (*AccountItem, *AccountDoc, bool,
 	return itemD, nil, true, nil
 }
 
+// ResolveFull resolves an account did along with its doc.
+// Under ExternalDocDB mode the doc is fetched from DocAddr by the Fetcher
+// of the registry and verified against DocHash.
+func (r *AccountDIDRegistry) ResolveFull(did DID) (*AccountItem, *AccountDoc, error) {
+	return r.ResolveFullContext(context.Background(), did)
+}
+
+// ResolveFullContext is ResolveFull with context
+func (r *AccountDIDRegistry) ResolveFullContext(ctx context.Context, did DID) (*AccountItem, *AccountDoc, error) {
+	item, doc, _, err := r.ResolveContext(ctx, did)
+	if err != nil {
+		return item, doc, err
+	}
+	if r.Mode == InternalDocDB {
+		return item, doc, nil
+	}
+	fetched, err := fetchDoc(ctx, r.Fetcher, r.docCache, r.Codec, &item.BasicItem, AccountDIDType)
+	if err != nil {
+		return item, nil, fmt.Errorf("resolve DID full: %w", err)
+	}
+	return item, fetched.(*AccountDoc), nil
+}
+
+// ResolveWithProof resolves an account did item along with a merkle proof of it,
+// which proves non-inclusion if the item is nil.
+// The table of the registry should be a ProvableTable. The item resolves
+// Frozen under a frozen chain did as in Resolve, while the proof is of the
+// stored item.
+func (r *AccountDIDRegistry) ResolveWithProof(did DID) (*AccountItem, *MerkleProof, error) {
+	return r.ResolveWithProofContext(context.Background(), did)
+}
+
+// ResolveWithProofContext is ResolveWithProof with context
+func (r *AccountDIDRegistry) ResolveWithProofContext(ctx context.Context, did DID) (*AccountItem, *MerkleProof, error) {
+	pt, ok := r.Table.(ProvableTable)
+	if !ok {
+		return nil, nil, fmt.Errorf("resolve DID with proof: table is not provable")
+	}
+	proof, err := pt.Prove(did)
+	if err != nil {
+		return nil, nil, fmt.Errorf("resolve DID with proof: %w", err)
+	}
+	if !pt.HasItem(did) {
+		return nil, proof, nil
+	}
+	item, err := pt.GetItem(did, AccountDIDType)
+	if err != nil {
+		return nil, nil, fmt.Errorf("resolve DID table get: %w", err)
+	}
+	itemD, err := r.cascadeChainStatus(ctx, item.(*AccountItem))
+	if err != nil {
+		return nil, nil, err
+	}
+	return itemD, proof, nil
+}
+
 // Delete deletes data of an account did
 func (r *AccountDIDRegistry) Delete(did DID) error {
-	err := r.auditStatus(did, Initial)
+	return r.DeleteContext(context.Background(), did)
+}
+
+// DeleteContext is Delete with context
+func (r *AccountDIDRegistry) DeleteContext(ctx context.Context, did DID) error {
+	if err := checkGoverned(ctx, r.Governance, ActionDelete); err != nil {
+		return err
+	}
+	if err := checkPermission(ctx, r.RBAC, PermAdmin); err != nil {
+		return err
+	}
+	err := r.auditStatus(ctx, ActionDelete, "", did, Initial)
 	if err != nil {
 		return fmt.Errorf("delete DID aduit status: %w", err)
 	}
-	r.Table.DeleteItem(did)
+	if err := r.table().DeleteItemContext(ctx, did); err != nil {
+		return fmt.Errorf("delete DID on table: %w", err)
+	}
 	if r.Mode == InternalDocDB {
-		r.Docdb.Delete(did)
+		if err := r.docdb().DeleteContext(ctx, did); err != nil {
+			return fmt.Errorf("delete DID on docdb: %w", err)
+		}
 	}
-	return nil
+	return r.emit(ctx, EventDeleted, did, Initial)
+}
+
+// DeleteWithReason is Delete recording the reason of the decision,
+// which is kept by the audit log and events since the item is removed.
+func (r *AccountDIDRegistry) DeleteWithReason(did DID, reason Reason) error {
+	return r.DeleteContext(ContextWithReason(context.Background(), reason), did)
 }
 
 // HasAccountDID checks whether an account did exists
 func (r *AccountDIDRegistry) HasAccountDID(did DID) bool {
-	exist := r.Table.HasItem(did)
+	exist, _ := r.HasAccountDIDContext(context.Background(), did)
 	return exist
 }
 
-func (r *AccountDIDRegistry) getDIDStatus(did DID) StatusType {
-	if !r.Table.HasItem(did) {
-		return Initial
+// HasAccountDIDContext is HasAccountDID with context
+func (r *AccountDIDRegistry) HasAccountDIDContext(ctx context.Context, did DID) (bool, error) {
+	return r.table().HasItemContext(ctx, did)
+}
+
+func (r *AccountDIDRegistry) supportsAction(action AuditAction) bool {
+	switch action {
+	case ActionFreeze, ActionUnFreeze, ActionDelete, ActionAddAdmin, ActionRemoveAdmin, ActionCancelAdminChange, ActionGrantRole, ActionRevokeRole:
+		return true
 	}
-	item, err := r.Table.GetItem(did, AccountDIDType)
+	return false
+}
+
+func (r *AccountDIDRegistry) executeProposal(ctx context.Context, p *Proposal) error {
+	switch p.Action {
+	case ActionFreeze:
+		return r.FreezeContext(ctx, p.Target)
+	case ActionUnFreeze:
+		return r.UnFreezeContext(ctx, p.Target)
+	case ActionDelete:
+		return r.DeleteContext(ctx, p.Target)
+	case ActionAddAdmin:
+		return r.AddAdminContext(ctx, p.Target)
+	case ActionRemoveAdmin:
+		return r.RemoveAdminContext(ctx, p.Target)
+	case ActionCancelAdminChange:
+		return r.CancelAdminChangeContext(ctx, p.Target)
+	case ActionGrantRole:
+		return r.GrantRoleContext(ctx, p.Target, p.Role)
+	case ActionRevokeRole:
+		return r.RevokeRoleContext(ctx, p.Target, p.Role)
+	}
+	return &InvalidFormatError{What: "proposal", Reason: fmt.Sprintf("unsupported action %s", p.Action)}
+}
+
+func (r *AccountDIDRegistry) table() RegistryTableContext {
+	return TableWithContext(r.Table)
+}
+
+func (r *AccountDIDRegistry) docdb() DocDBContext {
+	return DocDBWithContext(r.Docdb)
+}
+
+func (r *AccountDIDRegistry) emit(ctx context.Context, kind EventKind, did DID, status StatusType) error {
+	return emitEvent(ctx, r.Events, &Event{Kind: kind, DID: did, Type: AccountDIDType, Status: status})
+}
+
+func (r *AccountDIDRegistry) getDIDStatus(ctx context.Context, did DID) (StatusType, error) {
+	exist, err := r.table().HasItemContext(ctx, did)
+	if err != nil {
+		return BadStatus, err
+	}
+	if !exist {
+		return Initial, nil
+	}
+	item, err := r.table().GetItemContext(ctx, did, AccountDIDType)
 	if err != nil {
 		r.logger.Error("did status get item:", err)
-		return BadStatus
+		return BadStatus, fmt.Errorf("did status get item: %w", err)
 	}
 	itemD := item.(*AccountItem)
-	return itemD.Status
+	return itemD.Status, nil
+}
+
+// checkChainDID refuses did not under the chain did of the registry,
+// or under an unknown or abnormal chain did
+func (r *AccountDIDRegistry) checkChainDID(ctx context.Context, did DID) error {
+	if r.ChainResolver == nil {
+		return nil
+	}
+	chainDID := did.GetChainDID()
+	if chainDID != r.SelfChainDID {
+		return &InvalidFormatError{What: "account did", Reason: fmt.Sprintf("%s is not under chain did %s", did, r.SelfChainDID)}
+	}
+	status, err := r.ChainResolver.ChainDIDStatus(ctx, chainDID)
+	if err != nil {
+		return fmt.Errorf("resolve chain did %s: %w", chainDID, err)
+	}
+	if status == Initial {
+		return &NotFoundError{ID: string(chainDID), Store: "chain did registry"}
+	}
+	if status != Normal {
+		return &InvalidStatusError{ID: chainDID, Op: "register account dids under", Current: status, Expected: []StatusType{Normal}}
+	}
+	return nil
 }
 
-//  caller naturally owns the did ended with his address.
+// cascadeChainStatus makes item resolve Frozen while its chain did is frozen,
+// the stored item is not changed.
+func (r *AccountDIDRegistry) cascadeChainStatus(ctx context.Context, item *AccountItem) (*AccountItem, error) {
+	if r.ChainResolver == nil || item.Status == Frozen {
+		return item, nil
+	}
+	chainDID := item.ID.GetChainDID()
+	status, err := r.ChainResolver.ChainDIDStatus(ctx, chainDID)
+	if err != nil {
+		return nil, fmt.Errorf("resolve chain did %s: %w", chainDID, err)
+	}
+	if status != Frozen {
+		return item, nil
+	}
+	cascaded := *item
+	cascaded.Status = Frozen
+	return &cascaded, nil
+}
+
+// caller naturally owns the did ended with his address,
+// which is derived from keys by AddressFromPublicKey.
 func (r *AccountDIDRegistry) owns(caller string, did DID) bool {
 	s := strings.Split(string(did), ":")
 	return s[len(s)-1] == caller
 }
 
-func (r *AccountDIDRegistry) auditStatus(did DID, status StatusType) error {
-	item, err := r.Table.GetItem(did, AccountDIDType)
+// auditStatus sets status of did, emits an event of kind if kind is
+// not empty and records the admin action. The update is reverted if the
+// event can not be emitted, and is not made if the action can not be recorded.
+func (r *AccountDIDRegistry) auditStatus(ctx context.Context, action AuditAction, kind EventKind, did DID, status StatusType) error {
+	item, err := r.table().GetItemContext(ctx, did, AccountDIDType)
 	if err != nil {
 		return fmt.Errorf("did status get: %w", err)
 	}
 	itemD := item.(*AccountItem)
+	prev := *itemD
 	itemD.Status = status
-	err = r.Table.UpdateItem(item)
-	if err != nil {
-		return fmt.Errorf("did status update: %w", err)
-	}
-	return nil
+	itemD.Decisions = appendDecision(ctx, itemD.Decisions, action, status)
+	e := &AuditEntry{Action: action, Target: did, OldStatus: prev.Status, NewStatus: status}
+	return recordAuditedWrite(ctx, r.AuditLog, e, func() error {
+		if err := r.table().UpdateItemContext(ctx, itemD); err != nil {
+			return fmt.Errorf("did status update: %w", err)
+		}
+		if kind == "" {
+			return nil
+		}
+		if err := r.emit(ctx, kind, did, status); err != nil {
+			if rerr := r.table().UpdateItemContext(ctx, &prev); rerr != nil {
+				return fmt.Errorf("did status revert after %v: %w", err, rerr)
+			}
+			return err
+		}
+		return nil
+	})
 }
@@ -2,6 +2,7 @@ package bitxid
 
 import (
 	"crypto/sha256"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -280,3 +281,89 @@ func testDIDCloseSucceedExternal(t *testing.T, r *AccountDIDRegistry, path ...st
 		assert.Nil(t, err)
 	}
 }
+
+func TestDIDDecisions(t *testing.T) {
+	r, drtPath, ddbPath := newDIDModeInternal(t)
+	defer os.RemoveAll(drtPath)
+	defer os.RemoveAll(ddbPath)
+	ps := NewPubSub()
+	sub := ps.Subscribe(EventFilter{Kinds: []EventKind{EventFrozen, EventDeleted}}, 4)
+	r.Events = ps
+
+	testSetupDIDSucceed(t, r)
+	testDIDRegisterSucceedInternal(t, r)
+	reason := Reason{Code: ReasonFraud, Comment: "phishing", Evidence: []string{"bafkreiexample"}}
+	assert.Nil(t, r.FreezeWithReason(testAccountDID, reason))
+	item, _, _, err := r.Resolve(testAccountDID)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(item.Decisions))
+	assert.Equal(t, reason, item.Decisions[0].Reason)
+	assert.Equal(t, Frozen, item.Decisions[0].Status)
+	testDIDUnFreezeSucceed(t, r)
+	item, _, _, err = r.Resolve(testAccountDID)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(item.Decisions))
+	assert.Equal(t, ReasonUnspecified, item.Decisions[1].Reason.Code)
+
+	assert.Nil(t, r.DeleteWithReason(testAccountDID, Reason{Code: ReasonRequestedByHolder}))
+	ev := <-sub.C
+	assert.Equal(t, &reason, ev.Reason)
+	ev = <-sub.C
+	assert.Equal(t, EventDeleted, ev.Kind)
+	assert.Equal(t, ReasonRequestedByHolder, ev.Reason.Code)
+}
+
+func TestDIDChainDIDResolver(t *testing.T) {
+	mr, tablePath, docdbPath := newChainDIDModeInternal(t)
+	defer os.RemoveAll(tablePath)
+	defer os.RemoveAll(docdbPath)
+	r, drtPath, ddbPath := newDIDModeInternal(t)
+	defer os.RemoveAll(drtPath)
+	defer os.RemoveAll(ddbPath)
+	WithChainDIDResolver(mr)(r)
+	mt, err := NewMerkleTable(r.Table, backingStore(r.Table))
+	assert.Nil(t, err)
+	r.Table = mt
+
+	// unknown chain did
+	err = r.SetupGenesis()
+	assert.True(t, errors.Is(err, ErrNotFound))
+
+	testChainDIDSetupGenesSucceed(t, mr)
+	testChainDIDApplySucceed(t, mr)
+	testChainDIDAuditApplySucceed(t, mr)
+	// chain did not registered yet
+	err = r.SetupGenesis()
+	assert.True(t, errors.Is(err, ErrInvalidStatus))
+	testChainDIDRegisterSucceedInternal(t, mr)
+	testSetupDIDSucceed(t, r)
+
+	// account dids of other chains
+	doc := getAccountDoc(1)
+	doc.ID = DID("did:bitxhub:appchain002:0x12345678")
+	_, _, err = r.RegisterWithDoc(&doc)
+	assert.True(t, errors.Is(err, ErrInvalidFormat))
+
+	testDIDRegisterSucceedInternal(t, r)
+	assert.Nil(t, mr.Freeze(chainDID))
+	_, _, err = r.UpdateWithDoc(&accountDocB)
+	assert.True(t, errors.Is(err, ErrInvalidStatus))
+	item, _, _, err := r.Resolve(testAccountDID)
+	assert.Nil(t, err)
+	assert.Equal(t, Frozen, item.Status)
+	// the stored status is kept
+	stored, err := r.Table.GetItem(testAccountDID, AccountDIDType)
+	assert.Nil(t, err)
+	assert.Equal(t, Normal, stored.(*AccountItem).Status)
+	item, proof, err := r.ResolveWithProof(testAccountDID)
+	assert.Nil(t, err)
+	assert.Equal(t, Frozen, item.Status)
+	ok, err := VerifyInclusionProof(mt.Root(), stored, proof)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+
+	assert.Nil(t, mr.UnFreeze(chainDID))
+	item, _, _, err = r.Resolve(testAccountDID)
+	assert.Nil(t, err)
+	assert.Equal(t, Normal, item.Status)
+}
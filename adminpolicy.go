@@ -0,0 +1,206 @@
+package bitxid
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// AdminPolicy constrains changes of the admin set of a registry
+type AdminPolicy struct {
+	MinAdmins int           `json:"min_admins"` // admins can not be removed below it, at least 1
+	Quorum    int           `json:"quorum"`     // an admin can not remove itself leaving fewer admins than it, 0 means no limit
+	Timelock  time.Duration `json:"timelock"`   // delay before admin changes take effect, 0 means at once
+}
+
+// AdminChangeState .
+type AdminChangeState string
+
+// states of admin changes
+const (
+	AdminChangePending   AdminChangeState = "Pending"
+	AdminChangeApplied   AdminChangeState = "Applied"
+	AdminChangeCancelled AdminChangeState = "Cancelled"
+	AdminChangeFailed    AdminChangeState = "Failed" // violated the policy when it became effective
+)
+
+// AdminChange represents an admin change under timelock
+type AdminChange struct {
+	ID        uint64           `json:"id"`
+	Action    AuditAction      `json:"action"` // AddAdmin or RemoveAdmin
+	Admin     DID              `json:"admin"`
+	Caller    DID              `json:"caller"`
+	Reason    *Reason          `json:"reason,omitempty"`
+	Scheduled int64            `json:"scheduled"` // unix nano
+	Effective int64            `json:"effective"` // unix nano, the change is applied not before it
+	State     AdminChangeState `json:"state"`
+	Error     string           `json:"error,omitempty"` // why the change failed
+}
+
+// AdminSet is the admin list of a registry with the policy of changing it.
+// With a timelock, AddAdmin and RemoveAdmin only schedule changes, which
+// take effect when ApplyAdminChanges is called after their effective time
+// and may be cancelled by CancelAdminChange before that.
+// Registries embed it, so their admins are written as
+// AdminSet: AdminSet{Admins: admins} in composite literals,
+// while r.Admins and the json key "admins" are kept.
+type AdminSet struct {
+	Admins       []DID          `json:"admins"` // admins of the registry
+	AdminPolicy  AdminPolicy    `json:"admin_policy"`
+	AdminChanges []*AdminChange `json:"admin_changes,omitempty"` // pending changes
+	LastChangeID uint64         `json:"last_admin_change_id,omitempty"`
+	now          func() time.Time
+}
+
+// PendingAdminChanges gets admin changes waiting for their timelock
+func (s *AdminSet) PendingAdminChanges() []*AdminChange {
+	return s.AdminChanges
+}
+
+func (s *AdminSet) clock() time.Time {
+	if s.now == nil {
+		return time.Now()
+	}
+	return s.now()
+}
+
+func (s *AdminSet) hasAdmin(a DID) bool {
+	for _, v := range s.Admins {
+		if v == a {
+			return true
+		}
+	}
+	return false
+}
+
+// check checks whether the admin change is allowed by the policy,
+// pending changes other than skip are taken into account.
+func (s *AdminSet) check(ctx context.Context, action AuditAction, target DID, skip *AdminChange) error {
+	removals := 0
+	for _, c := range s.AdminChanges {
+		if c == skip || c.State != AdminChangePending {
+			continue
+		}
+		if c.Admin == target {
+			return &AlreadyExistsError{ID: string(target), Store: "admin changes"}
+		}
+		if c.Action == ActionRemoveAdmin {
+			removals++
+		}
+	}
+	if action == ActionAddAdmin {
+		if s.hasAdmin(target) {
+			return &AlreadyExistsError{ID: string(target), Store: "admins"}
+		}
+		return nil
+	}
+	if !s.hasAdmin(target) {
+		return &NotFoundError{ID: string(target), Store: "admins"}
+	}
+	remaining := len(s.Admins) - removals - 1
+	min := s.AdminPolicy.MinAdmins
+	if min < 1 {
+		min = 1
+	}
+	if remaining < min {
+		return &PolicyViolationError{Policy: "admin policy", Reason: fmt.Sprintf("removing %s leaves %d admins, at least %d required", target, remaining, min)}
+	}
+	if caller, _ := CallerFromContext(ctx); caller == target && remaining < s.AdminPolicy.Quorum {
+		return &PolicyViolationError{Policy: "admin policy", Reason: fmt.Sprintf("%s can not remove itself leaving %d admins below quorum %d", target, remaining, s.AdminPolicy.Quorum)}
+	}
+	return nil
+}
+
+// change makes the admin change at once, or schedules it under timelock
+func (s *AdminSet) change(ctx context.Context, l *AuditLog, action AuditAction, target DID) error {
+	if err := s.check(ctx, action, target, nil); err != nil {
+		return err
+	}
+	if s.AdminPolicy.Timelock <= 0 {
+		return s.commit(ctx, l, action, target)
+	}
+	caller, _ := CallerFromContext(ctx)
+	now := s.clock()
+	s.LastChangeID++
+	c := &AdminChange{
+		ID:        s.LastChangeID,
+		Action:    action,
+		Admin:     target,
+		Caller:    caller,
+		Scheduled: now.UnixNano(),
+		Effective: now.Add(s.AdminPolicy.Timelock).UnixNano(),
+		State:     AdminChangePending,
+	}
+	if reason, ok := ReasonFromContext(ctx); ok {
+		c.Reason = &reason
+	}
+	s.AdminChanges = append(s.AdminChanges, c)
+	return nil
+}
+
+func (s *AdminSet) commit(ctx context.Context, l *AuditLog, action AuditAction, target DID) error {
+	switch action {
+	case ActionAddAdmin:
+		s.Admins = append(s.Admins, target)
+	case ActionRemoveAdmin:
+		for i, admin := range s.Admins {
+			if admin == target {
+				s.Admins = append(s.Admins[:i], s.Admins[i+1:]...)
+				break
+			}
+		}
+	}
+	return recordAudit(ctx, l, action, target, "", "")
+}
+
+// applyDue applies changes whose timelock has passed, changes violating
+// the policy by then fail. The finished changes are returned.
+func (s *AdminSet) applyDue(ctx context.Context, l *AuditLog) ([]*AdminChange, error) {
+	now := s.clock().UnixNano()
+	done := []*AdminChange{}
+	var err error
+	for _, c := range s.AdminChanges {
+		if c.Effective > now {
+			continue
+		}
+		cctx := ContextWithCaller(ctx, c.Caller)
+		if c.Reason != nil {
+			cctx = ContextWithReason(cctx, *c.Reason)
+		}
+		if cerr := s.check(cctx, c.Action, c.Admin, c); cerr != nil {
+			c.State = AdminChangeFailed
+			c.Error = cerr.Error()
+		} else {
+			c.State = AdminChangeApplied
+			if cerr := s.commit(cctx, l, c.Action, c.Admin); cerr != nil && err == nil {
+				err = cerr
+			}
+		}
+		done = append(done, c)
+	}
+	s.pruneChanges()
+	return done, err
+}
+
+// cancel cancels the pending change of admin
+func (s *AdminSet) cancel(ctx context.Context, l *AuditLog, admin DID) error {
+	for _, c := range s.AdminChanges {
+		if c.Admin == admin {
+			c.State = AdminChangeCancelled
+			s.pruneChanges()
+			return recordAudit(ctx, l, ActionCancelAdminChange, admin, "", "")
+		}
+	}
+	return &NotFoundError{ID: string(admin), Store: "admin changes"}
+}
+
+// pruneChanges drops finished changes
+func (s *AdminSet) pruneChanges() {
+	rest := []*AdminChange{}
+	for _, c := range s.AdminChanges {
+		if c.State == AdminChangePending {
+			rest = append(rest, c)
+		}
+	}
+	s.AdminChanges = rest
+}
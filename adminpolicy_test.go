@@ -0,0 +1,113 @@
+package bitxid
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdminPolicyChainDID(t *testing.T) {
+	mr, tablePath, docdbPath := newChainDIDModeInternal(t)
+	defer os.RemoveAll(tablePath)
+	defer os.RemoveAll(docdbPath)
+	testChainDIDSetupGenesSucceed(t, mr)
+
+	// the last admin can not be removed
+	err := mr.RemoveAdmin(superAdmin)
+	assert.True(t, errors.Is(err, ErrPolicyViolation))
+	assert.True(t, mr.HasAdmin(superAdmin))
+
+	WithChainAdminPolicy(AdminPolicy{MinAdmins: 1, Quorum: 3})(mr)
+	assert.Nil(t, mr.AddAdmin(admin))
+	assert.Nil(t, mr.AddAdmin(admin2))
+	// no self removal below quorum
+	assert.True(t, errors.Is(mr.RemoveAdminContext(asAdmin(admin), admin), ErrPolicyViolation))
+	assert.Nil(t, mr.RemoveAdminContext(asAdmin(superAdmin), admin))
+	assert.Nil(t, mr.RemoveAdminContext(asAdmin(superAdmin), admin2))
+	assert.True(t, errors.Is(mr.RemoveAdminContext(asAdmin(admin), superAdmin), ErrPolicyViolation))
+	assert.Equal(t, []DID{superAdmin}, mr.GetAdmins())
+}
+
+func TestAdminPolicyTimelock(t *testing.T) {
+	mr, tablePath, docdbPath := newChainDIDModeInternal(t)
+	defer os.RemoveAll(tablePath)
+	defer os.RemoveAll(docdbPath)
+	l, err := NewAuditLog(mr.Table.(*KVTable).Store)
+	assert.Nil(t, err)
+	WithChainAuditLog(l)(mr)
+	WithChainAdminPolicy(AdminPolicy{Timelock: time.Hour})(mr)
+	now := time.Now()
+	mr.now = func() time.Time { return now }
+	testChainDIDSetupGenesSucceed(t, mr)
+
+	ctx := ContextWithReason(asAdmin(superAdmin), Reason{Comment: "new operator"})
+	assert.Nil(t, mr.AddAdminContext(ctx, admin))
+	assert.Nil(t, mr.AddAdminContext(ctx, admin2))
+	assert.False(t, mr.HasAdmin(admin))
+	assert.True(t, errors.Is(mr.AddAdmin(admin), ErrAlreadyExists))
+	pending := mr.PendingAdminChanges()
+	assert.Equal(t, 2, len(pending))
+	assert.Equal(t, uint64(1), pending[0].ID)
+	assert.Equal(t, superAdmin, pending[0].Caller)
+
+	// nothing is due yet
+	done, err := mr.ApplyAdminChanges()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(done))
+
+	assert.Nil(t, mr.CancelAdminChange(admin2))
+	assert.True(t, errors.Is(mr.CancelAdminChange(admin2), ErrNotFound))
+
+	now = now.Add(2 * time.Hour)
+	done, err = mr.ApplyAdminChanges()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(done))
+	assert.Equal(t, AdminChangeApplied, done[0].State)
+	assert.True(t, mr.HasAdmin(admin))
+	assert.False(t, mr.HasAdmin(admin2))
+	assert.Equal(t, 0, len(mr.PendingAdminChanges()))
+
+	// pending removals count against the minimum
+	assert.Nil(t, mr.RemoveAdmin(admin))
+	assert.True(t, errors.Is(mr.RemoveAdmin(superAdmin), ErrPolicyViolation))
+	// changes violating the policy when due fail
+	mr.Admins = []DID{admin}
+	now = now.Add(2 * time.Hour)
+	done, err = mr.ApplyAdminChanges()
+	assert.Nil(t, err)
+	assert.Equal(t, AdminChangeFailed, done[0].State)
+	assert.NotEmpty(t, done[0].Error)
+	assert.True(t, mr.HasAdmin(admin))
+
+	entries, err := l.Entries(0, 0)
+	assert.Nil(t, err)
+	var actions []AuditAction
+	for _, e := range entries {
+		actions = append(actions, e.Action)
+	}
+	assert.Equal(t, []AuditAction{ActionAuditApply, ActionCancelAdminChange, ActionAddAdmin}, actions)
+	assert.Equal(t, superAdmin, entries[2].Caller)
+	assert.Equal(t, "new operator", entries[2].Reason.Comment)
+}
+
+func TestAdminPolicyAccountDID(t *testing.T) {
+	r, drtPath, ddbPath := newDIDModeInternal(t)
+	defer os.RemoveAll(drtPath)
+	defer os.RemoveAll(ddbPath)
+	WithAccountAdminPolicy(AdminPolicy{MinAdmins: 2, Timelock: time.Minute})(r)
+	now := time.Now()
+	r.now = func() time.Time { return now }
+	testSetupDIDSucceed(t, r)
+
+	assert.Nil(t, r.AddAdmin(admin))
+	// a change of admin is pending
+	assert.True(t, errors.Is(r.RemoveAdmin(admin), ErrAlreadyExists))
+	now = now.Add(time.Minute)
+	_, err := r.ApplyAdminChanges()
+	assert.Nil(t, err)
+	assert.True(t, r.HasAdmin(admin))
+	assert.True(t, errors.Is(r.RemoveAdmin(admin), ErrPolicyViolation))
+}
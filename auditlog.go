@@ -0,0 +1,274 @@
+package bitxid
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/meshplus/bitxhub-kit/storage"
+)
+
+// AuditAction .
+type AuditAction string
+
+// admin actions recorded by AuditLog
+const (
+	ActionAuditApply        AuditAction = "AuditApply"
+	ActionAudit             AuditAction = "Audit"
+	ActionFreeze            AuditAction = "Freeze"
+	ActionUnFreeze          AuditAction = "UnFreeze"
+	ActionAddAdmin          AuditAction = "AddAdmin"
+	ActionRemoveAdmin       AuditAction = "RemoveAdmin"
+	ActionDelete            AuditAction = "Delete"
+	ActionCancelAdminChange AuditAction = "CancelAdminChange"
+	ActionGrantRole         AuditAction = "GrantRole"
+	ActionRevokeRole        AuditAction = "RevokeRole"
+	ActionDelegate          AuditAction = "Delegate"
+)
+
+// AuditEntry records an admin action,
+// Hash covers all other fields including the hash of the previous entry.
+type AuditEntry struct {
+	Seq       uint64      `json:"seq"` // starts from 1
+	Action    AuditAction `json:"action"`
+	Caller    DID         `json:"caller"` // taken from the context of the action
+	Target    DID         `json:"target"`
+	OldStatus StatusType  `json:"old_status,omitempty"`
+	NewStatus StatusType  `json:"new_status,omitempty"`
+	Role      Role        `json:"role,omitempty"` // granted or revoked role
+	Reason    *Reason     `json:"reason,omitempty"`
+	Timestamp int64       `json:"timestamp"` // unix nano
+	PrevHash  []byte      `json:"prev_hash"`
+	Hash      []byte      `json:"hash,omitempty"`
+}
+
+// ComputeHash computes the hash of the entry
+func (e *AuditEntry) ComputeHash() ([]byte, error) {
+	c := *e
+	c.Hash = nil
+	data, err := json.Marshal(&c)
+	if err != nil {
+		return nil, err
+	}
+	hash := sha256.Sum256(data)
+	return hash[:], nil
+}
+
+// AuditLog is an append-only hash chained log of admin actions.
+// It may be shared by several registries.
+type AuditLog struct {
+	Store storage.Storage
+	seq   uint64 // seq of the last entry
+	head  []byte // hash of the last entry
+	lock  sync.Mutex
+}
+
+// NewAuditLog news an AuditLog in s, continuing the stored chain
+func NewAuditLog(s storage.Storage) (*AuditLog, error) {
+	l := &AuditLog{Store: s}
+	it := s.Prefix([]byte(auditPrefix))
+	for it.Next() {
+		e := &AuditEntry{}
+		if err := decodeRecord(it.Value(), e); err != nil {
+			return nil, fmt.Errorf("audit log unmarshal %s: %w", it.Key(), err)
+		}
+		if e.Seq > l.seq {
+			l.seq = e.Seq
+			l.head = e.Hash
+		}
+	}
+	return l, nil
+}
+
+// Append chains e to the log, Seq, PrevHash and Hash of e are set by the log
+func (l *AuditLog) Append(e *AuditEntry) error {
+	return l.appendWith(e, nil)
+}
+
+// appendWith prepares e, runs write if set and chains e only if write
+// succeeds. The lock is held throughout so that entries follow the order
+// of writes.
+func (l *AuditLog) appendWith(e *AuditEntry, write func() error) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	e.Seq = l.seq + 1
+	e.PrevHash = l.head
+	if e.Timestamp == 0 {
+		e.Timestamp = time.Now().UnixNano()
+	}
+	hash, err := e.ComputeHash()
+	if err != nil {
+		return fmt.Errorf("audit entry hash: %w", err)
+	}
+	e.Hash = hash
+	data, err := encodeRecord(&JSONCodec{}, e)
+	if err != nil {
+		return fmt.Errorf("audit entry marshal: %w", err)
+	}
+	if write != nil {
+		if err := write(); err != nil {
+			return err
+		}
+	}
+	l.Store.Put(auditKey(e.Seq), data)
+	l.seq = e.Seq
+	l.head = hash
+	return nil
+}
+
+// Head gets seq and hash of the last entry,
+// keep them elsewhere to detect truncation of the log.
+func (l *AuditLog) Head() (uint64, []byte) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.seq, l.head
+}
+
+// Entries reads at most limit entries from seq from (inclusive),
+// limit <= 0 means no limit.
+func (l *AuditLog) Entries(from uint64, limit int) ([]*AuditEntry, error) {
+	return readAuditEntries(l.Store, from, limit)
+}
+
+// Verify verifies the stored chain, see VerifyAuditLog
+func (l *AuditLog) Verify(head []byte) error {
+	return VerifyAuditLog(l.Store, head)
+}
+
+func (l *AuditLog) backingStore() storage.Storage {
+	return l.Store
+}
+
+// VerifyAuditLog verifies the audit log stored in s: entries should be
+// numbered continuously from 1 and each one should be chained to the
+// previous one with an intact hash. If head is not nil, the last entry
+// should have hash head, which detects removal of tail entries.
+func VerifyAuditLog(s storage.Storage, head []byte) error {
+	entries, err := readAuditEntries(s, 1, 0)
+	if err != nil {
+		return err
+	}
+	var prev []byte
+	for i, e := range entries {
+		if e.Seq != uint64(i+1) {
+			return &InvalidFormatError{What: "audit log", Reason: fmt.Sprintf("gap before seq %d, expected %d", e.Seq, i+1)}
+		}
+		if !bytes.Equal(e.PrevHash, prev) {
+			return &InvalidFormatError{What: "audit log", Reason: fmt.Sprintf("entry %d is not chained to the previous one", e.Seq)}
+		}
+		hash, err := e.ComputeHash()
+		if err != nil {
+			return fmt.Errorf("audit entry hash: %w", err)
+		}
+		if !bytes.Equal(hash, e.Hash) {
+			return &InvalidFormatError{What: "audit log", Reason: fmt.Sprintf("entry %d is modified", e.Seq)}
+		}
+		prev = e.Hash
+	}
+	if head != nil && !bytes.Equal(prev, head) {
+		return &InvalidFormatError{What: "audit log", Reason: fmt.Sprintf("head mismatch: expected %x, got %x", head, prev)}
+	}
+	return nil
+}
+
+func readAuditEntries(s storage.Storage, from uint64, limit int) ([]*AuditEntry, error) {
+	if from == 0 {
+		from = 1
+	}
+	it := s.Iterator(auditKey(from), []byte(auditPrefix+"~"))
+	entries := []*AuditEntry{}
+	for it.Next() {
+		if limit > 0 && len(entries) >= limit {
+			break
+		}
+		e := &AuditEntry{}
+		if err := decodeRecord(it.Value(), e); err != nil {
+			return nil, fmt.Errorf("audit log unmarshal %s: %w", it.Key(), err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// recordAudit appends an entry of an admin action to l if l is set,
+// the caller and reason are taken from ctx.
+func recordAudit(ctx context.Context, l *AuditLog, action AuditAction, target DID, old, new StatusType) error {
+	return recordAuditEntry(ctx, l, &AuditEntry{
+		Action:    action,
+		Target:    target,
+		OldStatus: old,
+		NewStatus: new,
+	})
+}
+
+// recordAuditEntry appends e to l if l is set,
+// the caller and reason are taken from ctx.
+func recordAuditEntry(ctx context.Context, l *AuditLog, e *AuditEntry) error {
+	return recordAuditedWrite(ctx, l, e, nil)
+}
+
+// recordAuditedWrite runs write and appends e to l if l is set: e is
+// appended only if write succeeds, and write is not run if e can not be
+// appended.
+func recordAuditedWrite(ctx context.Context, l *AuditLog, e *AuditEntry, write func() error) error {
+	if l == nil {
+		if write == nil {
+			return nil
+		}
+		return write()
+	}
+	e.Caller, _ = CallerFromContext(ctx)
+	if ts, ok := TimestampFromContext(ctx); ok {
+		e.Timestamp = ts
+	}
+	if reason, ok := ReasonFromContext(ctx); ok {
+		e.Reason = &reason
+	}
+	written := false
+	err := l.appendWith(e, func() error {
+		written = true
+		if write == nil {
+			return nil
+		}
+		return write()
+	})
+	if err != nil && !written {
+		return fmt.Errorf("record %s of %s: %w", e.Action, e.Target, err)
+	}
+	return err
+}
+
+// MaxDecisions is the number of latest decisions kept on an item,
+// the full history is kept by the audit log
+const MaxDecisions = 16
+
+// appendDecision appends a decision of an admin action to ds and drops
+// the oldest ones beyond MaxDecisions. The caller, reason and timestamp
+// are taken from ctx, decisions carry no wall clock time since items
+// are hashed and replicated.
+func appendDecision(ctx context.Context, ds []Decision, action AuditAction, status StatusType) []Decision {
+	caller, _ := CallerFromContext(ctx)
+	reason, _ := ReasonFromContext(ctx)
+	ts, _ := TimestampFromContext(ctx)
+	ds = append(ds, Decision{
+		Action:    action,
+		Status:    status,
+		Reason:    reason,
+		Caller:    caller,
+		Timestamp: ts,
+	})
+	if len(ds) > MaxDecisions {
+		ds = append([]Decision{}, ds[len(ds)-MaxDecisions:]...)
+	}
+	return ds
+}
+
+const auditPrefix = "audit-"
+
+func auditKey(seq uint64) []byte {
+	return []byte(fmt.Sprintf("%s%020d", auditPrefix, seq))
+}
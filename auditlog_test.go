@@ -0,0 +1,163 @@
+package bitxid
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type failingSink struct{}
+
+func (failingSink) Emit(ev *Event) error {
+	return errors.New("sink is down")
+}
+
+func TestAuditLogVerify(t *testing.T) {
+	s, dir := newTestStorage(t, "audit.store")
+	defer os.RemoveAll(dir)
+	l, err := NewAuditLog(s)
+	assert.Nil(t, err)
+	for i := 0; i < 5; i++ {
+		assert.Nil(t, l.Append(&AuditEntry{Action: ActionFreeze, Caller: admin, Target: chainDID}))
+	}
+	seq, head := l.Head()
+	assert.Equal(t, uint64(5), seq)
+	assert.Nil(t, l.Verify(head))
+	assert.Nil(t, VerifyAuditLog(s, nil))
+
+	// continues the stored chain
+	l, err = NewAuditLog(s)
+	assert.Nil(t, err)
+	e := &AuditEntry{Action: ActionUnFreeze, Caller: admin, Target: chainDID}
+	assert.Nil(t, l.Append(e))
+	assert.Equal(t, uint64(6), e.Seq)
+	assert.Equal(t, head, e.PrevHash)
+	_, head = l.Head()
+	assert.Nil(t, l.Verify(head))
+
+	entries, err := l.Entries(2, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(entries))
+	assert.Equal(t, uint64(2), entries[0].Seq)
+
+	// edits
+	raw := s.Get(auditKey(3))
+	edited := entries[1]
+	edited.Caller = mcaller
+	data, err := encodeRecord(&JSONCodec{}, edited)
+	assert.Nil(t, err)
+	s.Put(auditKey(3), data)
+	err = l.Verify(head)
+	assert.True(t, errors.Is(err, ErrInvalidFormat))
+	assert.Contains(t, err.Error(), "entry 3 is modified")
+	s.Put(auditKey(3), raw)
+	assert.Nil(t, l.Verify(head))
+
+	// gaps
+	s.Delete(auditKey(4))
+	err = l.Verify(head)
+	assert.True(t, errors.Is(err, ErrInvalidFormat))
+	assert.Contains(t, err.Error(), "gap")
+	s.Put(auditKey(4), raw)
+	err = l.Verify(head)
+	assert.True(t, errors.Is(err, ErrInvalidFormat))
+
+	// truncation is only detected with a head
+	s, dir2 := newTestStorage(t, "audit2.store")
+	defer os.RemoveAll(dir2)
+	l, err = NewAuditLog(s)
+	assert.Nil(t, err)
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, l.Append(&AuditEntry{Action: ActionFreeze, Target: chainDID}))
+	}
+	_, head = l.Head()
+	s.Delete(auditKey(3))
+	assert.Nil(t, VerifyAuditLog(s, nil))
+	assert.True(t, errors.Is(VerifyAuditLog(s, head), ErrInvalidFormat))
+}
+
+func TestChainDIDAuditLog(t *testing.T) {
+	mr, tablePath, docdbPath := newChainDIDModeInternal(t)
+	defer os.RemoveAll(tablePath)
+	defer os.RemoveAll(docdbPath)
+	l, err := NewAuditLog(mr.Table.(*KVTable).Store)
+	assert.Nil(t, err)
+	mr.AuditLog = l
+
+	testChainDIDSetupGenesSucceed(t, mr)
+	ctx := ContextWithCaller(context.Background(), superAdmin)
+	assert.Nil(t, mr.AddAdminContext(ctx, admin))
+	testChainDIDApplySucceed(t, mr)
+	ctx = ContextWithCaller(context.Background(), admin)
+	assert.Nil(t, mr.AuditApplyContext(ctx, chainDID, true))
+	testChainDIDRegisterSucceedInternal(t, mr)
+	assert.Nil(t, mr.FreezeContext(ContextWithReason(ctx, Reason{Code: ReasonFraud, Comment: "suspicious"}), chainDID))
+	assert.Nil(t, mr.UnFreezeContext(ContextWithTimestamp(ctx, 1617006461000000000), chainDID))
+	// nothing is changed or recorded if the event can not be emitted
+	mr.Events = failingSink{}
+	assert.NotNil(t, mr.FreezeContext(ctx, chainDID))
+	mr.Events = nil
+	item, err := mr.Table.GetItem(chainDID, ChainDIDType)
+	assert.Nil(t, err)
+	assert.Equal(t, Normal, item.(*ChainItem).Status)
+	assert.Nil(t, mr.DeleteContext(ctx, chainDID))
+	assert.Nil(t, mr.RemoveAdminContext(ctx, admin))
+
+	entries, err := l.Entries(0, 0)
+	assert.Nil(t, err)
+	expected := []struct {
+		action   AuditAction
+		caller   DID
+		target   DID
+		old, new StatusType
+	}{
+		{ActionAuditApply, "", mr.GenesisChainDID, ApplyAudit, ApplySuccess},
+		{ActionAddAdmin, superAdmin, admin, "", ""},
+		{ActionAuditApply, admin, chainDID, ApplyAudit, ApplySuccess},
+		{ActionFreeze, admin, chainDID, Normal, Frozen},
+		{ActionUnFreeze, admin, chainDID, Frozen, Normal},
+		{ActionDelete, admin, chainDID, Normal, Initial},
+		{ActionRemoveAdmin, admin, admin, "", ""},
+	}
+	assert.Equal(t, len(expected), len(entries))
+	for i, e := range expected {
+		assert.Equal(t, e.action, entries[i].Action)
+		assert.Equal(t, e.caller, entries[i].Caller)
+		assert.Equal(t, e.target, entries[i].Target)
+		assert.Equal(t, e.old, entries[i].OldStatus)
+		assert.Equal(t, e.new, entries[i].NewStatus)
+		assert.NotZero(t, entries[i].Timestamp)
+	}
+	assert.Equal(t, &Reason{Code: ReasonFraud, Comment: "suspicious"}, entries[3].Reason)
+	assert.Nil(t, entries[4].Reason)
+	assert.Equal(t, int64(1617006461000000000), entries[4].Timestamp)
+	_, head := l.Head()
+	assert.Nil(t, l.Verify(head))
+}
+
+func TestAccountDIDAuditLog(t *testing.T) {
+	r, drtPath, ddbPath := newDIDModeInternal(t)
+	defer os.RemoveAll(drtPath)
+	defer os.RemoveAll(ddbPath)
+	l, err := NewAuditLog(r.Table.(*KVTable).Store)
+	assert.Nil(t, err)
+	r.AuditLog = l
+
+	testSetupDIDSucceed(t, r)
+	testDIDRegisterSucceedInternal(t, r)
+	ctx := ContextWithCaller(context.Background(), rootAccountDID)
+	assert.Nil(t, r.FreezeContext(ctx, testAccountDID))
+	assert.Nil(t, r.DeleteContext(ctx, testAccountDID))
+
+	entries, err := l.Entries(0, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(entries))
+	assert.Equal(t, ActionFreeze, entries[0].Action)
+	assert.Equal(t, rootAccountDID, entries[0].Caller)
+	assert.Equal(t, ActionDelete, entries[1].Action)
+	assert.Equal(t, Frozen, entries[1].OldStatus)
+	assert.Nil(t, VerifyAuditLog(r.Table.(*KVTable).Store, nil))
+}
@@ -0,0 +1,290 @@
+package bitxid
+
+import (
+	"sync"
+
+	"github.com/meshplus/bitxhub-kit/storage"
+)
+
+// DefaultCacheSize is the default number of entries of caches
+const DefaultCacheSize = 1024
+
+// cachedEntry is an entry of table or docdb caches,
+// entries with exist false are negative entries.
+type cachedEntry struct {
+	exist bool
+	value interface{} // cloned item or doc, may be nil if only existence is known
+}
+
+var _ RegistryTable = (*CachedTable)(nil)
+
+// CachedTable is a read-through RegistryTable decorator with a LRU cache,
+// items are cloned in and out of the cache.
+type CachedTable struct {
+	Table RegistryTable
+	cache *lruCache
+	lock  sync.RWMutex // serializes writes against cache fills
+}
+
+// NewCachedTable wraps table t with a cache of size entries
+func NewCachedTable(t RegistryTable, size int) *CachedTable {
+	return &CachedTable{
+		Table: t,
+		cache: newLRUCache(size),
+	}
+}
+
+// Stats gets statistics of the cache
+func (ct *CachedTable) Stats() CacheStats {
+	return ct.cache.getStats()
+}
+
+// HasItem .
+func (ct *CachedTable) HasItem(did DID) bool {
+	ct.lock.RLock()
+	defer ct.lock.RUnlock()
+	if v, ok := ct.cache.get(string(did)); ok {
+		return v.(*cachedEntry).exist
+	}
+	exist := ct.Table.HasItem(did)
+	ct.cache.add(string(did), &cachedEntry{exist: exist})
+	return exist
+}
+
+// GetItem .
+func (ct *CachedTable) GetItem(did DID, typ DIDType) (TableItem, error) {
+	ct.lock.RLock()
+	defer ct.lock.RUnlock()
+	if v, ok := ct.cache.get(string(did)); ok {
+		entry := v.(*cachedEntry)
+		if entry.value != nil {
+			if item, ok := cloneItem(entry.value.(TableItem)); ok {
+				return item, nil
+			}
+		}
+	}
+	item, err := ct.Table.GetItem(did, typ)
+	if err != nil {
+		return nil, err
+	}
+	if cloned, ok := cloneItem(item); ok {
+		ct.cache.add(string(did), &cachedEntry{exist: true, value: cloned})
+	}
+	return item, nil
+}
+
+// CreateItem .
+func (ct *CachedTable) CreateItem(item TableItem) error {
+	ct.lock.Lock()
+	defer ct.lock.Unlock()
+	err := ct.Table.CreateItem(item)
+	ct.refill(item, err)
+	return err
+}
+
+// UpdateItem .
+func (ct *CachedTable) UpdateItem(item TableItem) error {
+	ct.lock.Lock()
+	defer ct.lock.Unlock()
+	err := ct.Table.UpdateItem(item)
+	ct.refill(item, err)
+	return err
+}
+
+func (ct *CachedTable) refill(item TableItem, err error) {
+	cloned, ok := cloneItem(item)
+	if err != nil || !ok {
+		ct.cache.remove(string(item.GetID()))
+		return
+	}
+	ct.cache.add(string(item.GetID()), &cachedEntry{exist: true, value: cloned})
+}
+
+// DeleteItem .
+func (ct *CachedTable) DeleteItem(did DID) {
+	ct.lock.Lock()
+	defer ct.lock.Unlock()
+	ct.Table.DeleteItem(did)
+	ct.cache.add(string(did), &cachedEntry{exist: false})
+}
+
+// Close .
+func (ct *CachedTable) Close() error {
+	return ct.Table.Close()
+}
+
+func (ct *CachedTable) backingStore() storage.Storage {
+	return backingStore(ct.Table)
+}
+
+func (ct *CachedTable) decorated() RegistryTable {
+	return ct.Table
+}
+
+var _ DocDB = (*CachedDocDB)(nil)
+
+// CachedDocDB is a read-through DocDB decorator with a LRU cache,
+// docs are cloned in and out of the cache.
+type CachedDocDB struct {
+	Docdb DocDB
+	cache *lruCache
+	lock  sync.RWMutex // serializes writes against cache fills
+}
+
+// NewCachedDocDB wraps docdb d with a cache of size entries
+func NewCachedDocDB(d DocDB, size int) *CachedDocDB {
+	return &CachedDocDB{
+		Docdb: d,
+		cache: newLRUCache(size),
+	}
+}
+
+// Stats gets statistics of the cache
+func (cd *CachedDocDB) Stats() CacheStats {
+	return cd.cache.getStats()
+}
+
+// Has .
+func (cd *CachedDocDB) Has(did DID) bool {
+	cd.lock.RLock()
+	defer cd.lock.RUnlock()
+	if v, ok := cd.cache.get(string(did)); ok {
+		return v.(*cachedEntry).exist
+	}
+	exist := cd.Docdb.Has(did)
+	cd.cache.add(string(did), &cachedEntry{exist: exist})
+	return exist
+}
+
+// Get .
+func (cd *CachedDocDB) Get(did DID, typ DIDType) (Doc, error) {
+	cd.lock.RLock()
+	defer cd.lock.RUnlock()
+	if v, ok := cd.cache.get(string(did)); ok {
+		entry := v.(*cachedEntry)
+		if entry.value != nil {
+			if doc, ok := cloneDoc(entry.value.(Doc)); ok {
+				return doc, nil
+			}
+		}
+	}
+	doc, err := cd.Docdb.Get(did, typ)
+	if err != nil {
+		return nil, err
+	}
+	if cloned, ok := cloneDoc(doc); ok {
+		cd.cache.add(string(did), &cachedEntry{exist: true, value: cloned})
+	}
+	return doc, nil
+}
+
+// Create .
+func (cd *CachedDocDB) Create(doc Doc) (string, error) {
+	cd.lock.Lock()
+	defer cd.lock.Unlock()
+	addr, err := cd.Docdb.Create(doc)
+	cd.refill(doc, err)
+	return addr, err
+}
+
+// Update .
+func (cd *CachedDocDB) Update(doc Doc) (string, error) {
+	cd.lock.Lock()
+	defer cd.lock.Unlock()
+	addr, err := cd.Docdb.Update(doc)
+	cd.refill(doc, err)
+	return addr, err
+}
+
+func (cd *CachedDocDB) refill(doc Doc, err error) {
+	cloned, ok := cloneDoc(doc)
+	if err != nil || !ok {
+		cd.cache.remove(string(doc.GetID()))
+		return
+	}
+	cd.cache.add(string(doc.GetID()), &cachedEntry{exist: true, value: cloned})
+}
+
+// Delete .
+func (cd *CachedDocDB) Delete(did DID) {
+	cd.lock.Lock()
+	defer cd.lock.Unlock()
+	cd.Docdb.Delete(did)
+	cd.cache.add(string(did), &cachedEntry{exist: false})
+}
+
+// Close .
+func (cd *CachedDocDB) Close() error {
+	return cd.Docdb.Close()
+}
+
+func (cd *CachedDocDB) backingStore() storage.Storage {
+	return backingStore(cd.Docdb)
+}
+
+// cloneItem deep copies known table items
+func cloneItem(item TableItem) (TableItem, bool) {
+	switch it := item.(type) {
+	case *ChainItem:
+		return &ChainItem{BasicItem: cloneBasicItem(it.BasicItem), Owner: it.Owner}, true
+	case *AccountItem:
+		return &AccountItem{BasicItem: cloneBasicItem(it.BasicItem)}, true
+	default:
+		return nil, false
+	}
+}
+
+func cloneBasicItem(bi BasicItem) BasicItem {
+	bi.DocHash = cloneBytes(bi.DocHash)
+	if bi.Decisions != nil {
+		decisions := make([]Decision, len(bi.Decisions))
+		for i, d := range bi.Decisions {
+			if d.Reason.Evidence != nil {
+				d.Reason.Evidence = append([]string{}, d.Reason.Evidence...)
+			}
+			decisions[i] = d
+		}
+		bi.Decisions = decisions
+	}
+	return bi
+}
+
+// cloneDoc deep copies known docs
+func cloneDoc(doc Doc) (Doc, bool) {
+	switch d := doc.(type) {
+	case *ChainDoc:
+		return &ChainDoc{BasicDoc: cloneBasicDoc(d.BasicDoc), Extra: cloneBytes(d.Extra)}, true
+	case *AccountDoc:
+		return &AccountDoc{BasicDoc: cloneBasicDoc(d.BasicDoc), Service: d.Service}, true
+	default:
+		return nil, false
+	}
+}
+
+func cloneBasicDoc(bd BasicDoc) BasicDoc {
+	if bd.PublicKey != nil {
+		bd.PublicKey = append([]PubKey{}, bd.PublicKey...)
+	}
+	if bd.Authentication != nil {
+		auths := make([]Auth, len(bd.Authentication))
+		for i, auth := range bd.Authentication {
+			auths[i] = Auth{Strategy: auth.Strategy}
+			if auth.PublicKey != nil {
+				auths[i].PublicKey = append([]string{}, auth.PublicKey...)
+			}
+		}
+		bd.Authentication = auths
+	}
+	bd.NextKeyCommitment = cloneBytes(bd.NextKeyCommitment)
+	if bd.RevokedKeys != nil {
+		bd.RevokedKeys = append([]RevokedKey{}, bd.RevokedKeys...)
+	}
+	return bd
+}
+
+func cloneBytes(b []byte) []byte {
+	if b == nil {
+		return nil
+	}
+	return append([]byte{}, b...)
+}
@@ -0,0 +1,143 @@
+package bitxid
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLRUCache(t *testing.T) {
+	c := newLRUCache(2)
+	c.add("a", 1)
+	c.add("b", 2)
+	_, ok := c.get("a")
+	assert.True(t, ok)
+	c.add("c", 3) // evicts b
+	_, ok = c.get("b")
+	assert.False(t, ok)
+	v, ok := c.get("c")
+	assert.True(t, ok)
+	assert.Equal(t, 3, v)
+	c.remove("c")
+	_, ok = c.get("c")
+	assert.False(t, ok)
+	assert.Equal(t, CacheStats{Hits: 2, Misses: 2, Evictions: 1, Size: 1}, c.getStats())
+}
+
+func TestCachedTable(t *testing.T) {
+	s, dir := newTestStorage(t, "cached.table")
+	defer os.RemoveAll(dir)
+	rt, err := NewKVTable(s)
+	assert.Nil(t, err)
+	ct := NewCachedTable(rt, 16)
+
+	assert.False(t, ct.HasItem(chainDID)) // cached as absent
+	assert.False(t, ct.HasItem(chainDID))
+	item := &ChainItem{BasicItem{ID: chainDID, DocHash: []byte{1}, Status: Normal}, mcaller}
+	assert.Nil(t, ct.CreateItem(item))
+	assert.True(t, ct.HasItem(chainDID))
+
+	got, err := ct.GetItem(chainDID, ChainDIDType)
+	assert.Nil(t, err)
+	assert.Equal(t, item, got)
+	// returned items do not alias the cache
+	got.(*ChainItem).Status = Frozen
+	got.(*ChainItem).DocHash[0] = 2
+	got, err = ct.GetItem(chainDID, ChainDIDType)
+	assert.Nil(t, err)
+	assert.Equal(t, item, got)
+
+	item.Status = Frozen
+	assert.Nil(t, ct.UpdateItem(item))
+	got, err = ct.GetItem(chainDID, ChainDIDType)
+	assert.Nil(t, err)
+	assert.Equal(t, Frozen, got.(*ChainItem).Status)
+
+	ct.DeleteItem(chainDID)
+	assert.False(t, ct.HasItem(chainDID))
+	_, err = ct.GetItem(chainDID, ChainDIDType)
+	assert.NotNil(t, err)
+
+	stats := ct.Stats()
+	assert.Equal(t, uint64(7), stats.Hits)
+	assert.Equal(t, uint64(1), stats.Misses)
+}
+
+func TestCachedDocDB(t *testing.T) {
+	s, dir := newTestStorage(t, "cached.docdb")
+	defer os.RemoveAll(dir)
+	db, err := NewKVDocDB(s)
+	assert.Nil(t, err)
+	cd := NewCachedDocDB(db, 16)
+
+	docA := mdocA
+	_, err = cd.Create(&docA)
+	assert.Nil(t, err)
+	doc, err := cd.Get(docA.ID, ChainDIDType)
+	assert.Nil(t, err)
+	assert.Equal(t, &mdocA, doc)
+	doc.(*ChainDoc).PublicKey[0].ID = "changed"
+	doc, err = cd.Get(docA.ID, ChainDIDType)
+	assert.Nil(t, err)
+	assert.Equal(t, &mdocA, doc)
+
+	docB := mdocB
+	docB.ID = docA.ID
+	_, err = cd.Update(&docB)
+	assert.Nil(t, err)
+	doc, err = cd.Get(docA.ID, ChainDIDType)
+	assert.Nil(t, err)
+	assert.Equal(t, &docB, doc)
+
+	cd.Delete(docA.ID)
+	assert.False(t, cd.Has(docA.ID))
+	assert.Equal(t, uint64(4), cd.Stats().Hits)
+}
+
+func TestChainDIDWithCache(t *testing.T) {
+	mr, tablePath, docdbPath := newChainDIDModeInternal(t)
+	defer os.RemoveAll(tablePath)
+	defer os.RemoveAll(docdbPath)
+	mr.Table = NewCachedTable(mr.Table, DefaultCacheSize)
+	mr.Docdb = NewCachedDocDB(mr.Docdb, DefaultCacheSize)
+
+	testChainDIDSetupGenesSucceed(t, mr)
+	testChainDIDAddAdminsSucceed(t, mr)
+	testChainDIDApplySucceed(t, mr)
+	testChainDIDAuditApplySucceed(t, mr)
+	testChainDIDRegisterSucceedInternal(t, mr)
+	testChainDIDUpdateSucceedInternal(t, mr)
+	testChainDIDResolveSucceedInternal(t, mr)
+}
+
+func benchmarkChainDIDResolve(b *testing.B, cached bool) {
+	t := &testing.T{}
+	mr, tablePath, docdbPath := newChainDIDModeInternal(t)
+	defer os.RemoveAll(tablePath)
+	defer os.RemoveAll(docdbPath)
+	if cached {
+		mr.Table = NewCachedTable(mr.Table, DefaultCacheSize)
+		mr.Docdb = NewCachedDocDB(mr.Docdb, DefaultCacheSize)
+	}
+	testChainDIDSetupGenesSucceed(t, mr)
+	testChainDIDAddAdminsSucceed(t, mr)
+	testChainDIDApplySucceed(t, mr)
+	testChainDIDAuditApplySucceed(t, mr)
+	testChainDIDRegisterSucceedInternal(t, mr)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, _, _, err := mr.Resolve(chainDID); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkChainDIDResolve(b *testing.B) {
+	benchmarkChainDIDResolve(b, false)
+}
+
+func BenchmarkChainDIDResolveCached(b *testing.B) {
+	benchmarkChainDIDResolve(b, true)
+}
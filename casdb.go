@@ -0,0 +1,331 @@
+package bitxid
+
+import (
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CIDv1 of raw content with sha2-256 multihash:
+// varint(cid version) | varint(raw codec) | varint(sha2-256) | varint(32) | digest
+const (
+	cidVersion   = 1
+	cidRawCodec  = 0x55
+	cidSHA256    = 0x12
+	cidMultibase = 'b' // base32 lower case without padding
+)
+
+var cidEncoding = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+
+// ComputeCID computes the CID of content, its digest equals sha256(content)
+func ComputeCID(content []byte) string {
+	digest := sha256.Sum256(content)
+	return formatCID(digest[:])
+}
+
+func formatCID(digest []byte) string {
+	b := appendUvarint(nil, cidVersion)
+	b = appendUvarint(b, cidRawCodec)
+	b = appendUvarint(b, cidSHA256)
+	b = appendUvarint(b, uint64(len(digest)))
+	b = append(b, digest...)
+	return string(cidMultibase) + cidEncoding.EncodeToString(b)
+}
+
+// ParseCID parses a CID made by ComputeCID and returns its sha256 digest
+func ParseCID(cid string) ([]byte, error) {
+	if len(cid) < 2 || cid[0] != cidMultibase {
+		return nil, &InvalidFormatError{What: "cid", Reason: "unsupported multibase " + cid}
+	}
+	b, err := cidEncoding.DecodeString(cid[1:])
+	if err != nil {
+		return nil, &InvalidFormatError{What: "cid", Reason: cid, Err: err}
+	}
+	for _, expected := range []uint64{cidVersion, cidRawCodec, cidSHA256, sha256.Size} {
+		v, n := binary.Uvarint(b)
+		if n <= 0 || v != expected {
+			return nil, &InvalidFormatError{What: "cid", Reason: "unsupported prefix " + cid}
+		}
+		b = b[n:]
+	}
+	if len(b) != sha256.Size {
+		return nil, &InvalidFormatError{What: "cid", Reason: fmt.Sprintf("wrong digest length %d of %s", len(b), cid)}
+	}
+	return b, nil
+}
+
+// DocVersion represents a stored version of a doc
+type DocVersion struct {
+	CID     string    `json:"cid"`
+	Codec   CodecType `json:"codec"`  // codec of the content
+	Schema  uint8     `json:"schema"` // schema version of the content
+	Created int64     `json:"created"`
+}
+
+var _ DocDB = (*CASDocDB)(nil)
+
+// CASDocDB is a content addressed DocDB in a local directory.
+// Doc contents are stored once under blobs/ by their CID,
+// which is also the hash of the doc computed by HashDoc,
+// and versions of every doc are kept under index/.
+type CASDocDB struct {
+	Dir      string
+	Codec    Codec
+	Migrator *Migrator // upgrades old docs on read if set
+	lock     sync.RWMutex
+}
+
+// NewCASDocDB .
+func NewCASDocDB(dir string) (*CASDocDB, error) {
+	for _, sub := range []string{"blobs", "index"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0755); err != nil {
+			return nil, fmt.Errorf("casdb mkdir: %w", err)
+		}
+	}
+	return &CASDocDB{
+		Dir:   dir,
+		Codec: DefaultCodec(),
+	}, nil
+}
+
+// SetCodec sets the codec used to encode docs
+func (d *CASDocDB) SetCodec(c Codec) {
+	d.Codec = c
+}
+
+// SetMigrator sets the migrator used to upgrade docs on read
+func (d *CASDocDB) SetMigrator(m *Migrator) {
+	d.Migrator = m
+}
+
+func (d *CASDocDB) blobPath(cid string) string {
+	return filepath.Join(d.Dir, "blobs", cid)
+}
+
+func (d *CASDocDB) indexPath(did DID) string {
+	return filepath.Join(d.Dir, "index", hex.EncodeToString([]byte(did)))
+}
+
+// Has .
+func (d *CASDocDB) Has(did DID) bool {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+	_, err := os.Stat(d.indexPath(did))
+	return err == nil
+}
+
+// Create stores the doc and returns its CID
+func (d *CASDocDB) Create(doc Doc) (string, error) {
+	did := doc.GetID()
+	if did == DID("") {
+		return "", &InvalidFormatError{What: "casdb doc", Reason: "id is null"}
+	}
+	if d.Has(did) {
+		return "", &AlreadyExistsError{ID: string(did), Store: "casdb"}
+	}
+	return d.put(doc)
+}
+
+// Update stores a new version of the doc and returns its CID,
+// former versions are kept.
+func (d *CASDocDB) Update(doc Doc) (string, error) {
+	did := doc.GetID()
+	if did == DID("") {
+		return "", &InvalidFormatError{What: "casdb doc", Reason: "id is null"}
+	}
+	if !d.Has(did) {
+		return "", &NotFoundError{ID: string(did), Store: "casdb"}
+	}
+	return d.put(doc)
+}
+
+func (d *CASDocDB) put(doc Doc) (string, error) {
+	content, err := d.Codec.Marshal(doc)
+	if err != nil {
+		return "", fmt.Errorf("casdb marshal doc: %w", err)
+	}
+	cid := ComputeCID(content)
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	// identical contents are stored only once
+	if _, err := os.Stat(d.blobPath(cid)); os.IsNotExist(err) {
+		if err := writeFileAtomic(d.blobPath(cid), content); err != nil {
+			return "", fmt.Errorf("casdb write blob: %w", err)
+		}
+	}
+	versions, err := d.versions(doc.GetID())
+	if err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+	if len(versions) != 0 && versions[len(versions)-1].CID == cid {
+		return cid, nil
+	}
+	versions = append(versions, DocVersion{
+		CID:     cid,
+		Codec:   d.Codec.Type(),
+		Schema:  CurrentSchemaVersion,
+		Created: time.Now().Unix(),
+	})
+	data, err := json.Marshal(versions)
+	if err != nil {
+		return "", fmt.Errorf("casdb marshal index: %w", err)
+	}
+	if err := writeFileAtomic(d.indexPath(doc.GetID()), data); err != nil {
+		return "", fmt.Errorf("casdb write index: %w", err)
+	}
+	return cid, nil
+}
+
+// Get gets the latest version of a doc
+func (d *CASDocDB) Get(did DID, typ DIDType) (Doc, error) {
+	versions, err := d.Versions(did)
+	if err != nil {
+		return nil, err
+	}
+	return d.getVersion(versions[len(versions)-1], typ)
+}
+
+// GetVersion gets the version of a doc with the given CID
+func (d *CASDocDB) GetVersion(did DID, cid string, typ DIDType) (Doc, error) {
+	versions, err := d.Versions(did)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range versions {
+		if v.CID == cid {
+			return d.getVersion(v, typ)
+		}
+	}
+	return nil, &NotFoundError{ID: string(did) + "@" + cid, Store: "casdb"}
+}
+
+// Versions lists versions of a doc from the oldest to the latest
+func (d *CASDocDB) Versions(did DID) ([]DocVersion, error) {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+	versions, err := d.versions(did)
+	if os.IsNotExist(err) {
+		return nil, &NotFoundError{ID: string(did), Store: "casdb"}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(versions) == 0 {
+		return nil, fmt.Errorf("casdb doc %s has no version", did)
+	}
+	return versions, nil
+}
+
+func (d *CASDocDB) versions(did DID) ([]DocVersion, error) {
+	data, err := ioutil.ReadFile(d.indexPath(did))
+	if err != nil {
+		return nil, err
+	}
+	versions := []DocVersion{}
+	if err := json.Unmarshal(data, &versions); err != nil {
+		return nil, fmt.Errorf("casdb unmarshal index: %w", err)
+	}
+	return versions, nil
+}
+
+// Blob gets the content addressed by cid, the content is verified against cid
+func (d *CASDocDB) Blob(cid string) ([]byte, error) {
+	if strings.ContainsAny(cid, `/\`) {
+		return nil, &InvalidFormatError{What: "cid", Reason: cid}
+	}
+	d.lock.RLock()
+	content, err := ioutil.ReadFile(d.blobPath(cid))
+	d.lock.RUnlock()
+	if os.IsNotExist(err) {
+		return nil, &NotFoundError{ID: cid, Store: "casdb"}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("casdb read blob: %w", err)
+	}
+	if ComputeCID(content) != cid {
+		return nil, &InvalidFormatError{What: "casdb blob", Reason: cid + " is corrupted"}
+	}
+	return content, nil
+}
+
+func (d *CASDocDB) getVersion(v DocVersion, typ DIDType) (Doc, error) {
+	content, err := d.Blob(v.CID)
+	if err != nil {
+		return nil, err
+	}
+	c, err := GetCodec(v.Codec)
+	if err != nil {
+		return nil, err
+	}
+	record := joinRecord(c, v.Schema, content)
+	if d.Migrator != nil {
+		// upgraded docs are not written back, which would change their CIDs
+		record, _, err = d.Migrator.Upgrade(docRecordKind(typ), record)
+		if err != nil {
+			return nil, fmt.Errorf("casdb migrate doc: %w", err)
+		}
+	}
+	doc, err := newDoc(typ)
+	if err != nil {
+		return nil, fmt.Errorf("casdb: %w", err)
+	}
+	if err := decodeRecord(record, doc); err != nil {
+		return nil, fmt.Errorf("casdb unmarshal doc: %w", err)
+	}
+	return doc, nil
+}
+
+// Delete deletes the index of a doc, blobs are kept
+// since they may be shared with other docs.
+func (d *CASDocDB) Delete(did DID) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	os.Remove(d.indexPath(did))
+}
+
+// Close .
+func (d *CASDocDB) Close() error {
+	return nil
+}
+
+func newDoc(typ DIDType) (Doc, error) {
+	switch typ {
+	case AccountDIDType:
+		return &AccountDoc{}, nil
+	case ChainDIDType:
+		return &ChainDoc{}, nil
+	default:
+		return nil, &InvalidFormatError{What: "doc type", Reason: fmt.Sprintf("unknown type %d", typ)}
+	}
+}
+
+// writeFileAtomic writes data to a temp file and renames it to path
+func writeFileAtomic(path string, data []byte) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), ".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
@@ -0,0 +1,115 @@
+package bitxid
+
+import (
+	"crypto/sha256"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCID(t *testing.T) {
+	// well known CIDv1 of empty raw content
+	assert.Equal(t, "bafkreihdwdcefgh4dqkjv67uzcmw7ojee6xedzdetojuzjevtenxquvyku", ComputeCID([]byte{}))
+
+	cid := ComputeCID([]byte("bitxid"))
+	digest, err := ParseCID(cid)
+	assert.Nil(t, err)
+	sum := sha256.Sum256([]byte("bitxid"))
+	assert.Equal(t, sum[:], digest)
+
+	_, err = ParseCID("z" + cid[1:])
+	assert.NotNil(t, err)
+	_, err = ParseCID(cid[:len(cid)-2])
+	assert.NotNil(t, err)
+}
+
+func TestCASDocDB(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cas.docdb")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	db, err := NewCASDocDB(dir)
+	assert.Nil(t, err)
+
+	docA := mdocA
+	cidA, err := db.Create(&docA)
+	assert.Nil(t, err)
+	_, err = db.Create(&docA)
+	assert.NotNil(t, err)
+	hash, err := HashDoc(db.Codec, &docA)
+	assert.Nil(t, err)
+	digest, err := ParseCID(cidA)
+	assert.Nil(t, err)
+	assert.Equal(t, hash, digest)
+
+	docB := mdocB
+	docB.ID = docA.ID
+	cidB, err := db.Update(&docB)
+	assert.Nil(t, err)
+	cid, err := db.Update(&docB) // unchanged doc makes no new version
+	assert.Nil(t, err)
+	assert.Equal(t, cidB, cid)
+
+	versions, err := db.Versions(docA.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(versions))
+	assert.Equal(t, cidA, versions[0].CID)
+	assert.Equal(t, cidB, versions[1].CID)
+
+	doc, err := db.Get(docA.ID, ChainDIDType)
+	assert.Nil(t, err)
+	assert.Equal(t, &docB, doc)
+	doc, err = db.GetVersion(docA.ID, cidA, ChainDIDType)
+	assert.Nil(t, err)
+	assert.Equal(t, &docA, doc)
+
+	// identical docs share the blob
+	blobs, err := ioutil.ReadDir(dir + "/blobs")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(blobs))
+
+	// corrupted blobs are detected
+	err = ioutil.WriteFile(db.blobPath(cidB), []byte("corrupted"), 0644)
+	assert.Nil(t, err)
+	_, err = db.Get(docA.ID, ChainDIDType)
+	assert.NotNil(t, err)
+
+	db.Delete(docA.ID)
+	assert.False(t, db.Has(docA.ID))
+	_, err = db.Get(docA.ID, ChainDIDType)
+	assert.NotNil(t, err)
+}
+
+func TestChainDIDWithCASDocDB(t *testing.T) {
+	s, tablePath := newTestStorage(t, "chainDID.table")
+	defer os.RemoveAll(tablePath)
+	dir, err := ioutil.TempDir("", "cas.docdb")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	db, err := NewCASDocDB(dir)
+	assert.Nil(t, err)
+
+	loggerInit()
+	mr, err := NewChainDIDRegistry(s, loggerGet(loggerChainDID),
+		WithGenesisChainDocContent(&mdoc),
+		WithAdmin(superAdmin),
+		WithChainDocDB(db),
+		WithChainCodec(&JSONCodec{}))
+	assert.Nil(t, err)
+	testChainDIDSetupGenesSucceed(t, mr)
+	testChainDIDAddAdminsSucceed(t, mr)
+	testChainDIDApplySucceed(t, mr)
+	testChainDIDAuditApplySucceed(t, mr)
+
+	docAddr, docHash, err := mr.RegisterWithDoc(&mdocA)
+	assert.Nil(t, err)
+	digest, err := ParseCID(docAddr)
+	assert.Nil(t, err)
+	assert.Equal(t, docHash, digest)
+
+	item, doc, _, err := mr.Resolve(chainDID)
+	assert.Nil(t, err)
+	assert.Equal(t, docAddr, item.DocAddr)
+	assert.Equal(t, &mdocA, doc)
+}
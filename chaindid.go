@@ -1,7 +1,7 @@
 package bitxid
 
 import (
-	"crypto/sha256"
+	"context"
 	"fmt"
 
 	"github.com/meshplus/bitxhub-kit/storage"
@@ -13,8 +13,8 @@ var _ Doc = (*ChainDoc)(nil)
 
 // ChainDoc represents chain identity information
 type ChainDoc struct {
-	BasicDoc
-	Extra []byte `json:"extra"` // for further usage
+	BasicDoc `pb:"1"`
+	Extra    []byte `json:"extra" pb:"2"` // for further usage
 }
 
 // Marshal marshals chain doc
@@ -51,8 +51,8 @@ var _ TableItem = (*ChainItem)(nil)
 // it stores all data about a did.
 // Registry table is used together with docdb.
 type ChainItem struct {
-	BasicItem
-	Owner DID // owner of the chain did, is a did, TODO: owner ==> owners
+	BasicItem `pb:"1"`
+	Owner     DID `json:"owner" pb:"2"` // owner of the chain did, is a did, TODO: owner ==> owners
 }
 
 // Marshal marshals chain item
@@ -71,17 +71,30 @@ func (mi *ChainItem) GetID() DID {
 }
 
 var _ ChainDIDManager = (*ChainDIDRegistry)(nil)
+var _ ChainDIDManagerContext = (*ChainDIDRegistry)(nil)
+var _ ChainDIDResolver = (*ChainDIDRegistry)(nil)
 
 // ChainDIDRegistry .
 type ChainDIDRegistry struct {
 	Mode                   RegistryMode  `json:"mode"`
-	IsRoot                 bool          `json:"is_root"`
-	Admins                 []DID         `json:"admins"`
+	IsRoot                 bool          `json:"is_root"`               // root of a hierarchy of registries, it delegates namespaces
+	RootSigner             string        `json:"root_signer,omitempty"` // address of the key of the root signing delegations
+	Delegation             *Delegation   `json:"delegation,omitempty"`  // authorizes the registry if it is a subordinate
+	Delegations            []*Delegation `json:"delegations,omitempty"` // delegations issued by the root
+	AdminSet                             // admins and the policy of changing them
 	Table                  RegistryTable `json:"table"`
 	Docdb                  DocDB         `json:"docdb"`
 	GenesisChainDID        DID           `json:"genesis_chain_did"`
 	GenesisChainDocInfo    DocInfo       `json:"genesis_chain_doc_info"`
 	GenesisChainDocContent Doc           `json:"genesis_chain_doc_content"`
+	Codec                  Codec         `json:"codec"`
+	Migrator               *Migrator     `json:"-"`
+	Fetcher                DocFetcher    `json:"-"` // fetches docs under ExternalDocDB mode
+	Events                 EventSink     `json:"-"` // receives state change events if set
+	AuditLog               *AuditLog     `json:"-"` // records admin actions if set
+	Governance             *Governance   `json:"-"` // makes admin actions go through proposals if set
+	RBAC                   *RBAC         `json:"-"` // checks permissions of callers if set
+	docCache               *docCache
 	logger                 logrus.FieldLogger
 }
 
@@ -94,10 +107,12 @@ func NewChainDIDRegistry(
 	db, _ := NewKVDocDB(nil)
 	// doc := GenesisChainDoc()
 	cr := &ChainDIDRegistry{ // default config
-		Mode:   ExternalDocDB,
-		Table:  rt,
-		Docdb:  db,
-		logger: l,
+		Mode:     ExternalDocDB,
+		Table:    rt,
+		Docdb:    db,
+		Codec:    DefaultCodec(),
+		docCache: newDocCache(),
+		logger:   l,
 		// Admins: []DID{genesisAccountDoc().GetID()},
 		// IsRoot: true,
 		// GenesisChainDID: doc.GetID(),
@@ -112,6 +127,10 @@ func NewChainDIDRegistry(
 	for _, option := range options {
 		option(cr)
 	}
+	setCodec(cr.Table, cr.Codec)
+	setCodec(cr.Docdb, cr.Codec)
+	setMigrator(cr.Table, cr.Migrator)
+	setMigrator(cr.Docdb, cr.Migrator)
 
 	return cr, nil
 }
@@ -125,6 +144,112 @@ func WithChainDocStorage(ds storage.Storage) func(*ChainDIDRegistry) {
 	}
 }
 
+// WithChainDocDB used for InternalDocDB mode with a custom docdb
+func WithChainDocDB(db DocDB) func(*ChainDIDRegistry) {
+	return func(cr *ChainDIDRegistry) {
+		cr.Docdb = db
+		cr.Mode = InternalDocDB
+	}
+}
+
+// WithChainGovernance used for making admin actions go through proposals of g
+func WithChainGovernance(g *Governance) func(*ChainDIDRegistry) {
+	return func(cr *ChainDIDRegistry) {
+		cr.Governance = g
+		g.registry = cr
+	}
+}
+
+// WithChainRBAC used for checking permissions of callers by roles in rb,
+// admins of the registry have all permissions within it only
+func WithChainRBAC(rb *RBAC) func(*ChainDIDRegistry) {
+	return func(cr *ChainDIDRegistry) {
+		cr.RBAC = rb.bind(cr.GetAdmins)
+	}
+}
+
+// WithChainAuditLog used for recording admin actions to l
+func WithChainAuditLog(l *AuditLog) func(*ChainDIDRegistry) {
+	return func(cr *ChainDIDRegistry) {
+		cr.AuditLog = l
+	}
+}
+
+// WithChainChangeLog used for recording changes of chain did items to l,
+// l decorates the table of the registry which should be set before.
+func WithChainChangeLog(l *ChangeLog) func(*ChainDIDRegistry) {
+	return func(cr *ChainDIDRegistry) {
+		l.Table = cr.Table
+		cr.Table = l
+	}
+}
+
+// WithChainEventSink used for emitting state change events to sink
+func WithChainEventSink(sink EventSink) func(*ChainDIDRegistry) {
+	return func(cr *ChainDIDRegistry) {
+		cr.Events = sink
+	}
+}
+
+// WithChainDocFetcher used for fetching docs by ResolveFull under ExternalDocDB mode
+func WithChainDocFetcher(f DocFetcher) func(*ChainDIDRegistry) {
+	return func(cr *ChainDIDRegistry) {
+		cr.Fetcher = f
+	}
+}
+
+// WithChainMigrator used for lazy migration of table items and docs on read
+func WithChainMigrator(m *Migrator) func(*ChainDIDRegistry) {
+	return func(cr *ChainDIDRegistry) {
+		cr.Migrator = m
+	}
+}
+
+// WithChainCodec used for codec setup of table items and docs
+func WithChainCodec(c Codec) func(*ChainDIDRegistry) {
+	return func(cr *ChainDIDRegistry) {
+		cr.Codec = c
+	}
+}
+
+// WithChainAdminPolicy used for constraining changes of admins by p
+func WithChainAdminPolicy(p AdminPolicy) func(*ChainDIDRegistry) {
+	return func(cr *ChainDIDRegistry) {
+		cr.AdminPolicy = p
+	}
+}
+
+// WithChainSnapshot used for restoring the admin set and the position in
+// a hierarchy kept in the manifest of an imported snapshot
+func WithChainSnapshot(m *SnapshotManifest) func(*ChainDIDRegistry) {
+	return func(cr *ChainDIDRegistry) {
+		cr.AdminSet = m.adminSet()
+		cr.IsRoot = m.IsRoot
+		cr.RootSigner = m.RootSigner
+		cr.Delegation = m.Delegation
+		cr.Delegations = m.Delegations
+	}
+}
+
+// WithRootRegistry used for making the registry the root of a hierarchy,
+// signer is the address of the key signing delegations
+func WithRootRegistry(signer string) func(*ChainDIDRegistry) {
+	return func(cr *ChainDIDRegistry) {
+		cr.IsRoot = true
+		cr.RootSigner = signer
+	}
+}
+
+// WithChainDelegation used for making the registry a subordinate authorized
+// by d, rootSigner is the address of the key of the root
+func WithChainDelegation(d *Delegation, rootSigner string) func(*ChainDIDRegistry) {
+	return func(cr *ChainDIDRegistry) {
+		cr.IsRoot = false
+		cr.Delegation = d
+		cr.RootSigner = rootSigner
+	}
+}
+
 // WithAdmin used for admin setup
 func WithAdmin(a DID) func(*ChainDIDRegistry) {
 	return func(cr *ChainDIDRegistry) {
@@ -150,29 +275,41 @@ func WithGenesisChainDocContent(doc Doc) func(*ChainDIDRegistry) {
 
 // SetupGenesis set up genesis to boot the whole methed system
 func (r *ChainDIDRegistry) SetupGenesis() error {
+	return r.SetupGenesisContext(context.Background())
+}
+
+// SetupGenesisContext is SetupGenesis with context
+func (r *ChainDIDRegistry) SetupGenesisContext(ctx context.Context) error {
+	// genesis is made by the registry itself instead of proposals
+	ctx = withGovernance(ctx)
 	if r.GenesisChainDID == "" {
-		return fmt.Errorf("genesis ChainDID is null")
+		return &InvalidFormatError{What: "genesis", Reason: "genesis ChainDID is null"}
 	}
 	if len(r.Admins) == 0 {
-		return fmt.Errorf("no admins")
+		return &InvalidFormatError{What: "genesis", Reason: "no admins"}
+	}
+	if r.Delegation != nil {
+		if err := r.verifyOwnDelegation(); err != nil {
+			return fmt.Errorf("genesis delegation err: %w", err)
+		}
 	}
 	// if r.GenesisChainDID != r.GenesisChainDoc.Content.(*ChainDoc).ID {
 	// 	return fmt.Errorf("genesis ChainDID not matched with ChainDoc")
 	// }
 
 	// register chain did:
-	err := r.Apply(r.Admins[0], r.GenesisChainDID)
+	err := r.ApplyContext(ctx, r.Admins[0], r.GenesisChainDID)
 	if err != nil {
 		return fmt.Errorf("genesis apply err: %w", err)
 	}
-	err = r.AuditApply(r.GenesisChainDID, true)
+	err = r.AuditApplyContext(ctx, r.GenesisChainDID, true)
 	if err != nil {
 		return fmt.Errorf("genesis audit err: %w", err)
 	}
 	if r.Mode == ExternalDocDB {
-		_, _, err = r.Register(r.GenesisChainDocInfo.ID, r.GenesisChainDocInfo.Addr, r.GenesisChainDocInfo.Hash)
+		_, _, err = r.RegisterContext(ctx, r.GenesisChainDocInfo.ID, r.GenesisChainDocInfo.Addr, r.GenesisChainDocInfo.Hash)
 	} else {
-		_, _, err = r.RegisterWithDoc(r.GenesisChainDocContent)
+		_, _, err = r.RegisterWithDocContext(ctx, r.GenesisChainDocContent)
 	}
 	if err != nil {
 		return fmt.Errorf("genesis register err: %w", err)
@@ -193,22 +330,72 @@ func (r *ChainDIDRegistry) GetAdmins() []DID {
 
 // AddAdmin adds an admin for the registry
 func (r *ChainDIDRegistry) AddAdmin(caller DID) error {
-	if r.HasAdmin(caller) {
-		return fmt.Errorf("caller %s is already an admin", caller)
+	return r.AddAdminContext(context.Background(), caller)
+}
+
+// AddAdminContext is AddAdmin with context
+func (r *ChainDIDRegistry) AddAdminContext(ctx context.Context, caller DID) error {
+	if err := checkGoverned(ctx, r.Governance, ActionAddAdmin); err != nil {
+		return err
 	}
-	r.Admins = append(r.Admins, caller)
-	return nil
+	if err := checkPermission(ctx, r.RBAC, PermAdmin); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return r.change(ctx, r.AuditLog, ActionAddAdmin, caller)
 }
 
 // RemoveAdmin removes an admin for the registry
 func (r *ChainDIDRegistry) RemoveAdmin(caller DID) error {
-	for i, admin := range r.Admins {
-		if admin == caller {
-			r.Admins = append(r.Admins[:i], r.Admins[i+1:]...)
-			return nil
-		}
+	return r.RemoveAdminContext(context.Background(), caller)
+}
+
+// RemoveAdminContext is RemoveAdmin with context
+func (r *ChainDIDRegistry) RemoveAdminContext(ctx context.Context, caller DID) error {
+	if err := checkGoverned(ctx, r.Governance, ActionRemoveAdmin); err != nil {
+		return err
+	}
+	if err := checkPermission(ctx, r.RBAC, PermAdmin); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return r.change(ctx, r.AuditLog, ActionRemoveAdmin, caller)
+}
+
+// ApplyAdminChanges applies admin changes whose timelock has passed
+func (r *ChainDIDRegistry) ApplyAdminChanges() ([]*AdminChange, error) {
+	return r.ApplyAdminChangesContext(context.Background())
+}
+
+// ApplyAdminChangesContext is ApplyAdminChanges with context
+func (r *ChainDIDRegistry) ApplyAdminChangesContext(ctx context.Context) ([]*AdminChange, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return r.applyDue(ctx, r.AuditLog)
+}
+
+// CancelAdminChange cancels the pending change of admin a during its timelock
+func (r *ChainDIDRegistry) CancelAdminChange(a DID) error {
+	return r.CancelAdminChangeContext(context.Background(), a)
+}
+
+// CancelAdminChangeContext is CancelAdminChange with context
+func (r *ChainDIDRegistry) CancelAdminChangeContext(ctx context.Context, a DID) error {
+	if err := checkGoverned(ctx, r.Governance, ActionCancelAdminChange); err != nil {
+		return err
+	}
+	if err := checkPermission(ctx, r.RBAC, PermAdmin); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
 	}
-	return fmt.Errorf("caller %s is not an admin", caller)
+	return r.cancel(ctx, r.AuditLog, a)
 }
 
 // HasAdmin checks whether caller is an admin of the registry
@@ -221,19 +408,71 @@ func (r *ChainDIDRegistry) HasAdmin(caller DID) bool {
 	return false
 }
 
+// GrantRole grants role to did, RBAC should be set
+func (r *ChainDIDRegistry) GrantRole(did DID, role Role) error {
+	return r.GrantRoleContext(context.Background(), did, role)
+}
+
+// GrantRoleContext is GrantRole with context
+func (r *ChainDIDRegistry) GrantRoleContext(ctx context.Context, did DID, role Role) error {
+	if err := checkGoverned(ctx, r.Governance, ActionGrantRole); err != nil {
+		return err
+	}
+	if err := checkPermission(ctx, r.RBAC, PermAdmin); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return grantRole(ctx, r.RBAC, r.AuditLog, ActionGrantRole, did, role)
+}
+
+// RevokeRole revokes role of did, RBAC should be set
+func (r *ChainDIDRegistry) RevokeRole(did DID, role Role) error {
+	return r.RevokeRoleContext(context.Background(), did, role)
+}
+
+// RevokeRoleContext is RevokeRole with context
+func (r *ChainDIDRegistry) RevokeRoleContext(ctx context.Context, did DID, role Role) error {
+	if err := checkGoverned(ctx, r.Governance, ActionRevokeRole); err != nil {
+		return err
+	}
+	if err := checkPermission(ctx, r.RBAC, PermAdmin); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return grantRole(ctx, r.RBAC, r.AuditLog, ActionRevokeRole, did, role)
+}
+
 // Apply apply for rights of a new methd-name
 func (r *ChainDIDRegistry) Apply(caller DID, chainDID DID) error {
+	return r.ApplyContext(context.Background(), caller, chainDID)
+}
+
+// ApplyContext is Apply with context
+func (r *ChainDIDRegistry) ApplyContext(ctx context.Context, caller DID, chainDID DID) error {
+	if err := checkSelfOrPermission(ctx, r.RBAC, caller, PermRegister); err != nil {
+		return err
+	}
 	// check if ChainDID Name meets standard
 	if !chainDID.IsValidFormat() {
-		return fmt.Errorf("chain did is not standard")
+		return &InvalidFormatError{What: "chain did", Reason: string(chainDID)}
+	}
+	if err := r.checkNamespace(caller, chainDID); err != nil {
+		return err
 	}
 
-	status := r.getChainDIDStatus(chainDID)
+	status, err := r.getChainDIDStatus(ctx, chainDID)
+	if err != nil {
+		return err
+	}
 	if status != Initial {
-		return fmt.Errorf("can not apply %s under status: %s", chainDID, status)
+		return &InvalidStatusError{ID: chainDID, Op: "apply", Current: status, Expected: []StatusType{Initial}}
 	}
 	// creates item in table
-	err := r.Table.CreateItem(
+	err = r.table().CreateItemContext(ctx,
 		&ChainItem{
 			BasicItem{
 				ID:     chainDID,
@@ -242,65 +481,121 @@ func (r *ChainDIDRegistry) Apply(caller DID, chainDID DID) error {
 	if err != nil {
 		return fmt.Errorf("apply %s on table: %w", chainDID, err)
 	}
-	return nil
+	return r.emit(ctx, EventApplied, chainDID, ApplyAudit)
 }
 
 // AuditApply audits status of a chain did application
 // ATNS: only admin should call this.
 func (r *ChainDIDRegistry) AuditApply(chainDID DID, result bool) error {
-	exist := r.HasChainDID(chainDID)
+	return r.AuditApplyContext(context.Background(), chainDID, result)
+}
+
+// AuditApplyContext is AuditApply with context
+func (r *ChainDIDRegistry) AuditApplyContext(ctx context.Context, chainDID DID, result bool) error {
+	if err := checkGoverned(ctx, r.Governance, ActionAuditApply); err != nil {
+		return err
+	}
+	if err := checkPermission(ctx, r.RBAC, PermAudit); err != nil {
+		return err
+	}
+	exist, err := r.HasChainDIDContext(ctx, chainDID)
+	if err != nil {
+		return err
+	}
 	if !exist {
-		return fmt.Errorf("auditapply %s not existed", chainDID)
+		return &NotFoundError{ID: string(chainDID)}
+	}
+	status, err := r.getChainDIDStatus(ctx, chainDID)
+	if err != nil {
+		return err
 	}
-	status := r.getChainDIDStatus(chainDID)
 	if !(status == ApplyAudit || status == ApplyFailed) {
-		return fmt.Errorf("can not auditapply %s under status: %s", chainDID, status)
+		return &InvalidStatusError{ID: chainDID, Op: "auditapply", Current: status, Expected: []StatusType{ApplyAudit, ApplyFailed}}
 	}
-	var err error
+	status = ApplyFailed
 	if result {
-		err = r.auditStatus(chainDID, ApplySuccess)
-	} else {
-		err = r.auditStatus(chainDID, ApplyFailed)
+		status = ApplySuccess
 	}
-	return err
+	return r.auditStatus(ctx, ActionAuditApply, EventApplyAudited, chainDID, status)
+}
+
+// AuditApplyWithReason is AuditApply recording why the application is approved or rejected
+func (r *ChainDIDRegistry) AuditApplyWithReason(chainDID DID, result bool, reason Reason) error {
+	return r.AuditApplyContext(ContextWithReason(context.Background(), reason), chainDID, result)
 }
 
 // Synchronize synchronizes table data between different registrys
 func (r *ChainDIDRegistry) Synchronize(item TableItem) error {
-	return r.Table.CreateItem(item)
+	return r.SynchronizeContext(context.Background(), item)
+}
+
+// SynchronizeContext is Synchronize with context
+func (r *ChainDIDRegistry) SynchronizeContext(ctx context.Context, item TableItem) error {
+	if r.RootSigner != "" {
+		// registries under a hierarchy only accept delegated items
+		ci, err := r.checkDelegated(item)
+		if err != nil {
+			return err
+		}
+		item = ci
+	}
+	return r.table().CreateItemContext(ctx, item)
 }
 
 // Register ties chain did to a chain doc
 // ATN: only did who owns method-name should call this
 func (r *ChainDIDRegistry) Register(chainDID DID, addr string, hash []byte) (string, []byte, error) {
-	return r.updateByStatus(chainDID, addr, hash, nil, ApplySuccess)
+	return r.RegisterContext(context.Background(), chainDID, addr, hash)
+}
+
+// RegisterContext is Register with context
+func (r *ChainDIDRegistry) RegisterContext(ctx context.Context, chainDID DID, addr string, hash []byte) (string, []byte, error) {
+	return r.updateByStatus(ctx, chainDID, addr, hash, nil, ApplySuccess)
 }
 
 // RegisterWithDoc registers with doc
 func (r *ChainDIDRegistry) RegisterWithDoc(doc Doc) (string, []byte, error) {
-	return r.updateByStatus("", "", []byte{}, doc, ApplySuccess)
+	return r.RegisterWithDocContext(context.Background(), doc)
+}
+
+// RegisterWithDocContext is RegisterWithDoc with context
+func (r *ChainDIDRegistry) RegisterWithDocContext(ctx context.Context, doc Doc) (string, []byte, error) {
+	return r.updateByStatus(ctx, "", "", []byte{}, doc, ApplySuccess)
 }
 
 // Update updates data about a chain did
 // ATN: only did who owns method-name should call this.
 func (r *ChainDIDRegistry) Update(chainDID DID, addr string, hash []byte) (string, []byte, error) {
-	return r.updateByStatus(chainDID, addr, hash, nil, Normal)
+	return r.UpdateContext(context.Background(), chainDID, addr, hash)
+}
+
+// UpdateContext is Update with context
+func (r *ChainDIDRegistry) UpdateContext(ctx context.Context, chainDID DID, addr string, hash []byte) (string, []byte, error) {
+	return r.updateByStatus(ctx, chainDID, addr, hash, nil, Normal)
 }
 
 // UpdateWithDoc updates with doc
 func (r *ChainDIDRegistry) UpdateWithDoc(doc Doc) (string, []byte, error) {
-	return r.updateByStatus("", "", []byte{}, doc, Normal)
+	return r.UpdateWithDocContext(context.Background(), doc)
+}
+
+// UpdateWithDocContext is UpdateWithDoc with context
+func (r *ChainDIDRegistry) UpdateWithDocContext(ctx context.Context, doc Doc) (string, []byte, error) {
+	return r.updateByStatus(ctx, "", "", []byte{}, doc, Normal)
 }
 
-func (r *ChainDIDRegistry) updateByStatus(chainDID DID, docAddr string, docHash []byte, doc Doc, expectedStatus StatusType) (string, []byte, error) {
+func (r *ChainDIDRegistry) updateByStatus(ctx context.Context, chainDID DID, docAddr string, docHash []byte, doc Doc, expectedStatus StatusType) (string, []byte, error) {
+	if err := r.checkOwner(ctx, chainDID, doc); err != nil {
+		return "", nil, err
+	}
 	// update doc concerned data
-	docAddr, docHash, chainDID, err := r.updateDocdbOrNot(chainDID, docAddr, docHash, doc, expectedStatus)
+	docAddr, docHash, chainDID, err := r.updateDocdbOrNot(ctx, chainDID, docAddr, docHash, doc, expectedStatus)
 	if err != nil {
 		return "", nil, err
 	}
 
 	// update table concerned data
-	item, err := r.Table.GetItem(chainDID, ChainDIDType)
+	item, err := r.table().GetItemContext(ctx, chainDID, ChainDIDType)
 	if err != nil {
 		return docAddr, docHash, fmt.Errorf("table get item: %w ", err)
 	}
@@ -308,16 +603,24 @@ func (r *ChainDIDRegistry) updateByStatus(chainDID DID, docAddr string, docHash
 	itemM.DocAddr = docAddr
 	itemM.DocHash = docHash
 	itemM.Status = Normal
-	err = r.Table.UpdateItem(itemM)
+	err = r.table().UpdateItemContext(ctx, itemM)
 	if err != nil {
 		return docAddr, docHash, fmt.Errorf("table update item: %w ", err)
 	}
 
+	kind := EventUpdated
+	if expectedStatus == ApplySuccess {
+		kind = EventRegistered
+	}
+	if err := r.emit(ctx, kind, chainDID, Normal); err != nil {
+		return docAddr, docHash, err
+	}
 	return docAddr, docHash, nil
 }
 
 // updateDocdbOrNot will updata DocDB(when under InternalDocDB mode) or not(when under ExternalDocDB mode)
 func (r *ChainDIDRegistry) updateDocdbOrNot(
+	ctx context.Context,
 	chainDID DID,
 	docAddr string,
 	docHash []byte,
@@ -326,44 +629,47 @@ func (r *ChainDIDRegistry) updateDocdbOrNot(
 	if r.Mode == InternalDocDB {
 		// check exist
 		if doc == nil {
-			return "", nil, "", fmt.Errorf("doc content is nil")
+			return "", nil, "", &InvalidFormatError{What: "doc", Reason: "doc content is nil"}
 		}
 		doc := doc.(*ChainDoc)
 		chainDID = doc.GetID()
-		status := r.getChainDIDStatus(chainDID)
+		status, err := r.getChainDIDStatus(ctx, chainDID)
+		if err != nil {
+			return "", nil, "", err
+		}
 		if status != expectedStatus {
 			return "", nil, "",
-				fmt.Errorf(
-					"chain did %s is under status: %s, expected status: %s",
-					chainDID,
-					status,
-					expectedStatus)
+				&InvalidStatusError{ID: chainDID, Current: status, Expected: []StatusType{expectedStatus}}
 		}
 
-		docBytes, err := doc.Marshal()
+		docHash, err = HashDoc(r.Codec, doc)
 		if err != nil {
 			return "", nil, "", fmt.Errorf("doc marshal: %w ", err)
 		}
 
 		if expectedStatus == ApplySuccess { // register
-			docAddr, err = r.Docdb.Create(doc)
+			docAddr, err = r.docdb().CreateContext(ctx, doc)
 		} else { // update
-			docAddr, err = r.Docdb.Update(doc)
+			var stored Doc
+			if stored, err = r.docdb().GetContext(ctx, chainDID, ChainDIDType); err != nil {
+				return "", nil, "", fmt.Errorf("docdb get: %w", err)
+			}
+			if err = checkKeysKept(ctx, &stored.(*ChainDoc).BasicDoc, &doc.BasicDoc); err != nil {
+				return "", nil, "", err
+			}
+			docAddr, err = r.docdb().UpdateContext(ctx, doc)
 		}
 		if err != nil {
 			return "", nil, "", fmt.Errorf("update docdb: %w ", err)
 		}
-		docHash32 := sha256.Sum256(docBytes)
-		docHash = docHash32[:]
 	} else {
-		status := r.getChainDIDStatus(chainDID)
+		status, err := r.getChainDIDStatus(ctx, chainDID)
+		if err != nil {
+			return "", nil, "", err
+		}
 		if status != expectedStatus {
 			return "", nil, "",
-				fmt.Errorf(
-					"chain did %s is under status: %s, expected status: %s",
-					chainDID,
-					status,
-					expectedStatus)
+				&InvalidStatusError{ID: chainDID, Current: status, Expected: []StatusType{expectedStatus}}
 		}
 	}
 	return docAddr, docHash, chainDID, nil
@@ -372,65 +678,145 @@ func (r *ChainDIDRegistry) updateDocdbOrNot(
 // Audit audits status of a chain did
 // ATN: only admin should call this.
 func (r *ChainDIDRegistry) Audit(chainDID DID, status StatusType) error {
-	exist := r.HasChainDID(chainDID)
+	return r.AuditContext(context.Background(), chainDID, status)
+}
+
+// AuditContext is Audit with context
+func (r *ChainDIDRegistry) AuditContext(ctx context.Context, chainDID DID, status StatusType) error {
+	if err := checkGoverned(ctx, r.Governance, ActionAudit); err != nil {
+		return err
+	}
+	if err := checkPermission(ctx, r.RBAC, PermAudit); err != nil {
+		return err
+	}
+	exist, err := r.HasChainDIDContext(ctx, chainDID)
+	if err != nil {
+		return err
+	}
 	if !exist {
-		return fmt.Errorf("audit %s not existed", chainDID)
+		return &NotFoundError{ID: string(chainDID)}
 	}
-	return r.auditStatus(chainDID, status)
+	return r.auditStatus(ctx, ActionAudit, EventAudited, chainDID, status)
+}
+
+// AuditWithReason is Audit recording the reason of the decision
+func (r *ChainDIDRegistry) AuditWithReason(chainDID DID, status StatusType, reason Reason) error {
+	return r.AuditContext(ContextWithReason(context.Background(), reason), chainDID, status)
 }
 
 // Freeze freezes a chain did
 // ATN: only admdin should call this.
 func (r *ChainDIDRegistry) Freeze(chainDID DID) error {
-	exist := r.HasChainDID(chainDID)
+	return r.FreezeContext(context.Background(), chainDID)
+}
+
+// FreezeContext is Freeze with context
+func (r *ChainDIDRegistry) FreezeContext(ctx context.Context, chainDID DID) error {
+	if err := checkGoverned(ctx, r.Governance, ActionFreeze); err != nil {
+		return err
+	}
+	if err := checkPermission(ctx, r.RBAC, PermFreeze); err != nil {
+		return err
+	}
+	exist, err := r.HasChainDIDContext(ctx, chainDID)
+	if err != nil {
+		return err
+	}
 	if !exist {
-		return fmt.Errorf("freeze %s not existed", chainDID)
+		return &NotFoundError{ID: string(chainDID)}
 	}
-	return r.auditStatus(chainDID, Frozen)
+	return r.auditStatus(ctx, ActionFreeze, EventFrozen, chainDID, Frozen)
+}
+
+// FreezeWithReason is Freeze recording the reason of the decision
+func (r *ChainDIDRegistry) FreezeWithReason(chainDID DID, reason Reason) error {
+	return r.FreezeContext(ContextWithReason(context.Background(), reason), chainDID)
 }
 
 // UnFreeze unfreezes a chain did
 // ATN: only admdin should call this.
 func (r *ChainDIDRegistry) UnFreeze(chainDID DID) error {
-	exist := r.HasChainDID(chainDID)
+	return r.UnFreezeContext(context.Background(), chainDID)
+}
+
+// UnFreezeContext is UnFreeze with context
+func (r *ChainDIDRegistry) UnFreezeContext(ctx context.Context, chainDID DID) error {
+	if err := checkGoverned(ctx, r.Governance, ActionUnFreeze); err != nil {
+		return err
+	}
+	if err := checkPermission(ctx, r.RBAC, PermFreeze); err != nil {
+		return err
+	}
+	exist, err := r.HasChainDIDContext(ctx, chainDID)
+	if err != nil {
+		return err
+	}
 	if !exist {
-		return fmt.Errorf("unfreeze %s not existed", chainDID)
+		return &NotFoundError{ID: string(chainDID)}
 	}
-
-	return r.auditStatus(chainDID, Normal)
+	return r.auditStatus(ctx, ActionUnFreeze, EventUnFrozen, chainDID, Normal)
 }
 
 // Delete deletes data of a chain did
 func (r *ChainDIDRegistry) Delete(chainDID DID) error {
-	err := r.auditStatus(chainDID, Initial)
+	return r.DeleteContext(context.Background(), chainDID)
+}
+
+// DeleteContext is Delete with context
+func (r *ChainDIDRegistry) DeleteContext(ctx context.Context, chainDID DID) error {
+	if err := checkGoverned(ctx, r.Governance, ActionDelete); err != nil {
+		return err
+	}
+	if err := checkPermission(ctx, r.RBAC, PermAdmin); err != nil {
+		return err
+	}
+	err := r.auditStatus(ctx, ActionDelete, "", chainDID, Initial)
 	if err != nil {
 		return fmt.Errorf("chain did delete: %w", err)
 	}
 
-	r.Table.DeleteItem(chainDID)
+	if err := r.table().DeleteItemContext(ctx, chainDID); err != nil {
+		return fmt.Errorf("chain did delete: %w", err)
+	}
 
 	if r.Mode == InternalDocDB {
-		r.Docdb.Delete(chainDID)
+		if err := r.docdb().DeleteContext(ctx, chainDID); err != nil {
+			return fmt.Errorf("chain did delete doc: %w", err)
+		}
 	}
 
-	return nil
+	return r.emit(ctx, EventDeleted, chainDID, Initial)
+}
+
+// DeleteWithReason is Delete recording the reason of the decision,
+// which is kept by the audit log and events since the item is removed.
+func (r *ChainDIDRegistry) DeleteWithReason(chainDID DID, reason Reason) error {
+	return r.DeleteContext(ContextWithReason(context.Background(), reason), chainDID)
 }
 
 // Resolve looks up local-chain to resolve chain did.
 // @*ChainDoc returns nil if mode is ExternalDocDB
 func (r *ChainDIDRegistry) Resolve(chainDID DID) (*ChainItem, *ChainDoc, bool, error) {
-	exist := r.HasChainDID(chainDID)
+	return r.ResolveContext(context.Background(), chainDID)
+}
+
+// ResolveContext is Resolve with context
+func (r *ChainDIDRegistry) ResolveContext(ctx context.Context, chainDID DID) (*ChainItem, *ChainDoc, bool, error) {
+	exist, err := r.HasChainDIDContext(ctx, chainDID)
+	if err != nil {
+		return nil, nil, false, err
+	}
 	if !exist {
 		return nil, nil, false, nil
 	}
-	item, err := r.Table.GetItem(chainDID, ChainDIDType)
+	item, err := r.table().GetItemContext(ctx, chainDID, ChainDIDType)
 	if err != nil {
 		return nil, nil, false, fmt.Errorf("chain did resolve table get: %w", err)
 	}
 	itemM := item.(*ChainItem)
 
 	if r.Mode == InternalDocDB {
-		doc, err := r.Docdb.Get(chainDID, ChainDIDType)
+		doc, err := r.docdb().GetContext(ctx, chainDID, ChainDIDType)
 		if err != nil {
 			return itemM, nil, true, fmt.Errorf("chain did resolve docdb get: %w", err)
 		}
@@ -440,35 +826,171 @@ func (r *ChainDIDRegistry) Resolve(chainDID DID) (*ChainItem, *ChainDoc, bool, e
 	return itemM, nil, true, nil
 }
 
+// ResolveFull resolves a chain did along with its doc.
+// Under ExternalDocDB mode the doc is fetched from DocAddr by the Fetcher
+// of the registry and verified against DocHash.
+func (r *ChainDIDRegistry) ResolveFull(chainDID DID) (*ChainItem, *ChainDoc, error) {
+	return r.ResolveFullContext(context.Background(), chainDID)
+}
+
+// ResolveFullContext is ResolveFull with context
+func (r *ChainDIDRegistry) ResolveFullContext(ctx context.Context, chainDID DID) (*ChainItem, *ChainDoc, error) {
+	item, doc, exist, err := r.ResolveContext(ctx, chainDID)
+	if err != nil || !exist {
+		return item, doc, err
+	}
+	if r.Mode == InternalDocDB {
+		return item, doc, nil
+	}
+	fetched, err := fetchDoc(ctx, r.Fetcher, r.docCache, r.Codec, &item.BasicItem, ChainDIDType)
+	if err != nil {
+		return item, nil, fmt.Errorf("chain did resolve full: %w", err)
+	}
+	return item, fetched.(*ChainDoc), nil
+}
+
+// ResolveWithProof resolves a chain did item along with a merkle proof of it,
+// which proves non-inclusion if the item is nil.
+// The table of the registry should be a ProvableTable.
+func (r *ChainDIDRegistry) ResolveWithProof(chainDID DID) (*ChainItem, *MerkleProof, error) {
+	pt, ok := r.Table.(ProvableTable)
+	if !ok {
+		return nil, nil, fmt.Errorf("chain did resolve with proof: table is not provable")
+	}
+	proof, err := pt.Prove(chainDID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("chain did resolve with proof: %w", err)
+	}
+	if !pt.HasItem(chainDID) {
+		return nil, proof, nil
+	}
+	item, err := pt.GetItem(chainDID, ChainDIDType)
+	if err != nil {
+		return nil, nil, fmt.Errorf("chain did resolve table get: %w", err)
+	}
+	return item.(*ChainItem), proof, nil
+}
+
 // HasChainDID checks whether a chain did exists
 func (r *ChainDIDRegistry) HasChainDID(chainDID DID) bool {
-	exist := r.Table.HasItem(chainDID)
+	exist, _ := r.HasChainDIDContext(context.Background(), chainDID)
 	return exist
 }
 
-func (r *ChainDIDRegistry) getChainDIDStatus(chainDID DID) StatusType {
-	if !r.Table.HasItem(chainDID) {
-		return Initial
+// HasChainDIDContext is HasChainDID with context
+func (r *ChainDIDRegistry) HasChainDIDContext(ctx context.Context, chainDID DID) (bool, error) {
+	return r.table().HasItemContext(ctx, chainDID)
+}
+
+// ChainDIDStatus gets status of a chain did, Initial if it does not exist
+func (r *ChainDIDRegistry) ChainDIDStatus(ctx context.Context, chainDID DID) (StatusType, error) {
+	return r.getChainDIDStatus(ctx, chainDID)
+}
+
+func (r *ChainDIDRegistry) supportsAction(action AuditAction) bool {
+	switch action {
+	case ActionAuditApply, ActionAudit, ActionFreeze, ActionUnFreeze, ActionDelete, ActionAddAdmin, ActionRemoveAdmin, ActionCancelAdminChange, ActionGrantRole, ActionRevokeRole:
+		return true
 	}
-	item, err := r.Table.GetItem(chainDID, ChainDIDType)
+	return false
+}
+
+func (r *ChainDIDRegistry) executeProposal(ctx context.Context, p *Proposal) error {
+	switch p.Action {
+	case ActionAuditApply:
+		return r.AuditApplyContext(ctx, p.Target, p.Result)
+	case ActionAudit:
+		return r.AuditContext(ctx, p.Target, p.Status)
+	case ActionFreeze:
+		return r.FreezeContext(ctx, p.Target)
+	case ActionUnFreeze:
+		return r.UnFreezeContext(ctx, p.Target)
+	case ActionDelete:
+		return r.DeleteContext(ctx, p.Target)
+	case ActionAddAdmin:
+		return r.AddAdminContext(ctx, p.Target)
+	case ActionRemoveAdmin:
+		return r.RemoveAdminContext(ctx, p.Target)
+	case ActionCancelAdminChange:
+		return r.CancelAdminChangeContext(ctx, p.Target)
+	case ActionGrantRole:
+		return r.GrantRoleContext(ctx, p.Target, p.Role)
+	case ActionRevokeRole:
+		return r.RevokeRoleContext(ctx, p.Target, p.Role)
+	}
+	return &InvalidFormatError{What: "proposal", Reason: fmt.Sprintf("unsupported action %s", p.Action)}
+}
+
+func (r *ChainDIDRegistry) table() RegistryTableContext {
+	return TableWithContext(r.Table)
+}
+
+func (r *ChainDIDRegistry) docdb() DocDBContext {
+	return DocDBWithContext(r.Docdb)
+}
+
+func (r *ChainDIDRegistry) emit(ctx context.Context, kind EventKind, chainDID DID, status StatusType) error {
+	return emitEvent(ctx, r.Events, &Event{Kind: kind, DID: chainDID, Type: ChainDIDType, Status: status})
+}
+
+func (r *ChainDIDRegistry) getChainDIDStatus(ctx context.Context, chainDID DID) (StatusType, error) {
+	exist, err := r.table().HasItemContext(ctx, chainDID)
+	if err != nil {
+		return BadStatus, err
+	}
+	if !exist {
+		return Initial, nil
+	}
+	item, err := r.table().GetItemContext(ctx, chainDID, ChainDIDType)
 	if err != nil {
 		r.logger.Error("chainDID status get item:", err)
-		return BadStatus
+		return BadStatus, fmt.Errorf("chain did status get item: %w", err)
 	}
 	itemM := item.(*ChainItem)
-	return itemM.Status
+	return itemM.Status, nil
 }
 
-func (r *ChainDIDRegistry) auditStatus(chainDID DID, status StatusType) error {
-	item, err := r.Table.GetItem(chainDID, ChainDIDType)
+// checkOwner allows owner of the chain did or registrars to register or update it
+func (r *ChainDIDRegistry) checkOwner(ctx context.Context, chainDID DID, doc Doc) error {
+	if r.RBAC == nil {
+		return nil
+	}
+	if doc != nil {
+		chainDID = doc.GetID()
+	}
+	var owner DID
+	if item, err := r.table().GetItemContext(ctx, chainDID, ChainDIDType); err == nil {
+		owner = item.(*ChainItem).Owner
+	}
+	return checkSelfOrPermission(ctx, r.RBAC, owner, PermRegister)
+}
+
+// auditStatus sets status of chainDID, emits an event of kind if kind is
+// not empty and records the admin action. The update is reverted if the
+// event can not be emitted, and is not made if the action can not be recorded.
+func (r *ChainDIDRegistry) auditStatus(ctx context.Context, action AuditAction, kind EventKind, chainDID DID, status StatusType) error {
+	item, err := r.table().GetItemContext(ctx, chainDID, ChainDIDType)
 	if err != nil {
 		return fmt.Errorf("aduitstatus table get: %w", err)
 	}
 	itemM := item.(*ChainItem)
+	prev := *itemM
 	itemM.Status = status
-	err = r.Table.UpdateItem(itemM)
-	if err != nil {
-		return fmt.Errorf("aduitstatus table update: %w", err)
-	}
-	return nil
+	itemM.Decisions = appendDecision(ctx, itemM.Decisions, action, status)
+	e := &AuditEntry{Action: action, Target: chainDID, OldStatus: prev.Status, NewStatus: status}
+	return recordAuditedWrite(ctx, r.AuditLog, e, func() error {
+		if err := r.table().UpdateItemContext(ctx, itemM); err != nil {
+			return fmt.Errorf("aduitstatus table update: %w", err)
+		}
+		if kind == "" {
+			return nil
+		}
+		if err := r.emit(ctx, kind, chainDID, status); err != nil {
+			if rerr := r.table().UpdateItemContext(ctx, &prev); rerr != nil {
+				return fmt.Errorf("aduitstatus revert after %v: %w", err, rerr)
+			}
+			return err
+		}
+		return nil
+	})
 }
@@ -1,6 +1,7 @@
 package bitxid
 
 import (
+	"context"
 	"crypto/sha256"
 	"fmt"
 	"io/ioutil"
@@ -340,3 +341,59 @@ func testCloseSucceedExternal(t *testing.T, mr *ChainDIDRegistry, path ...string
 		assert.Nil(t, err)
 	}
 }
+
+func TestChainDIDDecisions(t *testing.T) {
+	for _, c := range []Codec{&GobCodec{}, &JSONCodec{}, &ProtoCodec{}} {
+		mr, drtPath := newChainDIDModeExternal(t)
+		mr.Table.(*KVTable).SetCodec(c)
+		testChainDIDSetupGenesSucceed(t, mr)
+		testChainDIDApplySucceed(t, mr)
+
+		rejected := Reason{
+			Code:     ReasonIncompleteInfo,
+			Comment:  "doc misses controller",
+			Evidence: []string{"https://example.com/review/1"},
+		}
+		assert.Nil(t, mr.AuditApplyWithReason(chainDID, false, rejected))
+		item, _, _, err := mr.Resolve(chainDID)
+		assert.Nil(t, err)
+		assert.Equal(t, ApplyFailed, item.Status)
+		assert.Equal(t, 1, len(item.Decisions))
+		assert.Equal(t, ActionAuditApply, item.Decisions[0].Action)
+		assert.Equal(t, ApplyFailed, item.Decisions[0].Status)
+		assert.Equal(t, rejected, item.Decisions[0].Reason)
+		assert.Zero(t, item.Decisions[0].Timestamp) // no wall clock time on items
+
+		assert.Nil(t, mr.AuditApply(chainDID, true))
+		testChainDIDRegisterSucceedExternal(t, mr)
+		frozen := Reason{Code: ReasonKeyCompromised}
+		ctx := ContextWithTimestamp(ContextWithCaller(context.Background(), admin), 1617006461000000000)
+		assert.Nil(t, mr.FreezeContext(ContextWithReason(ctx, frozen), chainDID))
+		assert.Nil(t, mr.AuditWithReason(chainDID, Normal, Reason{Comment: "key rotated"}))
+
+		item, _, _, err = mr.Resolve(chainDID)
+		assert.Nil(t, err, "codec %d", c.Type())
+		assert.Equal(t, 4, len(item.Decisions))
+		assert.Equal(t, ApplySuccess, item.Decisions[1].Status)
+		assert.Equal(t, ActionFreeze, item.Decisions[2].Action)
+		assert.Equal(t, frozen, item.Decisions[2].Reason)
+		assert.Equal(t, admin, item.Decisions[2].Caller)
+		assert.Equal(t, int64(1617006461000000000), item.Decisions[2].Timestamp)
+		assert.Equal(t, ActionAudit, item.Decisions[3].Action)
+		assert.Equal(t, "key rotated", item.Decisions[3].Reason.Comment)
+
+		// only the latest decisions are kept
+		for i := 0; i < MaxDecisions; i++ {
+			assert.Nil(t, mr.Freeze(chainDID))
+			assert.Nil(t, mr.UnFreeze(chainDID))
+		}
+		item, _, _, err = mr.Resolve(chainDID)
+		assert.Nil(t, err)
+		assert.Equal(t, MaxDecisions, len(item.Decisions))
+		assert.Equal(t, ActionUnFreeze, item.Decisions[MaxDecisions-1].Action)
+
+		assert.Nil(t, mr.DeleteWithReason(chainDID, Reason{Code: ReasonRequestedByHolder}))
+		assert.False(t, mr.HasChainDID(chainDID))
+		testCloseSucceedExternal(t, mr, drtPath)
+	}
+}
@@ -0,0 +1,227 @@
+package bitxid
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+)
+
+// CodecType identifies the codec a stored value was encoded with
+type CodecType byte
+
+// type of codec:
+// @GobCodecType: encoding/gob, go only, the legacy format
+// @JSONCodecType: encoding/json
+// @ProtoCodecType: protobuf wire format, see docs/bitxid.proto
+const (
+	GobCodecType CodecType = iota + 1
+	JSONCodecType
+	ProtoCodecType
+)
+
+// recordMagic starts every tagged record. A gob stream never begins with
+// a zero byte (it would be an empty message), so untagged legacy gob
+// values can still be told apart.
+// The header of a tagged record is: recordMagic | codec type | schema version
+const (
+	recordMagic      byte = 0x00
+	recordHeaderSize      = 3
+)
+
+// Codec encodes and decodes items and docs
+type Codec interface {
+	Type() CodecType
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+var (
+	_ Codec = (*GobCodec)(nil)
+	_ Codec = (*JSONCodec)(nil)
+	_ Codec = (*ProtoCodec)(nil)
+)
+
+var codecs = map[CodecType]Codec{
+	GobCodecType:   &GobCodec{},
+	JSONCodecType:  &JSONCodec{},
+	ProtoCodecType: &ProtoCodec{},
+}
+
+// RegisterCodec registers a codec so that values tagged with its type can be decoded
+func RegisterCodec(c Codec) {
+	codecs[c.Type()] = c
+}
+
+// GetCodec gets a registered codec by its type
+func GetCodec(typ CodecType) (Codec, error) {
+	c, ok := codecs[typ]
+	if !ok {
+		return nil, fmt.Errorf("unknown codec type: %d", typ)
+	}
+	return c, nil
+}
+
+// DefaultCodec is used when no codec is configured
+func DefaultCodec() Codec {
+	return codecs[GobCodecType]
+}
+
+// GobCodec encodes with encoding/gob
+type GobCodec struct{}
+
+// Type .
+func (c *GobCodec) Type() CodecType {
+	return GobCodecType
+}
+
+// Marshal .
+func (c *GobCodec) Marshal(v interface{}) ([]byte, error) {
+	buf := bytes.Buffer{}
+	err := gob.NewEncoder(&buf).Encode(v)
+	if err != nil {
+		return nil, fmt.Errorf("gob encode err: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// Unmarshal .
+func (c *GobCodec) Unmarshal(data []byte, v interface{}) error {
+	err := gob.NewDecoder(bytes.NewBuffer(data)).Decode(v)
+	if err != nil {
+		return fmt.Errorf("gob decode err: %w", err)
+	}
+	return nil
+}
+
+// JSONCodec encodes with encoding/json
+type JSONCodec struct{}
+
+// Type .
+func (c *JSONCodec) Type() CodecType {
+	return JSONCodecType
+}
+
+// Marshal .
+func (c *JSONCodec) Marshal(v interface{}) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("json encode err: %w", err)
+	}
+	return data, nil
+}
+
+// Unmarshal .
+func (c *JSONCodec) Unmarshal(data []byte, v interface{}) error {
+	err := json.Unmarshal(data, v)
+	if err != nil {
+		return fmt.Errorf("json decode err: %w", err)
+	}
+	return nil
+}
+
+// ProtoCodec encodes structs in protobuf wire format,
+// field numbers are taken from `pb` struct tags.
+type ProtoCodec struct{}
+
+// Type .
+func (c *ProtoCodec) Type() CodecType {
+	return ProtoCodecType
+}
+
+// Marshal .
+func (c *ProtoCodec) Marshal(v interface{}) ([]byte, error) {
+	data, err := protoMarshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("proto encode err: %w", err)
+	}
+	return data, nil
+}
+
+// Unmarshal .
+func (c *ProtoCodec) Unmarshal(data []byte, v interface{}) error {
+	err := protoUnmarshal(data, v)
+	if err != nil {
+		return fmt.Errorf("proto decode err: %w", err)
+	}
+	return nil
+}
+
+// encodeRecord encodes v with codec c and prepends the record header
+func encodeRecord(c Codec, v interface{}) ([]byte, error) {
+	if c == nil {
+		c = DefaultCodec()
+	}
+	payload, err := c.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return joinRecord(c, CurrentSchemaVersion, payload), nil
+}
+
+// decodeRecord decodes a stored value into v,
+// untagged values are treated as legacy gob.
+func decodeRecord(data []byte, v interface{}) error {
+	c, version, payload, err := splitRecord(data)
+	if err != nil {
+		return err
+	}
+	if version > CurrentSchemaVersion {
+		return &InvalidFormatError{
+			What:   "record",
+			Reason: fmt.Sprintf("schema version %d is newer than supported %d", version, CurrentSchemaVersion)}
+	}
+	if err := c.Unmarshal(payload, v); err != nil {
+		return &InvalidFormatError{What: "record", Err: err}
+	}
+	return nil
+}
+
+func joinRecord(c Codec, version uint8, payload []byte) []byte {
+	record := make([]byte, 0, recordHeaderSize+len(payload))
+	record = append(record, recordMagic, byte(c.Type()), version)
+	return append(record, payload...)
+}
+
+// splitRecord returns the codec, the schema version and the payload of a stored value
+func splitRecord(data []byte) (Codec, uint8, []byte, error) {
+	if len(data) == 0 || data[0] != recordMagic {
+		return DefaultCodec(), LegacySchemaVersion, data, nil
+	}
+	if len(data) < recordHeaderSize {
+		return nil, 0, nil, &InvalidFormatError{What: "record", Reason: "header too short"}
+	}
+	c, err := GetCodec(CodecType(data[1]))
+	if err != nil {
+		return nil, 0, nil, &InvalidFormatError{What: "record", Err: err}
+	}
+	return c, data[2], data[recordHeaderSize:], nil
+}
+
+// codecSetter is implemented by tables and docdbs which encode with a codec
+type codecSetter interface {
+	SetCodec(c Codec)
+}
+
+func setCodec(target interface{}, c Codec) {
+	if c == nil {
+		return
+	}
+	if cs, ok := target.(codecSetter); ok {
+		cs.SetCodec(c)
+	}
+}
+
+// migratorSetter is implemented by tables and docdbs which migrate records on read
+type migratorSetter interface {
+	SetMigrator(m *Migrator)
+}
+
+func setMigrator(target interface{}, m *Migrator) {
+	if m == nil {
+		return
+	}
+	if ms, ok := target.(migratorSetter); ok {
+		ms.SetMigrator(m)
+	}
+}
@@ -0,0 +1,136 @@
+package bitxid
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/meshplus/bitxhub-kit/storage/leveldb"
+	"github.com/stretchr/testify/assert"
+)
+
+var testCodecs = []Codec{&GobCodec{}, &JSONCodec{}, &ProtoCodec{}}
+
+func TestCodecRoundTrip(t *testing.T) {
+	item := ChainItem{
+		BasicItem{
+			ID:      chainDID,
+			DocAddr: "./addr",
+			DocHash: []byte{1, 2, 3},
+			Status:  Normal},
+		mcaller,
+	}
+	doc := getChainDoc(1)
+	doc.Created = 1616985208
+	doc.Extra = []byte("extra")
+
+	for _, c := range testCodecs {
+		b, err := c.Marshal(&item)
+		assert.Nil(t, err)
+		itemGet := &ChainItem{}
+		err = c.Unmarshal(b, itemGet)
+		assert.Nil(t, err)
+		assert.Equal(t, item, *itemGet, "codec %d", c.Type())
+
+		b, err = c.Marshal(&doc)
+		assert.Nil(t, err)
+		docGet := &ChainDoc{}
+		err = c.Unmarshal(b, docGet)
+		assert.Nil(t, err)
+		assert.Equal(t, doc, *docGet, "codec %d", c.Type())
+
+		b, err = c.Marshal(&testVC)
+		assert.Nil(t, err)
+		vcGet := &Credential{}
+		err = c.Unmarshal(b, vcGet)
+		assert.Nil(t, err)
+		assert.Equal(t, testVC, *vcGet, "codec %d", c.Type())
+	}
+}
+
+func TestProtoCodecWire(t *testing.T) {
+	// field 1 (string "a"), field 2 (varint 1)
+	b, err := protoMarshal(&PubKey{ID: "a"})
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{0x0a, 0x01, 'a'}, b)
+
+	// unknown fields are skipped
+	pk := &PubKey{}
+	err = protoUnmarshal(append([]byte{0x78, 0x05}, b...), pk)
+	assert.Nil(t, err)
+	assert.Equal(t, "a", pk.ID)
+
+	type untagged struct {
+		A string
+	}
+	_, err = protoMarshal(&untagged{A: "a"})
+	assert.NotNil(t, err)
+}
+
+func TestTableMixedCodec(t *testing.T) {
+	dir, err := ioutil.TempDir("", "registry.table")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	s, err := leveldb.New(dir)
+	assert.Nil(t, err)
+	rt, err := NewKVTable(s)
+	assert.Nil(t, err)
+
+	// legacy value without codec tag
+	legacy := &AccountItem{BasicItem{ID: "did:bitxhub:appchain001:0x01", Status: Normal}}
+	lb, err := legacy.Marshal()
+	assert.Nil(t, err)
+	s.Put(tbKey(legacy.ID), lb)
+
+	items := []*AccountItem{legacy}
+	for i, c := range testCodecs {
+		rt.SetCodec(c)
+		item := &AccountItem{BasicItem{
+			ID:      DID("did:bitxhub:appchain001:0x1" + string(rune('a'+i))),
+			DocHash: []byte{byte(i)},
+			Status:  Normal}}
+		err = rt.CreateItem(item)
+		assert.Nil(t, err)
+		assert.Equal(t, byte(c.Type()), s.Get(tbKey(item.ID))[1])
+		items = append(items, item)
+	}
+
+	for _, item := range items {
+		itemGet, err := rt.GetItem(item.ID, AccountDIDType)
+		assert.Nil(t, err)
+		assert.Equal(t, item, itemGet)
+	}
+}
+
+func TestRegistryCodec(t *testing.T) {
+	dir1, err := ioutil.TempDir("", "chainDID.table")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir1)
+	dir2, err := ioutil.TempDir("", "chainDID.docdb")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir2)
+
+	loggerInit()
+	s1, err := leveldb.New(dir1)
+	assert.Nil(t, err)
+	s2, err := leveldb.New(dir2)
+	assert.Nil(t, err)
+	mr, err := NewChainDIDRegistry(s1, loggerGet(loggerChainDID),
+		WithGenesisChainDocContent(&mdoc),
+		WithAdmin(superAdmin),
+		WithChainDocStorage(s2),
+		WithChainCodec(&JSONCodec{}))
+	assert.Nil(t, err)
+	assert.Equal(t, JSONCodecType, mr.Table.(*KVTable).Codec.Type())
+	assert.Equal(t, JSONCodecType, mr.Docdb.(*KVDocDB).Codec.Type())
+
+	err = mr.SetupGenesis()
+	assert.Nil(t, err)
+	item, doc, _, err := mr.Resolve(rootChainDID)
+	assert.Nil(t, err)
+	assert.Equal(t, &mdoc, doc)
+	hash, err := HashDoc(&JSONCodec{}, &mdoc)
+	assert.Nil(t, err)
+	assert.Equal(t, hash, item.DocHash)
+}
@@ -0,0 +1,259 @@
+package bitxid
+
+import (
+	"context"
+)
+
+type contextKey int
+
+const (
+	callerKey contextKey = iota
+	traceIDKey
+	reasonKey
+	governanceKey
+	keyProofKey
+	docAuthKey
+	timestampKey
+)
+
+// ContextWithCaller returns a copy of ctx carrying the did of the caller
+func ContextWithCaller(ctx context.Context, caller DID) context.Context {
+	return context.WithValue(ctx, callerKey, caller)
+}
+
+// CallerFromContext gets the did of the caller carried by ctx
+func CallerFromContext(ctx context.Context) (DID, bool) {
+	caller, ok := ctx.Value(callerKey).(DID)
+	return caller, ok
+}
+
+// ContextWithTraceID returns a copy of ctx carrying a trace id
+func ContextWithTraceID(ctx context.Context, traceID string) context.Context {
+	return context.WithValue(ctx, traceIDKey, traceID)
+}
+
+// TraceIDFromContext gets the trace id carried by ctx
+func TraceIDFromContext(ctx context.Context) (string, bool) {
+	traceID, ok := ctx.Value(traceIDKey).(string)
+	return traceID, ok
+}
+
+// ContextWithReason returns a copy of ctx carrying the reason of an admin action
+func ContextWithReason(ctx context.Context, reason Reason) context.Context {
+	return context.WithValue(ctx, reasonKey, reason)
+}
+
+// ReasonFromContext gets the reason carried by ctx
+func ReasonFromContext(ctx context.Context) (Reason, bool) {
+	reason, ok := ctx.Value(reasonKey).(Reason)
+	return reason, ok
+}
+
+// ContextWithTimestamp returns a copy of ctx carrying the time of the call
+// in unix nano, e.g. the block time, which is recorded in decisions of items
+// and audit entries so that every node records the same
+func ContextWithTimestamp(ctx context.Context, ts int64) context.Context {
+	return context.WithValue(ctx, timestampKey, ts)
+}
+
+// TimestampFromContext gets the timestamp carried by ctx
+func TimestampFromContext(ctx context.Context) (int64, bool) {
+	ts, ok := ctx.Value(timestampKey).(int64)
+	return ts, ok
+}
+
+// TableWithContext gets the context-aware view of table t,
+// tables without context support are wrapped and only check ctx before each call.
+func TableWithContext(t RegistryTable) RegistryTableContext {
+	switch tt := t.(type) {
+	case RegistryTableContext:
+		return tt
+	case *plainTable:
+		return tt.t
+	default:
+		return &ctxTable{t}
+	}
+}
+
+// TableWithoutContext adapts a context-aware table to RegistryTable,
+// calls are made with context.Background().
+func TableWithoutContext(t RegistryTableContext) RegistryTable {
+	if rt, ok := t.(RegistryTable); ok {
+		return rt
+	}
+	if tt, ok := t.(*ctxTable); ok {
+		return tt.t
+	}
+	return &plainTable{t}
+}
+
+type ctxTable struct {
+	t RegistryTable
+}
+
+func (tt *ctxTable) CreateItemContext(ctx context.Context, item TableItem) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return tt.t.CreateItem(item)
+}
+
+func (tt *ctxTable) UpdateItemContext(ctx context.Context, item TableItem) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return tt.t.UpdateItem(item)
+}
+
+func (tt *ctxTable) GetItemContext(ctx context.Context, did DID, typ DIDType) (TableItem, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return tt.t.GetItem(did, typ)
+}
+
+func (tt *ctxTable) HasItemContext(ctx context.Context, did DID) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	return tt.t.HasItem(did), nil
+}
+
+func (tt *ctxTable) DeleteItemContext(ctx context.Context, did DID) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	tt.t.DeleteItem(did)
+	return nil
+}
+
+func (tt *ctxTable) Close() error {
+	return tt.t.Close()
+}
+
+type plainTable struct {
+	t RegistryTableContext
+}
+
+func (tt *plainTable) CreateItem(item TableItem) error {
+	return tt.t.CreateItemContext(context.Background(), item)
+}
+
+func (tt *plainTable) UpdateItem(item TableItem) error {
+	return tt.t.UpdateItemContext(context.Background(), item)
+}
+
+func (tt *plainTable) GetItem(did DID, typ DIDType) (TableItem, error) {
+	return tt.t.GetItemContext(context.Background(), did, typ)
+}
+
+func (tt *plainTable) HasItem(did DID) bool {
+	exist, _ := tt.t.HasItemContext(context.Background(), did)
+	return exist
+}
+
+func (tt *plainTable) DeleteItem(did DID) {
+	_ = tt.t.DeleteItemContext(context.Background(), did)
+}
+
+func (tt *plainTable) Close() error {
+	return tt.t.Close()
+}
+
+// DocDBWithContext gets the context-aware view of docdb d,
+// docdbs without context support are wrapped and only check ctx before each call.
+func DocDBWithContext(d DocDB) DocDBContext {
+	switch dd := d.(type) {
+	case DocDBContext:
+		return dd
+	case *plainDocDB:
+		return dd.d
+	default:
+		return &ctxDocDB{d}
+	}
+}
+
+// DocDBWithoutContext adapts a context-aware docdb to DocDB,
+// calls are made with context.Background().
+func DocDBWithoutContext(d DocDBContext) DocDB {
+	if db, ok := d.(DocDB); ok {
+		return db
+	}
+	if dd, ok := d.(*ctxDocDB); ok {
+		return dd.d
+	}
+	return &plainDocDB{d}
+}
+
+type ctxDocDB struct {
+	d DocDB
+}
+
+func (dd *ctxDocDB) CreateContext(ctx context.Context, doc Doc) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	return dd.d.Create(doc)
+}
+
+func (dd *ctxDocDB) UpdateContext(ctx context.Context, doc Doc) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	return dd.d.Update(doc)
+}
+
+func (dd *ctxDocDB) GetContext(ctx context.Context, did DID, typ DIDType) (Doc, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return dd.d.Get(did, typ)
+}
+
+func (dd *ctxDocDB) HasContext(ctx context.Context, did DID) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	return dd.d.Has(did), nil
+}
+
+func (dd *ctxDocDB) DeleteContext(ctx context.Context, did DID) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	dd.d.Delete(did)
+	return nil
+}
+
+func (dd *ctxDocDB) Close() error {
+	return dd.d.Close()
+}
+
+type plainDocDB struct {
+	d DocDBContext
+}
+
+func (dd *plainDocDB) Create(doc Doc) (string, error) {
+	return dd.d.CreateContext(context.Background(), doc)
+}
+
+func (dd *plainDocDB) Update(doc Doc) (string, error) {
+	return dd.d.UpdateContext(context.Background(), doc)
+}
+
+func (dd *plainDocDB) Get(did DID, typ DIDType) (Doc, error) {
+	return dd.d.GetContext(context.Background(), did, typ)
+}
+
+func (dd *plainDocDB) Has(did DID) bool {
+	exist, _ := dd.d.HasContext(context.Background(), did)
+	return exist
+}
+
+func (dd *plainDocDB) Delete(did DID) {
+	_ = dd.d.DeleteContext(context.Background(), did)
+}
+
+func (dd *plainDocDB) Close() error {
+	return dd.d.Close()
+}
@@ -0,0 +1,165 @@
+package bitxid
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// ctxOnlyTable is a RegistryTable implementing only the context-aware methods
+type ctxOnlyTable struct {
+	t     RegistryTable
+	calls int
+	trace []string
+}
+
+func (ct *ctxOnlyTable) record(ctx context.Context) {
+	ct.calls++
+	if id, ok := TraceIDFromContext(ctx); ok {
+		ct.trace = append(ct.trace, id)
+	}
+}
+
+func (ct *ctxOnlyTable) CreateItemContext(ctx context.Context, item TableItem) error {
+	ct.record(ctx)
+	return ct.t.CreateItem(item)
+}
+
+func (ct *ctxOnlyTable) UpdateItemContext(ctx context.Context, item TableItem) error {
+	ct.record(ctx)
+	return ct.t.UpdateItem(item)
+}
+
+func (ct *ctxOnlyTable) GetItemContext(ctx context.Context, did DID, typ DIDType) (TableItem, error) {
+	ct.record(ctx)
+	return ct.t.GetItem(did, typ)
+}
+
+func (ct *ctxOnlyTable) HasItemContext(ctx context.Context, did DID) (bool, error) {
+	ct.record(ctx)
+	return ct.t.HasItem(did), nil
+}
+
+func (ct *ctxOnlyTable) DeleteItemContext(ctx context.Context, did DID) error {
+	ct.record(ctx)
+	ct.t.DeleteItem(did)
+	return nil
+}
+
+func (ct *ctxOnlyTable) Close() error {
+	return ct.t.Close()
+}
+
+func TestContextValues(t *testing.T) {
+	ctx := context.Background()
+	_, ok := CallerFromContext(ctx)
+	assert.False(t, ok)
+	ctx = ContextWithCaller(ctx, mcaller)
+	ctx = ContextWithTraceID(ctx, "trace-1")
+	caller, ok := CallerFromContext(ctx)
+	assert.True(t, ok)
+	assert.Equal(t, mcaller, caller)
+	id, ok := TraceIDFromContext(ctx)
+	assert.True(t, ok)
+	assert.Equal(t, "trace-1", id)
+}
+
+func TestContextCancelled(t *testing.T) {
+	mr, tablePath, docdbPath := newChainDIDModeInternal(t)
+	defer os.RemoveAll(tablePath)
+	defer os.RemoveAll(docdbPath)
+	testChainDIDSetupGenesSucceed(t, mr)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := mr.ApplyContext(ctx, mcaller, chainDID)
+	assert.True(t, errors.Is(err, context.Canceled))
+	assert.False(t, mr.HasChainDID(chainDID))
+	_, _, _, err = mr.ResolveContext(ctx, mr.GenesisChainDID)
+	assert.True(t, errors.Is(err, context.Canceled))
+	_, _, _, err = mr.ResolveContext(context.Background(), mr.GenesisChainDID)
+	assert.Nil(t, err)
+
+	r, drtPath, ddbPath := newDIDModeInternal(t)
+	defer os.RemoveAll(drtPath)
+	defer os.RemoveAll(ddbPath)
+	testSetupDIDSucceed(t, r)
+	_, _, err = r.RegisterWithDocContext(ctx, &accountDocA)
+	assert.True(t, errors.Is(err, context.Canceled))
+	assert.True(t, errors.Is(r.FreezeContext(ctx, rootAccountDID), context.Canceled))
+
+	s, dir := newTestStorage(t, "vc.store")
+	defer os.RemoveAll(dir)
+	vcr, err := NewVCRegistry(s)
+	assert.Nil(t, err)
+	_, err = vcr.StoreVCContext(ctx, &testVC)
+	assert.True(t, errors.Is(err, context.Canceled))
+	vc, err := vcr.GetVC(testVC.ID)
+	assert.True(t, errors.Is(err, ErrNotFound)) // not stored
+	assert.Nil(t, vc)
+}
+
+func TestContextTableAdapters(t *testing.T) {
+	mr, tablePath, docdbPath := newChainDIDModeInternal(t)
+	defer os.RemoveAll(tablePath)
+	defer os.RemoveAll(docdbPath)
+
+	// adapters round trip to the original table
+	assert.Equal(t, mr.Table, TableWithoutContext(TableWithContext(mr.Table)))
+	assert.Equal(t, mr.Docdb, DocDBWithoutContext(DocDBWithContext(mr.Docdb)))
+
+	ct := &ctxOnlyTable{t: mr.Table}
+	mr.Table = TableWithoutContext(ct)
+	assert.Equal(t, ct, TableWithContext(mr.Table))
+	testChainDIDSetupGenesSucceed(t, mr)
+	testChainDIDApplySucceed(t, mr)
+	assert.NotZero(t, ct.calls)
+
+	// registry passes its context down to context-aware tables
+	ctx := ContextWithTraceID(context.Background(), "trace-2")
+	assert.Nil(t, mr.AuditApplyContext(ctx, chainDID, true))
+	assert.NotEmpty(t, ct.trace)
+	for _, id := range ct.trace {
+		assert.Equal(t, "trace-2", id)
+	}
+	_, _, err := mr.RegisterWithDoc(&mdocA)
+	assert.Nil(t, err)
+	item, doc, exist, err := mr.Resolve(chainDID)
+	assert.Nil(t, err)
+	assert.True(t, exist)
+	assert.Equal(t, Normal, item.Status)
+	assert.Equal(t, &mdocA, doc)
+}
+
+func TestContextFetchTimeout(t *testing.T) {
+	content, err := Marshal(mdocA)
+	assert.Nil(t, err)
+	hash := sha256.Sum256(content)
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+		w.Write(content)
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	mr, tablePath := newChainDIDWithFetcher(t, NewMultiFetcher())
+	defer os.RemoveAll(tablePath)
+	_, _, err = mr.Register(chainDID, srv.URL, hash[:])
+	assert.Nil(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, _, err = mr.ResolveFullContext(ctx, chainDID)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+}
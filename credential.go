@@ -1,6 +1,8 @@
 package bitxid
 
 import (
+	"context"
+	"errors"
 	"fmt"
 
 	"github.com/meshplus/bitxhub-kit/storage"
@@ -8,14 +10,14 @@ import (
 
 // ClaimTyp represents claim type
 type ClaimTyp struct {
-	ID      string      `json:"id"` // the universal id of claim type
-	Content []*FieldTyp `json:"content"`
+	ID      string      `json:"id" pb:"1"` // the universal id of claim type
+	Content []*FieldTyp `json:"content" pb:"2"`
 }
 
 // FieldTyp represents field type
 type FieldTyp struct {
-	Field string `json:"field"` // field name
-	Typ   string `json:"typ"`   // field type e.g. int, float, string
+	Field string `json:"field" pb:"1"` // field name
+	Typ   string `json:"typ" pb:"2"`   // field type e.g. int, float, string
 }
 
 // Marshal marshals claimTyp
@@ -31,19 +33,19 @@ func (c *ClaimTyp) Unmarshal(docBytes []byte) error {
 
 // Credential represents verifiable credential
 type Credential struct {
-	ID         string `json:"id"`
-	Typ        string `json:"typ"`
-	Issuer     DID    `json:"issuer"`
-	Issued     uint64 `json:"issued"`
-	Expiration uint64 `json:"expiration"`
-	Claim      string `json:"claim"` // jsonSchema string
-	Signature  Sig    `json:"signature"`
+	ID         string `json:"id" pb:"1"`
+	Typ        string `json:"typ" pb:"2"`
+	Issuer     DID    `json:"issuer" pb:"3"`
+	Issued     uint64 `json:"issued" pb:"4"`
+	Expiration uint64 `json:"expiration" pb:"5"`
+	Claim      string `json:"claim" pb:"6"` // jsonSchema string
+	Signature  Sig    `json:"signature" pb:"7"`
 }
 
 // Sig represents signature data
 type Sig struct {
-	Typ     string `json:"typ"`
-	Content string `json:"content"`
+	Typ     string `json:"typ" pb:"1"`
+	Content string `json:"content" pb:"2"`
 }
 
 // Marshal marshals credential
@@ -58,60 +60,132 @@ func (c *Credential) Unmarshal(docBytes []byte) error {
 }
 
 var _ VCManager = (*VCRegistry)(nil)
+var _ VCManagerContext = (*VCRegistry)(nil)
 
 // VCRegistry represents verifiable credential management registry
 type VCRegistry struct {
 	Store  storage.Storage `json:"store"`
 	CTlist []string        `json:"ct_list"`
+	Codec  Codec           `json:"codec"`
+	Events EventSink       `json:"-"` // receives state change events if set
+	RBAC   *RBAC           `json:"-"` // checks permissions of callers if set
 }
 
 // NewVCRegistry news a NewVCRegistry
-func NewVCRegistry(s storage.Storage) (*VCRegistry, error) {
-	return &VCRegistry{
+func NewVCRegistry(s storage.Storage, options ...func(*VCRegistry)) (*VCRegistry, error) {
+	vcr := &VCRegistry{
 		Store: s,
-	}, nil
+		Codec: DefaultCodec(),
+	}
+	for _, option := range options {
+		option(vcr)
+	}
+	return vcr, nil
+}
+
+// WithVCCodec used for codec setup of claim types and credentials
+func WithVCCodec(c Codec) func(*VCRegistry) {
+	return func(vcr *VCRegistry) {
+		vcr.Codec = c
+	}
+}
+
+// WithVCEventSink used for emitting state change events to sink
+func WithVCEventSink(sink EventSink) func(*VCRegistry) {
+	return func(vcr *VCRegistry) {
+		vcr.Events = sink
+	}
+}
+
+// WithVCRBAC used for checking permissions of callers by roles in rb
+func WithVCRBAC(rb *RBAC) func(*VCRegistry) {
+	return func(vcr *VCRegistry) {
+		vcr.RBAC = rb
+	}
 }
 
 // CreateClaimTyp creates new claim type
 func (vcr *VCRegistry) CreateClaimTyp(ct *ClaimTyp) (string, error) {
-	ctb, err := ct.Marshal()
+	return vcr.CreateClaimTypContext(context.Background(), ct)
+}
+
+// CreateClaimTypContext is CreateClaimTyp with context
+func (vcr *VCRegistry) CreateClaimTypContext(ctx context.Context, ct *ClaimTyp) (string, error) {
+	if err := checkPermission(ctx, vcr.RBAC, PermAdmin); err != nil {
+		return "", err
+	}
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	ctb, err := encodeRecord(vcr.Codec, ct)
 	if err != nil {
-		return "", fmt.Errorf("claim type marshal: %w", err)
+		return "", &InvalidFormatError{What: "claim type", Reason: ct.ID, Err: err}
 	}
 	vcr.Store.Put(claimKey(ct.ID), ctb)
 	vcr.CTlist = append(vcr.CTlist, ct.ID)
+	if err := emitEvent(ctx, vcr.Events, &Event{Kind: EventClaimTypCreated, VCID: ct.ID}); err != nil {
+		return ct.ID, err
+	}
 	return ct.ID, nil
 }
 
 // GetClaimTyp gets a claim type
 func (vcr *VCRegistry) GetClaimTyp(ctid string) (*ClaimTyp, error) {
+	return vcr.GetClaimTypContext(context.Background(), ctid)
+}
+
+// GetClaimTypContext is GetClaimTyp with context
+func (vcr *VCRegistry) GetClaimTypContext(ctx context.Context, ctid string) (*ClaimTyp, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	if !vcr.Store.Has(claimKey(ctid)) {
-		return nil, nil
+		return nil, &NotFoundError{ID: ctid, Store: "claim types"}
 	}
 	ctb := vcr.Store.Get(claimKey(ctid))
 	c := &ClaimTyp{}
-	err := c.Unmarshal(ctb)
+	err := decodeRecord(ctb, c)
 	if err != nil {
-		return nil, fmt.Errorf("claim type marshal: %w", err)
+		return nil, fmt.Errorf("claim type unmarshal: %w", err)
 	}
 	return c, nil
 }
 
 // DeleteClaimtyp deletes a claim type
 func (vcr *VCRegistry) DeleteClaimtyp(ctid string) {
+	_ = vcr.DeleteClaimtypContext(context.Background(), ctid)
+}
+
+// DeleteClaimtypContext is DeleteClaimtyp with context
+func (vcr *VCRegistry) DeleteClaimtypContext(ctx context.Context, ctid string) error {
+	if err := checkPermission(ctx, vcr.RBAC, PermAdmin); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	vcr.Store.Delete(claimKey(ctid))
 	for i, ct := range vcr.CTlist {
 		if ct == ctid {
 			vcr.CTlist = append(vcr.CTlist[:i], vcr.CTlist[i+1:]...)
 		}
 	}
+	return nil
 }
 
 // GetAllClaimTyps gets all claim types
 func (vcr *VCRegistry) GetAllClaimTyps() ([]*ClaimTyp, error) {
+	return vcr.GetAllClaimTypsContext(context.Background())
+}
+
+// GetAllClaimTypsContext is GetAllClaimTyps with context
+func (vcr *VCRegistry) GetAllClaimTypsContext(ctx context.Context) ([]*ClaimTyp, error) {
 	clist := []*ClaimTyp{}
 	for _, ctid := range vcr.CTlist {
-		ct, err := vcr.GetClaimTyp(ctid)
+		ct, err := vcr.GetClaimTypContext(ctx, ctid)
+		if errors.Is(err, ErrNotFound) { // stale id of CTlist
+			continue
+		}
 		if err != nil {
 			return nil, fmt.Errorf("get claim type: %w", err)
 		}
@@ -122,37 +196,83 @@ func (vcr *VCRegistry) GetAllClaimTyps() ([]*ClaimTyp, error) {
 
 // StoreVC stores a vc
 func (vcr *VCRegistry) StoreVC(c *Credential) (string, error) {
-	cb, err := c.Marshal()
+	return vcr.StoreVCContext(context.Background(), c)
+}
+
+// StoreVCContext is StoreVC with context
+func (vcr *VCRegistry) StoreVCContext(ctx context.Context, c *Credential) (string, error) {
+	if err := checkPermission(ctx, vcr.RBAC, PermIssueVC); err != nil {
+		return "", err
+	}
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	cb, err := encodeRecord(vcr.Codec, c)
 	if err != nil {
-		return "", fmt.Errorf("vc marshal: %w", err)
+		return "", &InvalidFormatError{What: "vc", Reason: c.ID, Err: err}
 	}
 	vcr.Store.Put(vcKey(c.ID), cb)
+	ev := &Event{Kind: EventVCStored, DID: c.Issuer, Type: AccountDIDType, VCID: c.ID}
+	if err := emitEvent(ctx, vcr.Events, ev); err != nil {
+		return c.ID, err
+	}
 	return c.ID, nil
 }
 
 // GetVC gets a vc
 func (vcr *VCRegistry) GetVC(cid string) (*Credential, error) {
+	return vcr.GetVCContext(context.Background(), cid)
+}
+
+// GetVCContext is GetVC with context
+func (vcr *VCRegistry) GetVCContext(ctx context.Context, cid string) (*Credential, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	if !vcr.Store.Has(vcKey(cid)) {
-		return nil, nil
+		return nil, &NotFoundError{ID: cid, Store: "vcs"}
 	}
 	cb := vcr.Store.Get(vcKey(cid))
 	c := &Credential{}
-	err := c.Unmarshal(cb)
+	err := decodeRecord(cb, c)
 	if err != nil {
-		return nil, fmt.Errorf("vc marshal: %w", err)
+		return nil, fmt.Errorf("vc unmarshal: %w", err)
 	}
 	return c, nil
 }
 
 // DeleteVC deletes a vc
 func (vcr *VCRegistry) DeleteVC(cid string) {
+	_ = vcr.DeleteVCContext(context.Background(), cid)
+}
+
+// DeleteVCContext is DeleteVC with context
+func (vcr *VCRegistry) DeleteVCContext(ctx context.Context, cid string) error {
+	if err := checkPermission(ctx, vcr.RBAC, PermIssueVC); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	ev := &Event{Kind: EventVCDeleted, Type: AccountDIDType, VCID: cid}
+	if vcr.Events != nil {
+		if c, err := vcr.GetVCContext(ctx, cid); err == nil {
+			ev.DID = c.Issuer
+		}
+	}
 	vcr.Store.Delete(vcKey(cid))
+	return emitEvent(ctx, vcr.Events, ev)
 }
 
+const (
+	claimPrefix = "claim-"
+	vcPrefix    = "vc-"
+)
+
 func claimKey(id string) []byte {
-	return []byte("claim-" + string(id))
+	return []byte(claimPrefix + string(id))
 }
 
 func vcKey(id string) []byte {
-	return []byte("vc-" + string(id))
+	return []byte(vcPrefix + string(id))
 }
@@ -1,6 +1,7 @@
 package bitxid
 
 import (
+	"errors"
 	"io/ioutil"
 	"testing"
 	"time"
@@ -89,8 +90,8 @@ func testGetAllClaimTyps(t *testing.T, vcr *VCRegistry) {
 func testDeleteClaimtyp(t *testing.T, vcr *VCRegistry) {
 	vcr.DeleteClaimtyp(testCT.ID)
 	ct, err := vcr.GetClaimTyp(testCT.ID)
-	assert.Nil(t, err)
-	assert.Equal(t, ct, (*ClaimTyp)(nil)) // delete successfully
+	assert.True(t, errors.Is(err, ErrNotFound)) // delete successfully
+	assert.Nil(t, ct)
 }
 
 func testStoreVC(t *testing.T, vcr *VCRegistry) {
@@ -108,6 +109,6 @@ func testGetVC(t *testing.T, vcr *VCRegistry) {
 func testDeleteVC(t *testing.T, vcr *VCRegistry) {
 	vcr.DeleteVC(testVC.ID)
 	vc, err := vcr.GetVC(testVC.ID)
-	assert.Nil(t, err)
-	assert.Equal(t, vc, (*Credential)(nil))
+	assert.True(t, errors.Is(err, ErrNotFound))
+	assert.Nil(t, vc)
 }
@@ -0,0 +1,286 @@
+package bitxid
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/meshplus/bitxhub-kit/crypto"
+	"github.com/meshplus/bitxhub-kit/crypto/asym"
+	"github.com/meshplus/bitxhub-kit/types"
+)
+
+// Delegation authorizes a subordinate chain registry for a namespace of
+// sub methods, it is signed by the key of the root registry.
+// A chain did is within namespace ns if its sub method is ns or starts with ns+".".
+type Delegation struct {
+	Parent         DID            `json:"parent"`            // genesis chain did of the root registry
+	Registry       DID            `json:"registry"`          // genesis chain did of the subordinate registry
+	RegistrySigner string         `json:"registry_signer"`   // address of the key of the subordinate signing its items
+	Namespace      string         `json:"namespace"`         // delegated sub method namespace
+	Expires        int64          `json:"expires,omitempty"` // unix nano, 0 means never
+	KeyType        crypto.KeyType `json:"key_type"`
+	Signer         string         `json:"signer"` // address of the signing key
+	Signature      []byte         `json:"signature,omitempty"`
+}
+
+// Digest computes the digest signed by the root registry
+func (d *Delegation) Digest() ([]byte, error) {
+	c := *d
+	c.Signature = nil
+	return digestOf(&c)
+}
+
+// Covers checks whether chain did is within the delegated namespace
+func (d *Delegation) Covers(did DID) bool {
+	if !did.IsValidFormat() || did.GetRootMethod() != d.Parent.GetRootMethod() {
+		return false
+	}
+	return inNamespace(did.GetSubMethod(), d.Namespace)
+}
+
+// Verify verifies that d is signed by signer and not expired at now
+func (d *Delegation) Verify(signer string, now time.Time) error {
+	if d.Signer != signer {
+		return &InvalidFormatError{What: "delegation", Reason: fmt.Sprintf("signed by %s instead of %s", d.Signer, signer)}
+	}
+	if d.Expires != 0 && now.UnixNano() > d.Expires {
+		return &InvalidFormatError{What: "delegation", Reason: fmt.Sprintf("delegation of %s expired", d.Registry)}
+	}
+	digest, err := d.Digest()
+	if err != nil {
+		return fmt.Errorf("delegation digest: %w", err)
+	}
+	return verifySignature("delegation", d.KeyType, signer, digest, d.Signature)
+}
+
+// SignDelegation signs d with key, KeyType and Signer of d are set by it
+func SignDelegation(d *Delegation, key crypto.PrivateKey) error {
+	signer, err := signerOf(key)
+	if err != nil {
+		return fmt.Errorf("delegation signer: %w", err)
+	}
+	d.KeyType = key.Type()
+	d.Signer = signer
+	digest, err := d.Digest()
+	if err != nil {
+		return fmt.Errorf("delegation digest: %w", err)
+	}
+	d.Signature, err = key.Sign(digest)
+	if err != nil {
+		return fmt.Errorf("delegation sign: %w", err)
+	}
+	return nil
+}
+
+// DelegatedItem is a chain item carrying the delegation of the registry
+// it belongs to, signed by the key of that registry. Items of the root
+// registry carry no delegation and are signed by the key of the root.
+// Registries under a hierarchy only synchronize such items.
+type DelegatedItem struct {
+	Item       *ChainItem     `json:"item"`
+	Delegation *Delegation    `json:"delegation,omitempty"`
+	KeyType    crypto.KeyType `json:"key_type"`
+	Signer     string         `json:"signer"` // address of the signing key
+	Signature  []byte         `json:"signature,omitempty"`
+}
+
+// Digest computes the digest signed by the registry of the item
+func (di *DelegatedItem) Digest() ([]byte, error) {
+	c := *di
+	c.Signature = nil
+	return digestOf(&c)
+}
+
+// Marshal marshals delegated item
+func (di *DelegatedItem) Marshal() ([]byte, error) {
+	return Marshal(di)
+}
+
+// Unmarshal unmarshals delegated item
+func (di *DelegatedItem) Unmarshal(data []byte) error {
+	return Unmarshal(data, di)
+}
+
+// GetID gets id of the chain item
+func (di *DelegatedItem) GetID() DID {
+	if di.Item == nil {
+		return ""
+	}
+	return di.Item.ID
+}
+
+// Delegate authorizes the subordinate registry with genesis chain did
+// registry and the key of address registrySigner for namespace, signed by
+// key of the root registry.
+// Only the root registry delegates, and namespaces should not overlap.
+func (r *ChainDIDRegistry) Delegate(registry DID, registrySigner string, namespace string, key crypto.PrivateKey, expires int64) (*Delegation, error) {
+	return r.DelegateContext(context.Background(), registry, registrySigner, namespace, key, expires)
+}
+
+// DelegateContext is Delegate with context
+func (r *ChainDIDRegistry) DelegateContext(ctx context.Context, registry DID, registrySigner string, namespace string, key crypto.PrivateKey, expires int64) (*Delegation, error) {
+	if err := checkPermission(ctx, r.RBAC, PermAdmin); err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	caller, _ := CallerFromContext(ctx)
+	if !r.IsRoot {
+		return nil, &PermissionDeniedError{Caller: caller, Op: "delegate from a non root registry"}
+	}
+	if namespace == "" || strings.Contains(namespace, ":") {
+		return nil, &InvalidFormatError{What: "namespace", Reason: namespace}
+	}
+	if registrySigner == "" {
+		return nil, &InvalidFormatError{What: "delegation", Reason: fmt.Sprintf("no signer of registry %s", registry)}
+	}
+	d := &Delegation{
+		Parent:         r.GenesisChainDID,
+		Registry:       registry,
+		RegistrySigner: registrySigner,
+		Namespace:      namespace,
+		Expires:        expires,
+	}
+	if !d.Covers(registry) || registry.GetType() != int(ChainDIDType) {
+		return nil, &InvalidFormatError{What: "delegation", Reason: fmt.Sprintf("registry %s not within namespace %s", registry, namespace)}
+	}
+	if d.Covers(r.GenesisChainDID) {
+		return nil, &PolicyViolationError{Policy: "hierarchy", Reason: fmt.Sprintf("namespace %s covers the root registry", namespace)}
+	}
+	for _, issued := range r.Delegations {
+		if inNamespace(namespace, issued.Namespace) || inNamespace(issued.Namespace, namespace) {
+			return nil, &AlreadyExistsError{ID: namespace, Store: "delegations"}
+		}
+	}
+	if err := SignDelegation(d, key); err != nil {
+		return nil, err
+	}
+	if d.Signer != r.RootSigner {
+		return nil, &PermissionDeniedError{Caller: caller, Op: fmt.Sprintf("delegate with key %s", d.Signer)}
+	}
+	r.Delegations = append(r.Delegations, d)
+	return d, recordAudit(ctx, r.AuditLog, ActionDelegate, registry, "", "")
+}
+
+// DelegatedItem gets the chain item with the delegation of the registry
+// signed by key for synchronizing it to other registries in the hierarchy,
+// key should be the one of RegistrySigner of the delegation, or the one of
+// the root for the root registry.
+func (r *ChainDIDRegistry) DelegatedItem(chainDID DID, key crypto.PrivateKey) (*DelegatedItem, error) {
+	item, err := r.table().GetItemContext(context.Background(), chainDID, ChainDIDType)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := signerOf(key)
+	if err != nil {
+		return nil, fmt.Errorf("delegated item signer: %w", err)
+	}
+	if expected := r.itemSigner(r.Delegation); signer != expected {
+		return nil, &PermissionDeniedError{Caller: r.GenesisChainDID, Op: fmt.Sprintf("sign items with key %s instead of %s", signer, expected)}
+	}
+	di := &DelegatedItem{Item: item.(*ChainItem), Delegation: r.Delegation, KeyType: key.Type(), Signer: signer}
+	digest, err := di.Digest()
+	if err != nil {
+		return nil, fmt.Errorf("delegated item digest: %w", err)
+	}
+	di.Signature, err = key.Sign(digest)
+	if err != nil {
+		return nil, fmt.Errorf("delegated item sign: %w", err)
+	}
+	return di, nil
+}
+
+// itemSigner gets the address of the key signing items of the registry
+// authorized by d, which is the root if d is nil
+func (r *ChainDIDRegistry) itemSigner(d *Delegation) string {
+	if d == nil {
+		return r.RootSigner
+	}
+	return d.RegistrySigner
+}
+
+// checkNamespace refuses chain dids of the root registry delegated to
+// subordinates, and chain dids out of the namespace of a subordinate
+func (r *ChainDIDRegistry) checkNamespace(caller, chainDID DID) error {
+	if r.Delegation != nil && !r.Delegation.Covers(chainDID) {
+		return &PermissionDeniedError{Caller: caller, Op: fmt.Sprintf("apply for %s out of namespace %s", chainDID, r.Delegation.Namespace)}
+	}
+	for _, d := range r.Delegations {
+		if d.Covers(chainDID) {
+			return &PermissionDeniedError{Caller: caller, Op: fmt.Sprintf("apply for %s delegated to %s", chainDID, d.Registry)}
+		}
+	}
+	return nil
+}
+
+// checkDelegated verifies the delegation carried by a synchronized item
+// and the signature of the registry of the item
+func (r *ChainDIDRegistry) checkDelegated(item TableItem) (*ChainItem, error) {
+	di, ok := item.(*DelegatedItem)
+	if !ok || di.Item == nil {
+		return nil, &InvalidFormatError{What: "synchronized item", Reason: fmt.Sprintf("%s carries no delegation", item.GetID())}
+	}
+	if d := di.Delegation; d != nil {
+		if err := d.Verify(r.RootSigner, time.Now()); err != nil {
+			return nil, err
+		}
+		if !d.Covers(di.Item.ID) {
+			return nil, &PermissionDeniedError{Caller: d.Registry, Op: fmt.Sprintf("synchronize %s out of namespace %s", di.Item.ID, d.Namespace)}
+		}
+	} else {
+		// items of the root are out of delegated namespaces
+		for _, d := range append([]*Delegation{r.Delegation}, r.Delegations...) {
+			if d != nil && d.Covers(di.Item.ID) {
+				return nil, &PermissionDeniedError{Caller: d.Parent, Op: fmt.Sprintf("synchronize %s delegated to %s", di.Item.ID, d.Registry)}
+			}
+		}
+	}
+	if expected := r.itemSigner(di.Delegation); di.Signer != expected {
+		return nil, &InvalidFormatError{What: "synchronized item", Reason: fmt.Sprintf("signed by %s instead of %s", di.Signer, expected)}
+	}
+	digest, err := di.Digest()
+	if err != nil {
+		return nil, fmt.Errorf("delegated item digest: %w", err)
+	}
+	if err := verifySignature("synchronized item", di.KeyType, di.Signer, digest, di.Signature); err != nil {
+		return nil, err
+	}
+	return di.Item, nil
+}
+
+// verifyOwnDelegation verifies the delegation of a subordinate registry
+func (r *ChainDIDRegistry) verifyOwnDelegation() error {
+	d := r.Delegation
+	if err := d.Verify(r.RootSigner, time.Now()); err != nil {
+		return err
+	}
+	if d.Registry != r.GenesisChainDID || !d.Covers(r.GenesisChainDID) {
+		return &InvalidFormatError{What: "delegation", Reason: fmt.Sprintf("delegated to %s instead of %s", d.Registry, r.GenesisChainDID)}
+	}
+	return nil
+}
+
+// signerOf gets the address of key
+func signerOf(key crypto.PrivateKey) (string, error) {
+	addr, err := key.PublicKey().Address()
+	if err != nil {
+		return "", err
+	}
+	return addr.String(), nil
+}
+
+// verifySignature verifies sig of digest signed by the key with address signer
+func verifySignature(what string, typ crypto.KeyType, signer string, digest, sig []byte) error {
+	ok, err := asym.Verify(typ, sig, digest, *types.String2Address(signer))
+	if err != nil || !ok {
+		return &InvalidFormatError{What: what, Reason: "bad signature", Err: err}
+	}
+	return nil
+}
+
+func inNamespace(subMethod, namespace string) bool {
+	return subMethod == namespace || strings.HasPrefix(subMethod, namespace+".")
+}
@@ -0,0 +1,142 @@
+package bitxid
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/meshplus/bitxhub-kit/crypto"
+	"github.com/meshplus/bitxhub-kit/crypto/asym"
+	"github.com/meshplus/bitxhub-kit/storage/leveldb"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	subChainDID  = DID("did:bitxhub:fabric:.")
+	subMemberDID = DID("did:bitxhub:fabric.org1:.")
+	outsideDID   = DID("did:bitxhub:hyperchain:.")
+)
+
+func newRootKey(t *testing.T) (crypto.PrivateKey, string) {
+	key, err := asym.GenerateKeyPair(crypto.ECDSA_P256)
+	assert.Nil(t, err)
+	addr, err := key.PublicKey().Address()
+	assert.Nil(t, err)
+	return key, addr.String()
+}
+
+func newSubChainDID(t *testing.T, d *Delegation, rootSigner string) (*ChainDIDRegistry, string) {
+	dir, err := ioutil.TempDir("", "subChainDID.table")
+	assert.Nil(t, err)
+	s, err := leveldb.New(dir)
+	assert.Nil(t, err)
+	doc := getChainDoc(0)
+	doc.ID = subChainDID
+	mr, err := NewChainDIDRegistry(s, loggerGet(loggerChainDID),
+		WithGenesisChainDocContent(&doc),
+		WithAdmin(admin),
+		WithChainDocStorage(s),
+		WithChainDelegation(d, rootSigner))
+	assert.Nil(t, err)
+	return mr, dir
+}
+
+func TestDelegation(t *testing.T) {
+	root, tablePath, docdbPath := newChainDIDModeInternal(t)
+	defer os.RemoveAll(tablePath)
+	defer os.RemoveAll(docdbPath)
+	key, signer := newRootKey(t)
+	subKey, subSigner := newRootKey(t)
+	WithRootRegistry(signer)(root)
+	testChainDIDSetupGenesSucceed(t, root)
+
+	_, err := root.Delegate(subChainDID, subSigner, "relayroot", key, 0)
+	assert.True(t, errors.Is(err, ErrInvalidFormat))
+	_, err = root.Delegate(DID("did:bitxhub:relayroot.sub:."), subSigner, "relayroot", key, 0)
+	assert.True(t, errors.Is(err, ErrPolicyViolation))
+	otherKey, _ := newRootKey(t)
+	_, err = root.Delegate(subChainDID, subSigner, "fabric", otherKey, 0)
+	assert.True(t, errors.Is(err, ErrPermissionDenied))
+	d, err := root.Delegate(subChainDID, subSigner, "fabric", key, 0)
+	assert.Nil(t, err)
+	assert.Nil(t, d.Verify(signer, time.Now()))
+	assert.True(t, d.Covers(subMemberDID))
+	assert.False(t, d.Covers(DID("did:bitxhub:fabricx:.")))
+	_, err = root.Delegate(subMemberDID, subSigner, "fabric.org1", key, 0)
+	assert.True(t, errors.Is(err, ErrAlreadyExists))
+	// the root no longer applies for delegated chain dids
+	assert.True(t, errors.Is(root.Apply(mcaller, subMemberDID), ErrPermissionDenied))
+
+	sub, subPath := newSubChainDID(t, d, signer)
+	defer os.RemoveAll(subPath)
+	assert.False(t, sub.IsRoot)
+	assert.Nil(t, sub.SetupGenesis())
+	_, err = sub.Delegate(subMemberDID, subSigner, "fabric.org1", key, 0)
+	assert.True(t, errors.Is(err, ErrPermissionDenied))
+	assert.True(t, errors.Is(sub.Apply(mcaller, outsideDID), ErrPermissionDenied))
+	assert.Nil(t, sub.Apply(mcaller, subMemberDID))
+
+	// synchronized to the root with the delegation, signed by the subordinate
+	assert.True(t, errors.Is(root.Synchronize(&ChainItem{BasicItem{ID: subMemberDID}, mcaller}), ErrInvalidFormat))
+	_, err = sub.DelegatedItem(subMemberDID, key)
+	assert.True(t, errors.Is(err, ErrPermissionDenied))
+	di, err := sub.DelegatedItem(subMemberDID, subKey)
+	assert.Nil(t, err)
+	assert.Nil(t, root.Synchronize(di))
+	item, err := root.Table.GetItem(subMemberDID, ChainDIDType)
+	assert.Nil(t, err)
+	assert.Equal(t, ApplyAudit, item.(*ChainItem).Status)
+
+	// the public delegation does not authorize forged items
+	forgedItem := *di
+	forgedItem.Item = &ChainItem{BasicItem{ID: DID("did:bitxhub:fabric.org2:.")}, mcaller}
+	assert.True(t, errors.Is(root.Synchronize(&forgedItem), ErrInvalidFormat))
+	forgedItem.Signer = signer
+	digest, err := forgedItem.Digest()
+	assert.Nil(t, err)
+	forgedItem.Signature, err = key.Sign(digest)
+	assert.Nil(t, err)
+	assert.True(t, errors.Is(root.Synchronize(&forgedItem), ErrInvalidFormat))
+
+	// items out of the namespace are refused
+	di.Item = &ChainItem{BasicItem{ID: outsideDID}, mcaller}
+	assert.True(t, errors.Is(root.Synchronize(di), ErrPermissionDenied))
+	// tampered delegations are refused
+	forged := *d
+	forged.Namespace = "hyperchain"
+	di.Delegation = &forged
+	assert.True(t, errors.Is(root.Synchronize(di), ErrInvalidFormat))
+
+	// items of the root are signed by the root without delegation
+	_, err = root.DelegatedItem(rootChainDID, subKey)
+	assert.True(t, errors.Is(err, ErrPermissionDenied))
+	di, err = root.DelegatedItem(rootChainDID, key)
+	assert.Nil(t, err)
+	assert.Nil(t, di.Delegation)
+	assert.Nil(t, sub.Synchronize(di))
+	assert.True(t, sub.Table.HasItem(rootChainDID))
+	// but not within delegated namespaces
+	di.Item = &ChainItem{BasicItem{ID: subMemberDID}, mcaller}
+	digest, err = di.Digest()
+	assert.Nil(t, err)
+	di.Signature, err = key.Sign(digest)
+	assert.Nil(t, err)
+	assert.True(t, errors.Is(sub.Synchronize(di), ErrPermissionDenied))
+}
+
+func TestDelegationInvalid(t *testing.T) {
+	key, signer := newRootKey(t)
+	_, other := newRootKey(t)
+	d := &Delegation{Parent: rootChainDID, Registry: subChainDID, RegistrySigner: other, Namespace: "fabric", Expires: time.Now().Add(time.Hour).UnixNano()}
+	assert.Nil(t, SignDelegation(d, key))
+	assert.Nil(t, d.Verify(signer, time.Now()))
+	assert.True(t, errors.Is(d.Verify(other, time.Now()), ErrInvalidFormat))
+	assert.True(t, errors.Is(d.Verify(signer, time.Now().Add(2*time.Hour)), ErrInvalidFormat))
+
+	// a subordinate refuses to start with a delegation of others
+	sub, subPath := newSubChainDID(t, d, other)
+	defer os.RemoveAll(subPath)
+	assert.True(t, errors.Is(sub.SetupGenesis(), ErrInvalidFormat))
+}
@@ -0,0 +1,118 @@
+package bitxid
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"strings"
+
+	"github.com/meshplus/bitxhub-kit/crypto"
+)
+
+// DIDKeyMethod is the method of did:key dids
+const DIDKeyMethod = "key"
+
+// multicodec codes of public keys of did:key
+var didKeyCodecs = map[crypto.KeyType]uint64{
+	crypto.Ed25519:    0xed,
+	crypto.Secp256k1:  0xe7,
+	crypto.ECDSA_P256: 0x1200,
+}
+
+// NewDIDKey builds a did:key from a raw public key of typ, which is 32 bytes
+// for Ed25519 and a compressed or uncompressed point for Secp256k1 and ECDSA_P256
+func NewDIDKey(typ crypto.KeyType, pub []byte) (DID, error) {
+	code, ok := didKeyCodecs[typ]
+	if !ok {
+		return "", &InvalidFormatError{What: "did:key", Reason: fmt.Sprintf("unsupported key type %d", typ)}
+	}
+	key, err := normalizeKey(typ, pub)
+	if err != nil {
+		return "", &InvalidFormatError{What: "did:key", Reason: "bad public key", Err: err}
+	}
+	buf := make([]byte, binary.MaxVarintLen64, binary.MaxVarintLen64+len(key))
+	buf = append(buf[:binary.PutUvarint(buf, code)], key...)
+	return DID("did:" + DIDKeyMethod + ":z" + base58Encode(buf)), nil
+}
+
+// DIDKeyFromPublicKey builds a did:key from a public key of bitxhub-kit
+func DIDKeyFromPublicKey(pub crypto.PublicKey) (DID, error) {
+	key, err := verificationKeyOf(pub)
+	if err != nil {
+		return "", &InvalidFormatError{What: "did:key", Reason: "bad public key", Err: err}
+	}
+	return NewDIDKey(key.Type, key.Key)
+}
+
+// ParseDIDKey parses the public key of a did:key,
+// its id is the key id of the expanded doc
+func ParseDIDKey(did DID) (*VerificationKey, error) {
+	msid := did.GetMethodSpecificID()
+	if did.GetMethod() != DIDKeyMethod {
+		return nil, &InvalidFormatError{What: "did:key", Reason: string(did)}
+	}
+	typ, key, err := decodeMultibaseKey(msid)
+	if err != nil {
+		return nil, &InvalidFormatError{What: "did:key", Reason: string(did), Err: err}
+	}
+	return &VerificationKey{ID: string(did) + "#" + msid, Type: typ, Key: key}, nil
+}
+
+// decodeMultibaseKey decodes a base58btc multibase multicodec public key
+func decodeMultibaseKey(s string) (crypto.KeyType, []byte, error) {
+	if !strings.HasPrefix(s, "z") {
+		return 0, nil, fmt.Errorf("multibase %q is not base58btc", s)
+	}
+	data, err := base58Decode(s[1:])
+	if err != nil {
+		return 0, nil, err
+	}
+	code, n := binary.Uvarint(data)
+	if n <= 0 {
+		return 0, nil, fmt.Errorf("bad multicodec")
+	}
+	for typ, c := range didKeyCodecs {
+		if c != code {
+			continue
+		}
+		key, err := normalizeKey(typ, data[n:])
+		if err != nil {
+			return 0, nil, err
+		}
+		return typ, key, nil
+	}
+	return 0, nil, fmt.Errorf("unsupported multicodec 0x%x", code)
+}
+
+// ExpandDIDKey expands a did:key into its doc, which is controlled by
+// itself and authenticated by its only key
+func ExpandDIDKey(did DID) (*BasicDoc, error) {
+	key, err := ParseDIDKey(did)
+	if err != nil {
+		return nil, err
+	}
+	return &BasicDoc{
+		ID:             did,
+		Type:           int(AccountDIDType),
+		Controller:     did,
+		PublicKey:      []PubKey{key.PubKey()},
+		Authentication: []Auth{{PublicKey: []string{key.ID}, Strategy: "1-of-1"}},
+	}, nil
+}
+
+// DIDKeyResolver resolves did:key dids locally, docs are AccountDocs
+type DIDKeyResolver struct{}
+
+var _ Resolver = (*DIDKeyResolver)(nil)
+
+// ResolveDID .
+func (res *DIDKeyResolver) ResolveDID(ctx context.Context, did DID) (*Resolution, error) {
+	if did.GetMethod() != DIDKeyMethod {
+		return nil, &MethodNotSupportedError{Method: did.GetMethod()}
+	}
+	doc, err := ExpandDIDKey(did)
+	if err != nil {
+		return nil, err
+	}
+	return &Resolution{Document: &AccountDoc{BasicDoc: *doc}, Metadata: &DocumentMetadata{Status: Normal}}, nil
+}
@@ -0,0 +1,89 @@
+package bitxid
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/meshplus/bitxhub-kit/crypto"
+	"github.com/meshplus/bitxhub-kit/crypto/asym"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDIDKey(t *testing.T) {
+	digest := sha256.Sum256([]byte("interchain tx"))
+	edPub, edPriv, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(t, err)
+	did, err := NewDIDKey(crypto.Ed25519, edPub)
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(string(did), "did:key:z6Mk"))
+	doc, err := ExpandDIDKey(did)
+	assert.Nil(t, err)
+	assert.Equal(t, did, doc.Controller)
+	assert.Equal(t, string(did)+"#"+did.GetMethodSpecificID(), doc.Authentication[0].PublicKey[0])
+	sig := ed25519.Sign(edPriv, digest[:])
+	assert.Nil(t, doc.VerifyAuthentication(digest[:], []KeySignature{{doc.PublicKey[0].ID, sig}}))
+	again, err := ExpandDIDKey(did)
+	assert.Nil(t, err)
+	assert.Equal(t, doc, again)
+
+	for typ, prefix := range map[crypto.KeyType]string{crypto.Secp256k1: "did:key:zQ3s", crypto.ECDSA_P256: "did:key:zDn"} {
+		key, err := asym.GenerateKeyPair(typ)
+		assert.Nil(t, err)
+		did, err := DIDKeyFromPublicKey(key.PublicKey())
+		assert.Nil(t, err)
+		assert.True(t, strings.HasPrefix(string(did), prefix), did)
+		vk, err := ParseDIDKey(did)
+		assert.Nil(t, err)
+		assert.Equal(t, typ, vk.Type)
+		doc, err := ExpandDIDKey(did)
+		assert.Nil(t, err)
+		sig, err := key.Sign(digest[:])
+		assert.Nil(t, err)
+		assert.Nil(t, doc.VerifyAuthentication(digest[:], []KeySignature{{vk.ID, sig}}))
+	}
+
+	// examples of the did:key specification
+	for did, typ := range map[DID]crypto.KeyType{
+		"did:key:z6MkhaXgBZDvotDkL5257faiztiGiC2QtKLGpbnnEGta2doK":  crypto.Ed25519,
+		"did:key:zQ3shokFTS3brHcDQrn82RUDfCZESWL1ZdCEJwekUDPQiYBme": crypto.Secp256k1,
+		"did:key:zDnaerDaTF5BXEavCrfRZEk316dpbLsfPDZ3WJ5hRTPFU2169": crypto.ECDSA_P256,
+	} {
+		vk, err := ParseDIDKey(did)
+		assert.Nil(t, err, did)
+		if err != nil {
+			continue
+		}
+		assert.Equal(t, typ, vk.Type)
+		built, err := NewDIDKey(typ, vk.Key)
+		assert.Nil(t, err)
+		assert.Equal(t, did, built)
+	}
+
+	for _, did := range []DID{"did:key:abc", "did:web:example.com", "did:key:z0OIl", "did:key:z2J9gaYxrKVpdoG9A4gRnmpnRCcxU6agDtFVVBVdn1JedouoZN7SzcyREXXzWgt3gGiwpoHq7K68X4m32D8HgzG8wv3sY5j7"} {
+		_, err := ParseDIDKey(did)
+		assert.True(t, errors.Is(err, ErrInvalidFormat), did)
+	}
+	_, err = NewDIDKey(crypto.Ed25519, edPub[:16])
+	assert.True(t, errors.Is(err, ErrInvalidFormat))
+	_, err = NewDIDKey(crypto.RSA, edPub)
+	assert.True(t, errors.Is(err, ErrInvalidFormat))
+}
+
+func TestDIDKeyResolver(t *testing.T) {
+	edPub, _, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(t, err)
+	did, err := NewDIDKey(crypto.Ed25519, edPub)
+	assert.Nil(t, err)
+	rt := NewRouter(WithRouterCache(8, 0))
+	assert.Nil(t, rt.Register(DIDKeyMethod, &DIDKeyResolver{}))
+	res, err := rt.ResolveDID(context.Background(), did)
+	assert.Nil(t, err)
+	assert.Equal(t, did, res.Document.GetID())
+	_, err = rt.ResolveDID(context.Background(), "did:key:abc")
+	assert.True(t, errors.Is(err, ErrInvalidFormat))
+}
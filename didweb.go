@@ -0,0 +1,220 @@
+package bitxid
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/meshplus/bitxhub-kit/crypto"
+)
+
+// DIDWebMethod is the method of did:web dids
+const DIDWebMethod = "web"
+
+// DIDWebURL maps a did:web to the url of its doc: did:web:example.com maps to
+// https://example.com/.well-known/did.json, and did:web:example.com:user:alice
+// maps to https://example.com/user/alice/did.json. Ports are encoded as %3A.
+func DIDWebURL(did DID) (string, error) {
+	if did.GetMethod() != DIDWebMethod {
+		return "", &InvalidFormatError{What: "did:web", Reason: string(did)}
+	}
+	segs := strings.Split(did.GetMethodSpecificID(), ":")
+	for i, seg := range segs {
+		s, err := url.PathUnescape(seg)
+		if err != nil || s == "" || s == "." || s == ".." || strings.ContainsAny(s, "/\\@") {
+			return "", &InvalidFormatError{What: "did:web", Reason: fmt.Sprintf("%s: bad segment %q", did, seg), Err: err}
+		}
+		segs[i] = s
+	}
+	if len(segs) == 1 {
+		return "https://" + segs[0] + "/.well-known/did.json", nil
+	}
+	return "https://" + segs[0] + "/" + strings.Join(segs[1:], "/") + "/did.json", nil
+}
+
+// DIDWebResolver resolves did:web dids by fetching their docs,
+// docs are converted to AccountDocs by ParseW3CDoc
+type DIDWebResolver struct {
+	Fetcher DocFetcher
+}
+
+var _ Resolver = (*DIDWebResolver)(nil)
+
+// NewDIDWebResolver news a DIDWebResolver fetching docs by f,
+// f is a HTTPFetcher with default limits if nil
+func NewDIDWebResolver(f DocFetcher) *DIDWebResolver {
+	if f == nil {
+		f = NewHTTPFetcher()
+	}
+	return &DIDWebResolver{Fetcher: f}
+}
+
+// ResolveDID .
+func (res *DIDWebResolver) ResolveDID(ctx context.Context, did DID) (*Resolution, error) {
+	if did.GetMethod() != DIDWebMethod {
+		return nil, &MethodNotSupportedError{Method: did.GetMethod()}
+	}
+	addr, err := DIDWebURL(did)
+	if err != nil {
+		return nil, err
+	}
+	content, err := fetch(ctx, res.Fetcher, addr)
+	if err != nil {
+		return nil, fmt.Errorf("did:web resolve %s: %w", did, err)
+	}
+	doc, err := ParseW3CDoc(content)
+	if err != nil {
+		return nil, err
+	}
+	if doc.ID != did {
+		return nil, &InvalidFormatError{What: "did:web doc", Reason: fmt.Sprintf("doc id %s mismatches %s", doc.ID, did)}
+	}
+	return &Resolution{Document: &AccountDoc{BasicDoc: *doc}, Metadata: &DocumentMetadata{Status: Normal}}, nil
+}
+
+// w3cDoc is a did doc of the W3C DID core data model
+type w3cDoc struct {
+	ID                 DID               `json:"id"`
+	Controller         json.RawMessage   `json:"controller,omitempty"`
+	VerificationMethod []*w3cMethod      `json:"verificationMethod"`
+	PublicKey          []*w3cMethod      `json:"publicKey"` // used by earlier drafts
+	Authentication     []json.RawMessage `json:"authentication"`
+}
+
+type w3cMethod struct {
+	ID                 string            `json:"id"`
+	Type               string            `json:"type"`
+	PublicKeyBase58    string            `json:"publicKeyBase58"`
+	PublicKeyMultibase string            `json:"publicKeyMultibase"`
+	PublicKeyHex       string            `json:"publicKeyHex"`
+	PublicKeyJwk       map[string]string `json:"publicKeyJwk"`
+}
+
+// ParseW3CDoc converts a did doc of the W3C DID core data model to a
+// BasicDoc. Verification methods of unsupported types are dropped, and
+// each authentication method becomes an Auth of strategy 1-of-1.
+func ParseW3CDoc(data []byte) (*BasicDoc, error) {
+	wd := &w3cDoc{}
+	if err := json.Unmarshal(data, wd); err != nil {
+		return nil, &InvalidFormatError{What: "w3c doc", Err: err}
+	}
+	if !wd.ID.IsValid() {
+		return nil, &InvalidFormatError{What: "w3c doc", Reason: fmt.Sprintf("bad id %q", wd.ID)}
+	}
+	doc := &BasicDoc{ID: wd.ID, Type: int(AccountDIDType)}
+	if len(wd.Controller) != 0 {
+		var controllers []DID
+		if err := json.Unmarshal(wd.Controller, &controllers); err != nil {
+			var controller DID
+			if err := json.Unmarshal(wd.Controller, &controller); err != nil {
+				return nil, &InvalidFormatError{What: "w3c doc", Reason: "bad controller", Err: err}
+			}
+			controllers = []DID{controller}
+		}
+		if len(controllers) != 0 {
+			doc.Controller = controllers[0]
+		}
+	}
+	keys := map[string]bool{}
+	addMethod := func(m *w3cMethod) {
+		key, err := m.key(wd.ID)
+		if err != nil || keys[key.ID] {
+			return
+		}
+		keys[key.ID] = true
+		doc.PublicKey = append(doc.PublicKey, key.PubKey())
+	}
+	for _, m := range append(wd.VerificationMethod, wd.PublicKey...) {
+		addMethod(m)
+	}
+	for _, raw := range wd.Authentication {
+		var ref string
+		if err := json.Unmarshal(raw, &ref); err != nil {
+			m := &w3cMethod{}
+			if err := json.Unmarshal(raw, m); err != nil {
+				return nil, &InvalidFormatError{What: "w3c doc", Reason: "bad authentication", Err: err}
+			}
+			addMethod(m)
+			ref = m.ID
+		}
+		if id := absoluteKeyID(wd.ID, ref); keys[id] {
+			doc.Authentication = append(doc.Authentication, Auth{PublicKey: []string{id}, Strategy: "1-of-1"})
+		}
+	}
+	if len(doc.Authentication) == 0 {
+		return nil, &InvalidFormatError{What: "w3c doc", Reason: fmt.Sprintf("%s has no supported authentication", wd.ID)}
+	}
+	return doc, nil
+}
+
+// key parses the public key of m
+func (m *w3cMethod) key(did DID) (*VerificationKey, error) {
+	var (
+		typ crypto.KeyType
+		raw []byte
+		err error
+	)
+	t := strings.ToLower(m.Type)
+	switch {
+	case m.PublicKeyMultibase != "":
+		typ, raw, err = decodeMultibaseKey(m.PublicKeyMultibase)
+		if err != nil && strings.HasPrefix(t, "ed25519") {
+			// Ed25519VerificationKey2018 style keys without multicodec
+			typ = crypto.Ed25519
+			raw, err = base58Decode(strings.TrimPrefix(m.PublicKeyMultibase, "z"))
+		}
+	case m.PublicKeyJwk != nil:
+		typ, raw, err = decodeJWK(m.PublicKeyJwk)
+	default:
+		pk := PubKey{Type: m.Type, PublicKeyPem: m.PublicKeyBase58}
+		if m.PublicKeyHex != "" {
+			pk.PublicKeyPem = m.PublicKeyHex
+		}
+		var key *VerificationKey
+		if key, err = ParsePubKey(pk); err == nil {
+			typ, raw = key.Type, key.Key
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	key, err := normalizeKey(typ, raw)
+	if err != nil {
+		return nil, err
+	}
+	return &VerificationKey{ID: absoluteKeyID(did, m.ID), Type: typ, Key: key}, nil
+}
+
+// decodeJWK decodes an OKP Ed25519 or EC secp256k1 and P-256 JWK
+func decodeJWK(jwk map[string]string) (crypto.KeyType, []byte, error) {
+	x, err := base64.RawURLEncoding.DecodeString(jwk["x"])
+	if err != nil {
+		return 0, nil, err
+	}
+	switch {
+	case jwk["kty"] == "OKP" && jwk["crv"] == "Ed25519":
+		return crypto.Ed25519, x, nil
+	case jwk["kty"] == "EC" && (jwk["crv"] == "secp256k1" || jwk["crv"] == "P-256"):
+		y, err := base64.RawURLEncoding.DecodeString(jwk["y"])
+		if err != nil || len(x) != 32 || len(y) != 32 {
+			return 0, nil, fmt.Errorf("bad %s jwk", jwk["crv"])
+		}
+		point := append(append([]byte{0x04}, x...), y...)
+		if jwk["crv"] == "P-256" {
+			return crypto.ECDSA_P256, point, nil
+		}
+		return crypto.Secp256k1, point, nil
+	}
+	return 0, nil, fmt.Errorf("unsupported jwk %s %s", jwk["kty"], jwk["crv"])
+}
+
+// absoluteKeyID resolves relative key ids like #key-1 against did
+func absoluteKeyID(did DID, id string) string {
+	if strings.HasPrefix(id, "#") {
+		return string(did) + id
+	}
+	return id
+}
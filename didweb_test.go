@@ -0,0 +1,130 @@
+package bitxid
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/meshplus/bitxhub-kit/crypto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDIDWebURL(t *testing.T) {
+	tests := []struct {
+		did string
+		url string
+	}{
+		{"did:web:example.com", "https://example.com/.well-known/did.json"},
+		{"did:web:example.com:user:alice", "https://example.com/user/alice/did.json"},
+		{"did:web:example.com%3A3000:user", "https://example.com:3000/user/did.json"},
+	}
+	for _, tt := range tests {
+		u, err := DIDWebURL(DID(tt.did))
+		assert.Nil(t, err)
+		assert.Equal(t, tt.url, u)
+	}
+	for _, did := range []string{"did:key:z6Mk", "did:web:", "did:web:example.com::a", "did:web:example.com:..", "did:web:example.com:a%2Fb"} {
+		_, err := DIDWebURL(DID(did))
+		assert.True(t, errors.Is(err, ErrInvalidFormat), did)
+	}
+}
+
+func TestDIDWebResolver(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(t, err)
+	docs := map[string]string{}
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		doc, ok := docs[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", MediaTypeDIDJSON)
+		fmt.Fprint(w, doc)
+	}))
+	defer srv.Close()
+	host := strings.Replace(strings.TrimPrefix(srv.URL, "https://"), ":", "%3A", 1)
+	webDID := DID("did:web:" + host)
+	userDID := DID("did:web:" + host + ":user:alice")
+
+	docs["/.well-known/did.json"] = fmt.Sprintf(`{
+		"@context": ["https://www.w3.org/ns/did/v1"],
+		"id": "%s",
+		"verificationMethod": [{
+			"id": "#key-1",
+			"type": "Ed25519VerificationKey2018",
+			"controller": "%[1]s",
+			"publicKeyBase58": "%s"
+		}, {
+			"id": "#key-2",
+			"type": "JsonWebKey2020",
+			"publicKeyJwk": {"kty": "OKP", "crv": "Ed25519", "x": "%s"}
+		}, {
+			"id": "#key-3",
+			"type": "RsaVerificationKey2018",
+			"publicKeyPem": "-----BEGIN PUBLIC KEY-----"
+		}],
+		"authentication": ["#key-1", "#key-3", {
+			"id": "%[1]s#key-4",
+			"type": "Ed25519VerificationKey2020",
+			"publicKeyMultibase": "z%s"
+		}],
+		"assertionMethod": ["#key-2"]
+	}`, webDID, base58Encode(pub), base64.RawURLEncoding.EncodeToString(pub), base58Encode(append([]byte{0xed, 0x01}, pub...)))
+	docs["/user/alice/did.json"] = fmt.Sprintf(`{"id": "%s", "controller": ["%s"], "authentication": [{
+		"id": "#key-1", "type": "Ed25519VerificationKey2018", "publicKeyBase58": "%s"}]}`, userDID, webDID, base58Encode(pub))
+
+	res := NewDIDWebResolver(&HTTPFetcher{Client: srv.Client(), MaxSize: DefaultFetchMaxSize})
+	r, err := res.ResolveDID(context.Background(), webDID)
+	assert.Nil(t, err)
+	assert.Equal(t, Normal, r.Metadata.Status)
+	doc := r.Document.(*AccountDoc)
+	assert.Equal(t, webDID, doc.ID)
+	assert.Equal(t, int(AccountDIDType), doc.Type)
+	assert.Equal(t, 3, len(doc.PublicKey)) // rsa key dropped
+	assert.Equal(t, string(webDID)+"#key-1", doc.PublicKey[0].ID)
+	assert.Equal(t, []Auth{
+		{PublicKey: []string{string(webDID) + "#key-1"}, Strategy: "1-of-1"},
+		{PublicKey: []string{string(webDID) + "#key-4"}, Strategy: "1-of-1"},
+	}, doc.Authentication)
+	key, err := doc.VerificationKey(string(webDID) + "#key-2")
+	assert.Nil(t, err)
+	assert.EqualValues(t, crypto.Ed25519, key.Type)
+
+	digest := sha256.Sum256([]byte("did:web"))
+	sig := ed25519.Sign(priv, digest[:])
+	assert.Nil(t, doc.VerifyAuthentication(digest[:], []KeySignature{{KeyID: string(webDID) + "#key-4", Signature: sig}}))
+	err = doc.VerifyAuthentication(digest[:], []KeySignature{{KeyID: string(webDID) + "#key-2", Signature: sig}})
+	assert.True(t, errors.Is(err, ErrPermissionDenied))
+
+	// path based dids through a router
+	rt := NewRouter()
+	assert.Nil(t, rt.Register(DIDWebMethod, res))
+	r, err = rt.ResolveDID(context.Background(), userDID)
+	assert.Nil(t, err)
+	assert.Equal(t, webDID, r.Document.(*AccountDoc).Controller)
+
+	_, err = res.ResolveDID(context.Background(), DID("did:web:"+host+":user:bob"))
+	assert.True(t, errors.Is(err, ErrNotFound))
+
+	// doc of another did
+	docs["/user/eve/did.json"] = docs["/user/alice/did.json"]
+	_, err = res.ResolveDID(context.Background(), DID("did:web:"+host+":user:eve"))
+	assert.True(t, errors.Is(err, ErrInvalidFormat))
+
+	// doc without supported authentication
+	docs["/user/carol/did.json"] = fmt.Sprintf(`{"id": "did:web:%s:user:carol", "authentication": ["#key-1"]}`, host)
+	_, err = res.ResolveDID(context.Background(), DID("did:web:"+host+":user:carol"))
+	assert.True(t, errors.Is(err, ErrInvalidFormat))
+
+	_, err = res.ResolveDID(context.Background(), rootAccountDID)
+	assert.True(t, errors.Is(err, ErrMethodNotSupported))
+}
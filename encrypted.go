@@ -0,0 +1,376 @@
+package bitxid
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/meshplus/bitxhub-kit/storage"
+)
+
+// Sealed records are envelope encrypted: a random data key encrypts the record
+// and the data key is wrapped by a key of the key ring:
+// sealMagic | sealVersion | len(keyID) | keyID | wrapped data key | nonce | ciphertext
+const (
+	sealMagic     = byte(0xe5)
+	sealVersion   = byte(1)
+	sealDEKSize   = 32
+	sealNonceSize = 12
+	sealTagSize   = 16
+	sealWrapSize  = sealNonceSize + sealDEKSize + sealTagSize
+)
+
+// edocPrefix is the key prefix of encrypted docs, it differs from docPrefix
+// so that tools reading plain records do not touch sealed ones.
+const edocPrefix = "edoc-"
+
+func edocKey(id DID) []byte {
+	return []byte(edocPrefix + string(id))
+}
+
+// KeyRing holds the key encryption keys of an EncryptedDocDB,
+// new records are sealed by the current key.
+type KeyRing struct {
+	keys    map[string][]byte
+	current string
+	lock    sync.RWMutex
+}
+
+// NewKeyRing news a KeyRing with key of id as the current key
+func NewKeyRing(id string, key []byte) (*KeyRing, error) {
+	kr := &KeyRing{keys: make(map[string][]byte)}
+	if err := kr.Rotate(id, key); err != nil {
+		return nil, err
+	}
+	return kr, nil
+}
+
+// Rotate adds key of id and makes it the current key,
+// old keys are kept to open existing records.
+func (kr *KeyRing) Rotate(id string, key []byte) error {
+	if id == "" || len(id) > 255 {
+		return fmt.Errorf("key id length must be in [1, 255]")
+	}
+	if _, err := aes.NewCipher(key); err != nil {
+		return fmt.Errorf("key ring: %w", err)
+	}
+	kr.lock.Lock()
+	defer kr.lock.Unlock()
+	if _, ok := kr.keys[id]; ok {
+		return &AlreadyExistsError{ID: id, Store: "key ring"}
+	}
+	kr.keys[id] = append([]byte{}, key...)
+	kr.current = id
+	return nil
+}
+
+// Remove removes key of id which is not the current key
+func (kr *KeyRing) Remove(id string) error {
+	kr.lock.Lock()
+	defer kr.lock.Unlock()
+	if id == kr.current {
+		return fmt.Errorf("can not remove current key %s", id)
+	}
+	delete(kr.keys, id)
+	return nil
+}
+
+// Current gets id of the current key
+func (kr *KeyRing) Current() string {
+	kr.lock.RLock()
+	defer kr.lock.RUnlock()
+	return kr.current
+}
+
+func (kr *KeyRing) get(id string) (cipher.AEAD, error) {
+	kr.lock.RLock()
+	key, ok := kr.keys[id]
+	kr.lock.RUnlock()
+	if !ok {
+		return nil, &NotFoundError{ID: id, Store: "key ring"}
+	}
+	return newGCM(key)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal encrypts record under the current key, storage key sk is authenticated
+// so that sealed records can not be moved to other keys.
+func (kr *KeyRing) seal(sk, record []byte) ([]byte, error) {
+	keyID := kr.Current()
+	kek, err := kr.get(keyID)
+	if err != nil {
+		return nil, err
+	}
+	dek := make([]byte, sealDEKSize)
+	nonce := make([]byte, 2*sealNonceSize)
+	if _, err := io.ReadFull(rand.Reader, dek); err != nil {
+		return nil, err
+	}
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	dataGCM, err := newGCM(dek)
+	if err != nil {
+		return nil, err
+	}
+
+	sealed := []byte{sealMagic, sealVersion, byte(len(keyID))}
+	sealed = append(sealed, keyID...)
+	sealed = append(sealed, nonce[:sealNonceSize]...)
+	sealed = kek.Seal(sealed, nonce[:sealNonceSize], dek, []byte(keyID))
+	sealed = append(sealed, nonce[sealNonceSize:]...)
+	return dataGCM.Seal(sealed, nonce[sealNonceSize:], record, sk), nil
+}
+
+type sealedRecord struct {
+	keyID      string
+	wrapped    []byte // nonce | wrapped data key
+	nonce      []byte
+	ciphertext []byte
+}
+
+func parseSealed(sealed []byte) (*sealedRecord, error) {
+	if len(sealed) < 3 || sealed[0] != sealMagic {
+		return nil, &InvalidFormatError{What: "sealed record", Reason: "bad magic"}
+	}
+	if sealed[1] != sealVersion {
+		return nil, &InvalidFormatError{What: "sealed record", Reason: fmt.Sprintf("unsupported version %d", sealed[1])}
+	}
+	l := int(sealed[2])
+	if len(sealed) < 3+l+sealWrapSize+sealNonceSize+sealTagSize {
+		return nil, &InvalidFormatError{What: "sealed record", Reason: "too short"}
+	}
+	rest := sealed[3+l:]
+	return &sealedRecord{
+		keyID:      string(sealed[3 : 3+l]),
+		wrapped:    rest[:sealWrapSize],
+		nonce:      rest[sealWrapSize : sealWrapSize+sealNonceSize],
+		ciphertext: rest[sealWrapSize+sealNonceSize:],
+	}, nil
+}
+
+func (kr *KeyRing) unwrap(sr *sealedRecord) ([]byte, error) {
+	kek, err := kr.get(sr.keyID)
+	if err != nil {
+		return nil, err
+	}
+	dek, err := kek.Open(nil, sr.wrapped[:sealNonceSize], sr.wrapped[sealNonceSize:], []byte(sr.keyID))
+	if err != nil {
+		return nil, fmt.Errorf("unwrap data key: %w", err)
+	}
+	return dek, nil
+}
+
+func (kr *KeyRing) open(sk, sealed []byte) ([]byte, error) {
+	sr, err := parseSealed(sealed)
+	if err != nil {
+		return nil, err
+	}
+	dek, err := kr.unwrap(sr)
+	if err != nil {
+		return nil, err
+	}
+	dataGCM, err := newGCM(dek)
+	if err != nil {
+		return nil, err
+	}
+	record, err := dataGCM.Open(nil, sr.nonce, sr.ciphertext, sk)
+	if err != nil {
+		return nil, fmt.Errorf("decrypt record: %w", err)
+	}
+	return record, nil
+}
+
+// rewrap wraps the data key of a sealed record by the current key,
+// the record itself is not encrypted again.
+func (kr *KeyRing) rewrap(sealed []byte) ([]byte, bool, error) {
+	sr, err := parseSealed(sealed)
+	if err != nil {
+		return nil, false, err
+	}
+	keyID := kr.Current()
+	if sr.keyID == keyID {
+		return sealed, false, nil
+	}
+	dek, err := kr.unwrap(sr)
+	if err != nil {
+		return nil, false, err
+	}
+	kek, err := kr.get(keyID)
+	if err != nil {
+		return nil, false, err
+	}
+	nonce := make([]byte, sealNonceSize)
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, false, err
+	}
+	resealed := []byte{sealMagic, sealVersion, byte(len(keyID))}
+	resealed = append(resealed, keyID...)
+	resealed = append(resealed, nonce...)
+	resealed = kek.Seal(resealed, nonce, dek, []byte(keyID))
+	resealed = append(resealed, sr.nonce...)
+	return append(resealed, sr.ciphertext...), true, nil
+}
+
+var _ DocDB = (*EncryptedDocDB)(nil)
+
+// EncryptedDocDB is a DocDB encrypting docs at rest with AES-GCM,
+// docs are hashed by registries before encryption so DocHash is
+// computed over the plaintext doc.
+type EncryptedDocDB struct {
+	BasicAddr string          `json:"basic_addr"`
+	Store     storage.Storage `json:"store"`
+	Keys      *KeyRing        `json:"-"`
+	Codec     Codec           `json:"codec"`
+	Migrator  *Migrator       `json:"-"` // upgrades old docs lazily on read if set
+}
+
+// NewEncryptedDocDB .
+func NewEncryptedDocDB(s storage.Storage, keys *KeyRing) (*EncryptedDocDB, error) {
+	if keys == nil {
+		return nil, fmt.Errorf("encrypted docdb needs a key ring")
+	}
+	return &EncryptedDocDB{
+		Store:     s,
+		Keys:      keys,
+		BasicAddr: ".",
+		Codec:     DefaultCodec(),
+	}, nil
+}
+
+// SetCodec sets the codec used to encode docs
+func (d *EncryptedDocDB) SetCodec(c Codec) {
+	d.Codec = c
+}
+
+// SetMigrator sets the migrator used to upgrade docs on read
+func (d *EncryptedDocDB) SetMigrator(m *Migrator) {
+	d.Migrator = m
+}
+
+// Has .
+func (d *EncryptedDocDB) Has(did DID) bool {
+	return d.Store.Has(edocKey(did))
+}
+
+// Create .
+func (d *EncryptedDocDB) Create(doc Doc) (string, error) {
+	did := doc.GetID()
+	if did == DID("") {
+		return "", &InvalidFormatError{What: "encrypted docdb doc", Reason: "id is null"}
+	}
+	if d.Has(did) {
+		return "", &AlreadyExistsError{ID: string(did), Store: "encrypted docdb"}
+	}
+	return d.put(doc)
+}
+
+// Update .
+func (d *EncryptedDocDB) Update(doc Doc) (string, error) {
+	did := doc.GetID()
+	if did == DID("") {
+		return "", &InvalidFormatError{What: "encrypted docdb doc", Reason: "id is null"}
+	}
+	if !d.Has(did) {
+		return "", &NotFoundError{ID: string(did), Store: "encrypted docdb"}
+	}
+	return d.put(doc)
+}
+
+func (d *EncryptedDocDB) put(doc Doc) (string, error) {
+	record, err := encodeRecord(d.Codec, doc)
+	if err != nil {
+		return "", err
+	}
+	key := edocKey(doc.GetID())
+	sealed, err := d.Keys.seal(key, record)
+	if err != nil {
+		return "", fmt.Errorf("encrypted docdb seal: %w", err)
+	}
+	d.Store.Put(key, sealed)
+	return d.BasicAddr + "/" + string(doc.GetID()), nil
+}
+
+// Get .
+func (d *EncryptedDocDB) Get(did DID, typ DIDType) (Doc, error) {
+	key := edocKey(did)
+	sealed := d.Store.Get(key)
+	if sealed == nil {
+		return nil, &NotFoundError{ID: string(did), Store: "encrypted docdb"}
+	}
+	record, err := d.Keys.open(key, sealed)
+	if err != nil {
+		return nil, fmt.Errorf("encrypted docdb open: %w", err)
+	}
+	if d.Migrator != nil {
+		upgraded, changed, err := d.Migrator.Upgrade(docRecordKind(typ), record)
+		if err != nil {
+			return nil, fmt.Errorf("encrypted docdb migrate doc: %w", err)
+		}
+		if changed {
+			resealed, err := d.Keys.seal(key, upgraded)
+			if err != nil {
+				return nil, fmt.Errorf("encrypted docdb seal: %w", err)
+			}
+			d.Store.Put(key, resealed)
+		}
+		record = upgraded
+	}
+	doc, err := newDoc(typ)
+	if err != nil {
+		return nil, fmt.Errorf("encrypted docdb: %w", err)
+	}
+	if err := decodeRecord(record, doc); err != nil {
+		return nil, fmt.Errorf("encrypted docdb unmarshal doc: %w", err)
+	}
+	return doc, nil
+}
+
+// Rewrap wraps data keys of all docs by the current key of the key ring,
+// after which old keys can be removed. It returns the number of rewrapped docs.
+func (d *EncryptedDocDB) Rewrap() (int, error) {
+	batch := d.Store.NewBatch()
+	count := 0
+	it := d.Store.Prefix([]byte(edocPrefix))
+	for it.Next() {
+		resealed, changed, err := d.Keys.rewrap(it.Value())
+		if err != nil {
+			return 0, fmt.Errorf("encrypted docdb rewrap %s: %w", it.Key(), err)
+		}
+		if changed {
+			batch.Put(append([]byte{}, it.Key()...), resealed)
+			count++
+		}
+	}
+	batch.Commit()
+	return count, nil
+}
+
+// Delete .
+func (d *EncryptedDocDB) Delete(did DID) {
+	d.Store.Delete(edocKey(did))
+}
+
+// backingStore returns the raw store, so snapshots copy docs still encrypted
+func (d *EncryptedDocDB) backingStore() storage.Storage {
+	return d.Store
+}
+
+// Close .
+func (d *EncryptedDocDB) Close() error {
+	err := d.Store.Close()
+	if err != nil {
+		return fmt.Errorf("encrypted docdb store: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package bitxid
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncryptedDocDB(t *testing.T) {
+	s, dir := newTestStorage(t, "encrypted.docdb")
+	defer os.RemoveAll(dir)
+	keys, err := NewKeyRing("k1", bytes.Repeat([]byte{1}, 32))
+	assert.Nil(t, err)
+	db, err := NewEncryptedDocDB(s, keys)
+	assert.Nil(t, err)
+
+	docA := accountDocA
+	_, err = db.Create(&docA)
+	assert.Nil(t, err)
+	raw := s.Get(edocKey(docA.ID))
+	assert.False(t, bytes.Contains(raw, []byte(docA.PublicKey[0].PublicKeyPem)))
+	doc, err := db.Get(docA.ID, AccountDIDType)
+	assert.Nil(t, err)
+	assert.Equal(t, &docA, doc)
+
+	// records are bound to their keys
+	s.Put(edocKey(rootAccountDID), raw)
+	_, err = db.Get(rootAccountDID, AccountDIDType)
+	assert.NotNil(t, err)
+	s.Delete(edocKey(rootAccountDID))
+
+	// tampered records are refused
+	tampered := append([]byte{}, raw...)
+	tampered[len(tampered)-1] ^= 0xff
+	s.Put(edocKey(docA.ID), tampered)
+	_, err = db.Get(docA.ID, AccountDIDType)
+	assert.NotNil(t, err)
+	s.Put(edocKey(docA.ID), raw)
+
+	// rotation: old records are still readable, new ones use the new key
+	assert.Nil(t, keys.Rotate("k2", bytes.Repeat([]byte{2}, 32)))
+	assert.NotNil(t, keys.Remove("k2"))
+	doc, err = db.Get(docA.ID, AccountDIDType)
+	assert.Nil(t, err)
+	assert.Equal(t, &docA, doc)
+
+	n, err := db.Rewrap()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, n)
+	assert.Nil(t, keys.Remove("k1"))
+	doc, err = db.Get(docA.ID, AccountDIDType)
+	assert.Nil(t, err)
+	assert.Equal(t, &docA, doc)
+	n, err = db.Rewrap()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, n)
+
+	_, err = NewKeyRing("k3", []byte{1, 2, 3})
+	assert.NotNil(t, err)
+}
+
+func TestAccountDIDWithEncryptedDocDB(t *testing.T) {
+	ts, tsPath := newTestStorage(t, "did.table")
+	defer os.RemoveAll(tsPath)
+	ds, dsPath := newTestStorage(t, "did.docdb")
+	defer os.RemoveAll(dsPath)
+	keys, err := NewKeyRing("k1", bytes.Repeat([]byte{1}, 32))
+	assert.Nil(t, err)
+	db, err := NewEncryptedDocDB(ds, keys)
+	assert.Nil(t, err)
+
+	loggerInit()
+	r, err := NewAccountDIDRegistry(ts, loggerGet(loggerAccountDID),
+		WithAccountDocDB(db),
+		WithDIDAdmin(rootAccountDID),
+		WithGenesisAccountDocContent(&accountDoc),
+	)
+	assert.Nil(t, err)
+	testSetupDIDSucceed(t, r)
+	// doc hash is computed over the plaintext doc
+	testDIDRegisterSucceedInternal(t, r)
+	testDIDUpdateSucceedInternal(t, r)
+	testDIDResolveSucceedInternal(t, r)
+	assert.False(t, ds.Prefix([]byte(docPrefix)).Next())
+}
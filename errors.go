@@ -0,0 +1,174 @@
+package bitxid
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// sentinel errors of the package, errors returned by tables, docdbs
+// and registries match them by errors.Is
+var (
+	ErrNotFound           = errors.New("not found")
+	ErrAlreadyExists      = errors.New("already exists")
+	ErrInvalidStatus      = errors.New("invalid status")
+	ErrPermissionDenied   = errors.New("permission denied")
+	ErrInvalidFormat      = errors.New("invalid format")
+	ErrPolicyViolation    = errors.New("policy violation")
+	ErrConflict           = errors.New("conflict")
+	ErrMethodNotSupported = errors.New("method not supported")
+)
+
+// NotFoundError represents a missing did, doc or record
+type NotFoundError struct {
+	ID    string
+	Store string // where it is missing, e.g. kvtable
+}
+
+func (e *NotFoundError) Error() string {
+	if e.Store == "" {
+		return fmt.Sprintf("%s not existed", e.ID)
+	}
+	return fmt.Sprintf("key %s not existed in %s", e.ID, e.Store)
+}
+
+// Is makes NotFoundError match ErrNotFound
+func (e *NotFoundError) Is(target error) bool {
+	return target == ErrNotFound
+}
+
+// AlreadyExistsError represents a did, doc or record which already exists
+type AlreadyExistsError struct {
+	ID    string
+	Store string // where it exists, e.g. kvtable
+}
+
+func (e *AlreadyExistsError) Error() string {
+	if e.Store == "" {
+		return fmt.Sprintf("%s already existed", e.ID)
+	}
+	return fmt.Sprintf("key %s already existed in %s", e.ID, e.Store)
+}
+
+// Is makes AlreadyExistsError match ErrAlreadyExists
+func (e *AlreadyExistsError) Is(target error) bool {
+	return target == ErrAlreadyExists
+}
+
+// InvalidStatusError represents an operation on a did under a wrong status
+type InvalidStatusError struct {
+	ID       DID
+	Op       string       // the refused operation, e.g. apply
+	Current  StatusType   // status of the did
+	Expected []StatusType // statuses the operation is allowed under
+}
+
+func (e *InvalidStatusError) Error() string {
+	var msg string
+	if e.Op == "" {
+		msg = fmt.Sprintf("%s is under status: %s", e.ID, e.Current)
+	} else {
+		msg = fmt.Sprintf("can not %s %s under status: %s", e.Op, e.ID, e.Current)
+	}
+	if len(e.Expected) == 0 {
+		return msg
+	}
+	expected := make([]string, 0, len(e.Expected))
+	for _, s := range e.Expected {
+		expected = append(expected, string(s))
+	}
+	return msg + ", expected status: " + strings.Join(expected, " or ")
+}
+
+// Is makes InvalidStatusError match ErrInvalidStatus
+func (e *InvalidStatusError) Is(target error) bool {
+	return target == ErrInvalidStatus
+}
+
+// PermissionDeniedError represents a caller not allowed to do an operation
+type PermissionDeniedError struct {
+	Caller DID
+	Op     string
+}
+
+func (e *PermissionDeniedError) Error() string {
+	return fmt.Sprintf("caller %s has no permission to %s", e.Caller, e.Op)
+}
+
+// Is makes PermissionDeniedError match ErrPermissionDenied
+func (e *PermissionDeniedError) Is(target error) bool {
+	return target == ErrPermissionDenied
+}
+
+// InvalidFormatError represents a malformed did, doc or stored record
+type InvalidFormatError struct {
+	What   string // what is malformed, e.g. chain did
+	Reason string
+	Err    error // underlying error, may be nil
+}
+
+func (e *InvalidFormatError) Error() string {
+	msg := "invalid " + e.What
+	if e.Reason != "" {
+		msg += ": " + e.Reason
+	}
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+// Is makes InvalidFormatError match ErrInvalidFormat
+func (e *InvalidFormatError) Is(target error) bool {
+	return target == ErrInvalidFormat
+}
+
+// Unwrap .
+func (e *InvalidFormatError) Unwrap() error {
+	return e.Err
+}
+
+// PolicyViolationError represents a change refused by a policy of the registry
+type PolicyViolationError struct {
+	Policy string // the violated policy, e.g. admin policy
+	Reason string
+}
+
+func (e *PolicyViolationError) Error() string {
+	return fmt.Sprintf("violate %s: %s", e.Policy, e.Reason)
+}
+
+// Is makes PolicyViolationError match ErrPolicyViolation
+func (e *PolicyViolationError) Is(target error) bool {
+	return target == ErrPolicyViolation
+}
+
+// ConflictError represents a replicated change not matching the local state
+type ConflictError struct {
+	ID     DID
+	Seq    uint64 // sequence number of the change
+	Reason string
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("change %d of %s conflicts: %s", e.Seq, e.ID, e.Reason)
+}
+
+// Is makes ConflictError match ErrConflict
+func (e *ConflictError) Is(target error) bool {
+	return target == ErrConflict
+}
+
+// MethodNotSupportedError represents a did of a method no resolver handles
+type MethodNotSupportedError struct {
+	Method string // method of the did, with the sub method if any
+}
+
+func (e *MethodNotSupportedError) Error() string {
+	return fmt.Sprintf("did method %s not supported", e.Method)
+}
+
+// Is makes MethodNotSupportedError match ErrMethodNotSupported
+func (e *MethodNotSupportedError) Is(target error) bool {
+	return target == ErrMethodNotSupported
+}
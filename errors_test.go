@@ -0,0 +1,112 @@
+package bitxid
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrorsKV(t *testing.T) {
+	s, dir := newTestStorage(t, "errors.store")
+	defer os.RemoveAll(dir)
+	rt, err := NewKVTable(s)
+	assert.Nil(t, err)
+	db, err := NewKVDocDB(s)
+	assert.Nil(t, err)
+
+	_, err = rt.GetItem(chainDID, ChainDIDType)
+	assert.True(t, errors.Is(err, ErrNotFound))
+	nf := &NotFoundError{}
+	assert.True(t, errors.As(err, &nf))
+	assert.Equal(t, string(chainDID), nf.ID)
+	assert.Equal(t, "key did:bitxhub:appchain001:. not existed in kvtable", err.Error())
+
+	item := &ChainItem{BasicItem{ID: chainDID, Status: Normal}, mcaller}
+	assert.Nil(t, rt.CreateItem(item))
+	assert.True(t, errors.Is(rt.CreateItem(item), ErrAlreadyExists))
+	assert.True(t, errors.Is(rt.CreateItem(&ChainItem{}), ErrInvalidFormat))
+
+	_, err = db.Update(&mdocA)
+	assert.True(t, errors.Is(err, ErrNotFound))
+	_, err = db.Create(&mdocA)
+	assert.Nil(t, err)
+	_, err = db.Create(&mdocA)
+	assert.True(t, errors.Is(err, ErrAlreadyExists))
+
+	s.Put(tbKey(chainDID), []byte{recordMagic, 0xff, CurrentSchemaVersion})
+	_, err = rt.GetItem(chainDID, ChainDIDType)
+	assert.True(t, errors.Is(err, ErrInvalidFormat))
+
+	vcr, err := NewVCRegistry(s)
+	assert.Nil(t, err)
+	s.Put(vcKey(testVC.ID), []byte("garbage"))
+	_, err = vcr.GetVC(testVC.ID)
+	assert.True(t, errors.Is(err, ErrInvalidFormat))
+	_, err = vcr.GetVC("missing")
+	assert.True(t, errors.Is(err, ErrNotFound))
+	_, err = vcr.GetClaimTyp("missing")
+	assert.True(t, errors.Is(err, ErrNotFound))
+
+	// stale ids of CTlist are skipped
+	_, err = vcr.CreateClaimTyp(&testCT)
+	assert.Nil(t, err)
+	vcr.CTlist = append(vcr.CTlist, "missing")
+	cts, err := vcr.GetAllClaimTyps()
+	assert.Nil(t, err)
+	assert.Equal(t, []*ClaimTyp{&testCT}, cts)
+}
+
+func TestErrorsChainDID(t *testing.T) {
+	mr, tablePath, docdbPath := newChainDIDModeInternal(t)
+	defer os.RemoveAll(tablePath)
+	defer os.RemoveAll(docdbPath)
+	admins := mr.Admins
+	mr.Admins = nil
+	ife := &InvalidFormatError{}
+	assert.True(t, errors.As(mr.SetupGenesis(), &ife))
+	assert.Equal(t, "genesis", ife.What)
+	mr.Admins = admins
+	testChainDIDSetupGenesSucceed(t, mr)
+
+	assert.True(t, errors.Is(mr.AddAdmin(superAdmin), ErrAlreadyExists))
+	assert.True(t, errors.Is(mr.RemoveAdmin(admin), ErrNotFound))
+	assert.True(t, errors.Is(mr.Apply(mcaller, DID("did:bitxhub")), ErrInvalidFormat))
+	assert.True(t, errors.Is(mr.Freeze(chainDID), ErrNotFound))
+
+	testChainDIDApplySucceed(t, mr)
+	err := mr.Apply(mcaller, chainDID)
+	assert.True(t, errors.Is(err, ErrInvalidStatus))
+	ise := &InvalidStatusError{}
+	assert.True(t, errors.As(err, &ise))
+	assert.Equal(t, ApplyAudit, ise.Current)
+	assert.Equal(t, []StatusType{Initial}, ise.Expected)
+
+	_, _, err = mr.RegisterWithDoc(&mdocA)
+	assert.True(t, errors.Is(err, ErrInvalidStatus))
+	assert.True(t, errors.As(err, &ise))
+	assert.Equal(t, []StatusType{ApplySuccess}, ise.Expected)
+}
+
+func TestErrorsAccountDID(t *testing.T) {
+	r, drtPath, ddbPath := newDIDModeInternal(t)
+	defer os.RemoveAll(drtPath)
+	defer os.RemoveAll(ddbPath)
+	admins := r.Admins
+	r.Admins = nil
+	assert.True(t, errors.Is(r.SetupGenesis(), ErrInvalidFormat))
+	r.Admins = admins
+	testSetupDIDSucceed(t, r)
+
+	_, _, _, err := r.Resolve(testAccountDID)
+	assert.True(t, errors.Is(err, ErrNotFound))
+	_, _, err = r.UpdateWithDoc(&accountDocA)
+	assert.True(t, errors.Is(err, ErrNotFound))
+	_, _, err = r.RegisterWithDoc(&accountDoc)
+	assert.True(t, errors.Is(err, ErrAlreadyExists))
+
+	err = &PermissionDeniedError{Caller: mcaller, Op: "freeze"}
+	assert.True(t, errors.Is(err, ErrPermissionDenied))
+	assert.False(t, errors.Is(err, ErrNotFound))
+}
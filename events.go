@@ -0,0 +1,297 @@
+package bitxid
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/meshplus/bitxhub-kit/storage"
+)
+
+// EventKind .
+type EventKind string
+
+// kinds of registry events
+const (
+	EventApplied         EventKind = "Applied"      // chain did applied
+	EventApplyAudited    EventKind = "ApplyAudited" // chain did application audited
+	EventRegistered      EventKind = "Registered"
+	EventUpdated         EventKind = "Updated"
+	EventAudited         EventKind = "Audited"
+	EventFrozen          EventKind = "Frozen"
+	EventUnFrozen        EventKind = "UnFrozen"
+	EventDeleted         EventKind = "Deleted"
+	EventReplicated      EventKind = "Replicated" // chain did item replicated from a source registry
+	EventClaimTypCreated EventKind = "ClaimTypCreated"
+	EventVCStored        EventKind = "VCStored"
+	EventVCDeleted       EventKind = "VCDeleted"
+)
+
+// Event represents a state change of a registry.
+// For vc events DID is the issuer of the vc.
+type Event struct {
+	Offset    uint64     `json:"offset"` // set by EventLog, starts from 1
+	Kind      EventKind  `json:"kind"`
+	DID       DID        `json:"did"`
+	Type      DIDType    `json:"type"`
+	Status    StatusType `json:"status,omitempty"` // status of the did after the change
+	VCID      string     `json:"vc_id,omitempty"`  // id of the vc or claim type
+	Reason    *Reason    `json:"reason,omitempty"` // reason of admin actions
+	TraceID   string     `json:"trace_id,omitempty"`
+	Timestamp int64      `json:"timestamp"` // unix nano
+}
+
+// EventSink receives events emitted by registries
+type EventSink interface {
+	Emit(ev *Event) error
+}
+
+// MultiSink emits events to all of its sinks in order,
+// put an EventLog first so that others see offsets of events.
+type MultiSink []EventSink
+
+// Emit .
+func (ms MultiSink) Emit(ev *Event) error {
+	for _, sink := range ms {
+		if err := sink.Emit(ev); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// emitEvent stamps ev with time and trace id of ctx then emits it to sink
+func emitEvent(ctx context.Context, sink EventSink, ev *Event) error {
+	if sink == nil {
+		return nil
+	}
+	ev.Timestamp = time.Now().UnixNano()
+	if id, ok := TraceIDFromContext(ctx); ok {
+		ev.TraceID = id
+	}
+	if reason, ok := ReasonFromContext(ctx); ok {
+		ev.Reason = &reason
+	}
+	if err := sink.Emit(ev); err != nil {
+		return fmt.Errorf("emit %s event: %w", ev.Kind, err)
+	}
+	return nil
+}
+
+// EventFilter selects events, empty fields match everything
+type EventFilter struct {
+	DIDs  []DID
+	Types []DIDType
+	Kinds []EventKind
+}
+
+// Match checks whether ev is selected by the filter
+func (f *EventFilter) Match(ev *Event) bool {
+	if len(f.DIDs) != 0 {
+		found := false
+		for _, did := range f.DIDs {
+			if did == ev.DID {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(f.Types) != 0 {
+		found := false
+		for _, typ := range f.Types {
+			if typ == ev.Type {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(f.Kinds) != 0 {
+		found := false
+		for _, kind := range f.Kinds {
+			if kind == ev.Kind {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+var (
+	_ EventSink = (*PubSub)(nil)
+	_ EventSink = (*EventLog)(nil)
+	_ EventSink = MultiSink(nil)
+)
+
+// PubSub is an in-process EventSink delivering events to subscriptions.
+// Emit never blocks: events to a subscription with a full buffer are dropped
+// and counted by the subscription.
+type PubSub struct {
+	subs   map[*Subscription]struct{}
+	closed bool
+	lock   sync.RWMutex
+}
+
+// Subscription receives events selected by its filter from C
+type Subscription struct {
+	C       <-chan *Event
+	ch      chan *Event
+	filter  EventFilter
+	dropped uint64
+	ps      *PubSub
+}
+
+// NewPubSub .
+func NewPubSub() *PubSub {
+	return &PubSub{subs: make(map[*Subscription]struct{})}
+}
+
+// Subscribe subscribes events selected by filter with a buffer of size buffer
+func (ps *PubSub) Subscribe(filter EventFilter, buffer int) *Subscription {
+	ch := make(chan *Event, buffer)
+	sub := &Subscription{C: ch, ch: ch, filter: filter, ps: ps}
+	ps.lock.Lock()
+	defer ps.lock.Unlock()
+	if ps.closed {
+		close(ch)
+		return sub
+	}
+	ps.subs[sub] = struct{}{}
+	return sub
+}
+
+// Emit delivers a copy of ev to every matched subscription
+func (ps *PubSub) Emit(ev *Event) error {
+	ps.lock.RLock()
+	defer ps.lock.RUnlock()
+	for sub := range ps.subs {
+		if !sub.filter.Match(ev) {
+			continue
+		}
+		e := *ev
+		select {
+		case sub.ch <- &e:
+		default:
+			atomic.AddUint64(&sub.dropped, 1)
+		}
+	}
+	return nil
+}
+
+// Close closes all subscriptions, later ones are closed at once
+func (ps *PubSub) Close() {
+	ps.lock.Lock()
+	defer ps.lock.Unlock()
+	for sub := range ps.subs {
+		close(sub.ch)
+	}
+	ps.subs = make(map[*Subscription]struct{})
+	ps.closed = true
+}
+
+// Dropped gets the number of events dropped because of a full buffer
+func (s *Subscription) Dropped() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+// Close unsubscribes and closes C
+func (s *Subscription) Close() {
+	s.ps.lock.Lock()
+	defer s.ps.lock.Unlock()
+	if _, ok := s.ps.subs[s]; ok {
+		delete(s.ps.subs, s)
+		close(s.ch)
+	}
+}
+
+// EventLog is a durable EventSink persisting events under offsets,
+// usually alongside the table of a registry.
+type EventLog struct {
+	Store  storage.Storage
+	Codec  Codec
+	offset uint64 // offset of the last event
+	lock   sync.Mutex
+}
+
+// NewEventLog news an EventLog in s, resuming from the last stored offset.
+// Events are encoded in json by default for consumers in other languages.
+func NewEventLog(s storage.Storage) (*EventLog, error) {
+	l := &EventLog{
+		Store: s,
+		Codec: &JSONCodec{},
+	}
+	it := s.Prefix([]byte(evtPrefix))
+	for it.Next() {
+		var offset uint64
+		if _, err := fmt.Sscanf(string(it.Key()[len(evtPrefix):]), "%d", &offset); err != nil {
+			return nil, &InvalidFormatError{What: "event key", Reason: string(it.Key()), Err: err}
+		}
+		if offset > l.offset {
+			l.offset = offset
+		}
+	}
+	return l, nil
+}
+
+// Emit assigns the next offset to ev and persists it
+func (l *EventLog) Emit(ev *Event) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	ev.Offset = l.offset + 1
+	data, err := encodeRecord(l.Codec, ev)
+	if err != nil {
+		return fmt.Errorf("event marshal: %w", err)
+	}
+	l.Store.Put(evtKey(ev.Offset), data)
+	l.offset = ev.Offset
+	return nil
+}
+
+// LastOffset gets the offset of the last event, 0 if there is none
+func (l *EventLog) LastOffset() uint64 {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.offset
+}
+
+// Read reads at most limit events from offset from (inclusive),
+// limit <= 0 means no limit.
+func (l *EventLog) Read(from uint64, limit int) ([]*Event, error) {
+	if from == 0 {
+		from = 1
+	}
+	it := l.Store.Iterator(evtKey(from), []byte(evtPrefix+"~"))
+	events := []*Event{}
+	for it.Next() {
+		if limit > 0 && len(events) >= limit {
+			break
+		}
+		ev := &Event{}
+		if err := decodeRecord(it.Value(), ev); err != nil {
+			return nil, fmt.Errorf("event unmarshal %s: %w", it.Key(), err)
+		}
+		events = append(events, ev)
+	}
+	return events, nil
+}
+
+func (l *EventLog) backingStore() storage.Storage {
+	return l.Store
+}
+
+const evtPrefix = "evt-"
+
+func evtKey(offset uint64) []byte {
+	return []byte(fmt.Sprintf("%s%020d", evtPrefix, offset))
+}
@@ -0,0 +1,177 @@
+package bitxid
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEventFilter(t *testing.T) {
+	ev := &Event{Kind: EventFrozen, DID: chainDID, Type: ChainDIDType}
+	assert.True(t, (&EventFilter{}).Match(ev))
+	assert.True(t, (&EventFilter{DIDs: []DID{mcaller, chainDID}}).Match(ev))
+	assert.False(t, (&EventFilter{DIDs: []DID{mcaller}}).Match(ev))
+	assert.False(t, (&EventFilter{Types: []DIDType{AccountDIDType}}).Match(ev))
+	assert.True(t, (&EventFilter{Types: []DIDType{ChainDIDType}, Kinds: []EventKind{EventFrozen}}).Match(ev))
+	assert.False(t, (&EventFilter{Kinds: []EventKind{EventDeleted}}).Match(ev))
+}
+
+func TestPubSub(t *testing.T) {
+	ps := NewPubSub()
+	all := ps.Subscribe(EventFilter{}, 10)
+	frozen := ps.Subscribe(EventFilter{Kinds: []EventKind{EventFrozen}}, 1)
+
+	assert.Nil(t, ps.Emit(&Event{Kind: EventFrozen, DID: chainDID}))
+	assert.Nil(t, ps.Emit(&Event{Kind: EventFrozen, DID: mcaller}))
+	assert.Nil(t, ps.Emit(&Event{Kind: EventDeleted, DID: chainDID}))
+	assert.Equal(t, 3, len(all.C))
+	assert.Equal(t, uint64(0), all.Dropped())
+	// a full buffer drops events instead of blocking
+	assert.Equal(t, 1, len(frozen.C))
+	assert.Equal(t, uint64(1), frozen.Dropped())
+	assert.Equal(t, chainDID, (<-frozen.C).DID)
+
+	frozen.Close()
+	frozen.Close()
+	_, ok := <-frozen.C
+	assert.False(t, ok)
+	assert.Nil(t, ps.Emit(&Event{Kind: EventFrozen}))
+	assert.Equal(t, 4, len(all.C))
+
+	ps.Close()
+	for range all.C {
+	}
+	_, ok = <-ps.Subscribe(EventFilter{}, 1).C
+	assert.False(t, ok)
+}
+
+func TestEventLog(t *testing.T) {
+	s, dir := newTestStorage(t, "events.store")
+	defer os.RemoveAll(dir)
+	l, err := NewEventLog(s)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(0), l.LastOffset())
+	for i := 0; i < 12; i++ {
+		assert.Nil(t, l.Emit(&Event{Kind: EventUpdated, DID: chainDID}))
+	}
+	assert.Equal(t, uint64(12), l.LastOffset())
+
+	// resumes from the last offset
+	l, err = NewEventLog(s)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(12), l.LastOffset())
+	ev := &Event{Kind: EventDeleted, DID: chainDID}
+	assert.Nil(t, l.Emit(ev))
+	assert.Equal(t, uint64(13), ev.Offset)
+
+	events, err := l.Read(0, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 13, len(events))
+	for i, ev := range events {
+		assert.Equal(t, uint64(i+1), ev.Offset)
+	}
+	events, err = l.Read(10, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(events))
+	assert.Equal(t, uint64(10), events[0].Offset)
+	events, err = l.Read(13, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(events))
+	assert.Equal(t, EventDeleted, events[0].Kind)
+	events, err = l.Read(14, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(events))
+}
+
+func TestChainDIDEvents(t *testing.T) {
+	mr, tablePath, docdbPath := newChainDIDModeInternal(t)
+	defer os.RemoveAll(tablePath)
+	defer os.RemoveAll(docdbPath)
+	log, err := NewEventLog(mr.Table.(*KVTable).Store)
+	assert.Nil(t, err)
+	ps := NewPubSub()
+	sub := ps.Subscribe(EventFilter{DIDs: []DID{chainDID}}, 16)
+	mr.Events = MultiSink{log, ps}
+
+	testChainDIDSetupGenesSucceed(t, mr)
+	testChainDIDApplySucceed(t, mr)
+	testChainDIDAuditApplySucceed(t, mr)
+	testChainDIDRegisterSucceedInternal(t, mr)
+	testChainDIDUpdateSucceedInternal(t, mr)
+	assert.Nil(t, mr.FreezeContext(ContextWithTraceID(context.Background(), "t1"), chainDID))
+	testChainDIDUnFreezeSucceed(t, mr)
+	testChainDIDDeleteSucceed(t, mr)
+
+	expected := []struct {
+		kind   EventKind
+		status StatusType
+	}{
+		{EventApplied, ApplyAudit},
+		{EventApplyAudited, ApplySuccess},
+		{EventRegistered, Normal},
+		{EventUpdated, Normal},
+		{EventFrozen, Frozen},
+		{EventUnFrozen, Normal},
+		{EventDeleted, Initial},
+	}
+	assert.Equal(t, len(expected), len(sub.C))
+	for _, e := range expected {
+		ev := <-sub.C
+		assert.Equal(t, e.kind, ev.Kind)
+		assert.Equal(t, e.status, ev.Status)
+		assert.Equal(t, ChainDIDType, ev.Type)
+		assert.NotZero(t, ev.Offset)
+		assert.NotZero(t, ev.Timestamp)
+		if ev.Kind == EventFrozen {
+			assert.Equal(t, "t1", ev.TraceID)
+		}
+	}
+
+	// events of the genesis did are logged too
+	events, err := log.Read(0, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 3+len(expected)+1, len(events))
+	assert.Equal(t, mr.GenesisChainDID, events[0].DID)
+	assert.Equal(t, mr.GenesisChainDID, events[len(events)-1].DID)
+	assert.Equal(t, EventDeleted, events[len(events)-1].Kind)
+}
+
+func TestAccountDIDAndVCEvents(t *testing.T) {
+	r, drtPath, ddbPath := newDIDModeInternal(t)
+	defer os.RemoveAll(drtPath)
+	defer os.RemoveAll(ddbPath)
+	ps := NewPubSub()
+	sub := ps.Subscribe(EventFilter{Types: []DIDType{AccountDIDType}}, 16)
+	r.Events = ps
+
+	testSetupDIDSucceed(t, r)
+	testDIDRegisterSucceedInternal(t, r)
+	testDIDFreezeSucceed(t, r)
+	ev := <-sub.C
+	assert.Equal(t, EventRegistered, ev.Kind)
+	assert.Equal(t, r.GenesisAccountDID, ev.DID)
+	ev = <-sub.C
+	assert.Equal(t, EventRegistered, ev.Kind)
+	assert.Equal(t, testAccountDID, ev.DID)
+	ev = <-sub.C
+	assert.Equal(t, EventFrozen, ev.Kind)
+	assert.Equal(t, Frozen, ev.Status)
+
+	s, dir := newTestStorage(t, "vc.store")
+	defer os.RemoveAll(dir)
+	vcr, err := NewVCRegistry(s, WithVCEventSink(ps))
+	assert.Nil(t, err)
+	vcSub := ps.Subscribe(EventFilter{Kinds: []EventKind{EventVCStored, EventVCDeleted}}, 4)
+	_, err = vcr.StoreVC(&testVC)
+	assert.Nil(t, err)
+	vcr.DeleteVC(testVC.ID)
+	ev = <-vcSub.C
+	assert.Equal(t, EventVCStored, ev.Kind)
+	assert.Equal(t, testVC.Issuer, ev.DID)
+	assert.Equal(t, testVC.ID, ev.VCID)
+	ev = <-vcSub.C
+	assert.Equal(t, EventVCDeleted, ev.Kind)
+	assert.Equal(t, testVC.Issuer, ev.DID)
+}
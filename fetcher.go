@@ -0,0 +1,242 @@
+package bitxid
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// DocFetcher fetches doc content from the DocAddr of a table item
+// (used under ExternalDocDB mode).
+type DocFetcher interface {
+	Fetch(addr string) ([]byte, error)
+}
+
+// ContextFetcher is a DocFetcher which can be cancelled by a context,
+// registries use FetchContext when their fetcher implements it.
+type ContextFetcher interface {
+	DocFetcher
+	FetchContext(ctx context.Context, addr string) ([]byte, error)
+}
+
+// default limits of fetchers
+const (
+	DefaultFetchMaxSize = 1 << 20
+	DefaultFetchTimeout = 10 * time.Second
+)
+
+var (
+	_ DocFetcher = (*FileFetcher)(nil)
+	_ DocFetcher = (*HTTPFetcher)(nil)
+	_ DocFetcher = (*CASFetcher)(nil)
+	_ DocFetcher = (*MultiFetcher)(nil)
+
+	_ ContextFetcher = (*HTTPFetcher)(nil)
+	_ ContextFetcher = (*MultiFetcher)(nil)
+)
+
+// FileFetcher fetches docs from file:// addresses
+type FileFetcher struct{}
+
+// Fetch .
+func (f *FileFetcher) Fetch(addr string) ([]byte, error) {
+	u, err := url.Parse(addr)
+	if err != nil {
+		return nil, fmt.Errorf("file fetcher parse %s: %w", addr, err)
+	}
+	if u.Scheme != "file" {
+		return nil, fmt.Errorf("file fetcher unsupported scheme: %s", u.Scheme)
+	}
+	content, err := ioutil.ReadFile(u.Path)
+	if err != nil {
+		return nil, fmt.Errorf("file fetcher read: %w", err)
+	}
+	return content, nil
+}
+
+// HTTPFetcher fetches docs from http:// and https:// addresses,
+// zero values of its fields mean the defaults of NewHTTPFetcher
+type HTTPFetcher struct {
+	Client  *http.Client
+	MaxSize int64 // max size of doc content
+}
+
+var defaultFetchClient = &http.Client{Timeout: DefaultFetchTimeout}
+
+// NewHTTPFetcher news a HTTPFetcher with default timeout and size limit
+func NewHTTPFetcher() *HTTPFetcher {
+	return &HTTPFetcher{
+		Client:  &http.Client{Timeout: DefaultFetchTimeout},
+		MaxSize: DefaultFetchMaxSize,
+	}
+}
+
+// Fetch .
+func (f *HTTPFetcher) Fetch(addr string) ([]byte, error) {
+	return f.FetchContext(context.Background(), addr)
+}
+
+// FetchContext .
+func (f *HTTPFetcher) FetchContext(ctx context.Context, addr string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, addr, nil)
+	if err != nil {
+		return nil, fmt.Errorf("http fetcher request: %w", err)
+	}
+	client, maxSize := f.Client, f.MaxSize
+	if client == nil {
+		client = defaultFetchClient
+	}
+	if maxSize <= 0 {
+		maxSize = DefaultFetchMaxSize
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("http fetcher get: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, &NotFoundError{ID: addr, Store: "http fetcher"}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("http fetcher get %s: %s", addr, resp.Status)
+	}
+	content, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("http fetcher read: %w", err)
+	}
+	if int64(len(content)) > maxSize {
+		return nil, fmt.Errorf("http fetcher: doc of %s exceeds %d bytes", addr, maxSize)
+	}
+	return content, nil
+}
+
+// CASFetcher fetches docs from a CASDocDB,
+// addresses are CIDs with or without the ipfs:// scheme.
+type CASFetcher struct {
+	DB *CASDocDB
+}
+
+// Fetch .
+func (f *CASFetcher) Fetch(addr string) ([]byte, error) {
+	return f.DB.Blob(strings.TrimPrefix(addr, "ipfs://"))
+}
+
+// MultiFetcher dispatches addresses to fetchers by their scheme,
+// addresses without a scheme go to the fetcher of scheme "".
+type MultiFetcher struct {
+	fetchers map[string]DocFetcher
+}
+
+// NewMultiFetcher news a MultiFetcher with file, http and https fetchers registered
+func NewMultiFetcher() *MultiFetcher {
+	hf := NewHTTPFetcher()
+	return &MultiFetcher{
+		fetchers: map[string]DocFetcher{
+			"file":  &FileFetcher{},
+			"http":  hf,
+			"https": hf,
+		},
+	}
+}
+
+// Register registers fetcher f for scheme
+func (f *MultiFetcher) Register(scheme string, df DocFetcher) {
+	f.fetchers[scheme] = df
+}
+
+// Fetch .
+func (f *MultiFetcher) Fetch(addr string) ([]byte, error) {
+	return f.FetchContext(context.Background(), addr)
+}
+
+// FetchContext .
+func (f *MultiFetcher) FetchContext(ctx context.Context, addr string) ([]byte, error) {
+	scheme := ""
+	if i := strings.Index(addr, "://"); i > 0 {
+		scheme = addr[:i]
+	}
+	df, ok := f.fetchers[scheme]
+	if !ok {
+		return nil, fmt.Errorf("no fetcher for scheme %q", scheme)
+	}
+	return fetch(ctx, df, addr)
+}
+
+// fetch fetches addr by f, with ctx if f supports it
+func fetch(ctx context.Context, f DocFetcher, addr string) ([]byte, error) {
+	if cf, ok := f.(ContextFetcher); ok {
+		return cf.FetchContext(ctx, addr)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return f.Fetch(addr)
+}
+
+// docCache caches verified doc contents by doc hash,
+// a nil docCache caches nothing
+type docCache struct {
+	cache *lruCache
+}
+
+func newDocCache() *docCache {
+	return &docCache{cache: newLRUCache(DefaultCacheSize)}
+}
+
+func (c *docCache) get(hash []byte) ([]byte, bool) {
+	if c == nil {
+		return nil, false
+	}
+	v, ok := c.cache.get(hex.EncodeToString(hash))
+	if !ok {
+		return nil, false
+	}
+	return v.([]byte), true
+}
+
+func (c *docCache) put(hash, content []byte) {
+	if c == nil {
+		return
+	}
+	c.cache.add(hex.EncodeToString(hash), content)
+}
+
+// fetchDoc fetches the doc of item, verifies it against the doc hash
+// of item and decodes it by codec c.
+func fetchDoc(ctx context.Context, f DocFetcher, cache *docCache, c Codec, item *BasicItem, typ DIDType) (Doc, error) {
+	if f == nil {
+		return nil, fmt.Errorf("no doc fetcher")
+	}
+	content, ok := cache.get(item.DocHash)
+	if !ok {
+		var err error
+		content, err = fetch(ctx, f, item.DocAddr)
+		if err != nil {
+			return nil, err
+		}
+		hash := sha256.Sum256(content)
+		if !bytes.Equal(hash[:], item.DocHash) {
+			return nil, &InvalidFormatError{What: "doc", Reason: fmt.Sprintf("hash mismatch: expected %x, got %x", item.DocHash, hash)}
+		}
+	}
+	doc, err := newDoc(typ)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.Unmarshal(content, doc); err != nil {
+		return nil, &InvalidFormatError{What: "doc", Err: err}
+	}
+	if doc.GetID() != item.ID {
+		return nil, &InvalidFormatError{What: "doc", Reason: fmt.Sprintf("fetched doc id %s mismatches %s", doc.GetID(), item.ID)}
+	}
+	cache.put(item.DocHash, content)
+	return doc, nil
+}
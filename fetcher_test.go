@@ -0,0 +1,135 @@
+package bitxid
+
+import (
+	"crypto/sha256"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newChainDIDWithFetcher(t *testing.T, f DocFetcher) (*ChainDIDRegistry, string) {
+	mr, tablePath := newChainDIDModeExternal(t)
+	mr.Fetcher = f
+	testChainDIDSetupGenesSucceed(t, mr)
+	testChainDIDAddAdminsSucceed(t, mr)
+	testChainDIDApplySucceed(t, mr)
+	testChainDIDAuditApplySucceed(t, mr)
+	return mr, tablePath
+}
+
+func TestResolveFullFile(t *testing.T) {
+	mr, tablePath := newChainDIDWithFetcher(t, NewMultiFetcher())
+	defer os.RemoveAll(tablePath)
+
+	dir, err := ioutil.TempDir("", "docs")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	content, err := Marshal(mdocA)
+	assert.Nil(t, err)
+	path := filepath.Join(dir, "doc")
+	assert.Nil(t, ioutil.WriteFile(path, content, 0644))
+	hash := sha256.Sum256(content)
+	_, _, err = mr.Register(chainDID, "file://"+path, hash[:])
+	assert.Nil(t, err)
+
+	item, doc, err := mr.ResolveFull(chainDID)
+	assert.Nil(t, err)
+	assert.Equal(t, mcaller, item.Owner)
+	assert.Equal(t, &mdocA, doc)
+
+	// doc cached by hash is not fetched again
+	assert.Nil(t, os.Remove(path))
+	_, doc, err = mr.ResolveFull(chainDID)
+	assert.Nil(t, err)
+	assert.Equal(t, &mdocA, doc)
+
+	// registries not built by the constructor fetch without caching
+	mr.docCache = nil
+	_, _, err = mr.ResolveFull(chainDID)
+	assert.NotNil(t, err)
+}
+
+func TestResolveFullHTTP(t *testing.T) {
+	content, err := Marshal(mdocA)
+	assert.Nil(t, err)
+	hash := sha256.Sum256(content)
+	served := content
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write(served)
+	}))
+	defer srv.Close()
+
+	mr, tablePath := newChainDIDWithFetcher(t, NewMultiFetcher())
+	defer os.RemoveAll(tablePath)
+	_, _, err = mr.Register(chainDID, srv.URL+"/doc", hash[:])
+	assert.Nil(t, err)
+
+	// tampered doc is refused
+	served = append([]byte{}, content...)
+	served[len(served)-1] ^= 0xff
+	_, doc, err := mr.ResolveFull(chainDID)
+	assert.NotNil(t, err)
+	assert.Nil(t, doc)
+
+	served = content
+	_, doc, err = mr.ResolveFull(chainDID)
+	assert.Nil(t, err)
+	assert.Equal(t, &mdocA, doc)
+	_, _, err = mr.ResolveFull(chainDID)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, requests)
+}
+
+func TestHTTPFetcherZeroValue(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/doc" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("doc"))
+	}))
+	defer srv.Close()
+
+	f := &HTTPFetcher{}
+	content, err := f.Fetch(srv.URL + "/doc")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("doc"), content)
+	_, err = f.Fetch(srv.URL + "/missing")
+	assert.True(t, errors.Is(err, ErrNotFound))
+}
+
+func TestResolveFullCAS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cas.docdb")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	db, err := NewCASDocDB(dir)
+	assert.Nil(t, err)
+	docA := mdocA
+	cid, err := db.Create(&docA)
+	assert.Nil(t, err)
+	hash, err := ParseCID(cid)
+	assert.Nil(t, err)
+
+	f := NewMultiFetcher()
+	f.Register("", &CASFetcher{DB: db})
+	f.Register("ipfs", &CASFetcher{DB: db})
+	mr, tablePath := newChainDIDWithFetcher(t, f)
+	defer os.RemoveAll(tablePath)
+	_, _, err = mr.Register(chainDID, cid, hash)
+	assert.Nil(t, err)
+
+	_, doc, err := mr.ResolveFull(chainDID)
+	assert.Nil(t, err)
+	assert.Equal(t, &mdocA, doc)
+
+	_, err = f.Fetch("ftp://" + cid)
+	assert.NotNil(t, err)
+}
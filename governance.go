@@ -0,0 +1,325 @@
+package bitxid
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/meshplus/bitxhub-kit/storage"
+)
+
+// ProposalState .
+type ProposalState string
+
+// states of proposals
+const (
+	ProposalPending  ProposalState = "Pending"
+	ProposalExecuted ProposalState = "Executed"
+	ProposalRejected ProposalState = "Rejected"
+	ProposalExpired  ProposalState = "Expired"
+	ProposalFailed   ProposalState = "Failed" // passed but failed to execute
+)
+
+// default governance config
+const (
+	DefaultGovernanceThreshold = 0.5
+	DefaultProposalTTL         = 7 * 24 * time.Hour
+)
+
+// Vote represents a vote of an admin on a proposal
+type Vote struct {
+	Voter     DID   `json:"voter"`
+	Approve   bool  `json:"approve"`
+	Timestamp int64 `json:"timestamp"` // unix nano
+}
+
+// Proposal represents an admin action waiting for votes of admins
+type Proposal struct {
+	ID       uint64        `json:"id"`
+	Action   AuditAction   `json:"action"`
+	Target   DID           `json:"target"`
+	Result   bool          `json:"result,omitempty"` // result of AuditApply
+	Status   StatusType    `json:"status,omitempty"` // status of Audit
+	Role     Role          `json:"role,omitempty"`   // role of GrantRole and RevokeRole
+	Reason   Reason        `json:"reason"`
+	Proposer DID           `json:"proposer"`
+	Created  int64         `json:"created"`  // unix nano
+	Deadline int64         `json:"deadline"` // unix nano, the proposal expires after it
+	Votes    []Vote        `json:"votes"`
+	State    ProposalState `json:"state"`
+	Error    string        `json:"error,omitempty"` // why the execution failed
+}
+
+// proposalExecutor is a registry whose admin actions are governed
+type proposalExecutor interface {
+	GetAdmins() []DID
+	supportsAction(action AuditAction) bool
+	executeProposal(ctx context.Context, p *Proposal) error
+}
+
+// Governance makes admin actions of a registry go through proposals:
+// admins propose actions and vote on them, a proposal is decided once
+// Quorum admins have voted, and it is executed if more than Threshold
+// of the votes approve it, otherwise it is rejected.
+// Undecided proposals expire after their deadline.
+// Direct admin calls on a governed registry are refused.
+type Governance struct {
+	Store     storage.Storage
+	Quorum    int           // votes needed to decide, <= 0 means a majority of admins
+	Threshold float64       // fraction of votes which should be exceeded by approvals
+	TTL       time.Duration // lifetime of proposals
+	registry  proposalExecutor
+	nextID    uint64
+	now       func() time.Time
+	lock      sync.Mutex
+}
+
+// NewGovernance news a Governance persisting proposals in s
+func NewGovernance(s storage.Storage, options ...func(*Governance)) (*Governance, error) {
+	g := &Governance{
+		Store:     s,
+		Threshold: DefaultGovernanceThreshold,
+		TTL:       DefaultProposalTTL,
+		nextID:    1,
+		now:       time.Now,
+	}
+	for _, option := range options {
+		option(g)
+	}
+	if g.Threshold < 0 || g.Threshold >= 1 {
+		return nil, &InvalidFormatError{What: "governance", Reason: fmt.Sprintf("threshold %v out of [0, 1)", g.Threshold)}
+	}
+	it := s.Prefix([]byte(govPrefix))
+	for it.Next() {
+		p := &Proposal{}
+		if err := decodeRecord(it.Value(), p); err != nil {
+			return nil, fmt.Errorf("governance unmarshal %s: %w", it.Key(), err)
+		}
+		if p.ID >= g.nextID {
+			g.nextID = p.ID + 1
+		}
+	}
+	return g, nil
+}
+
+// WithGovernanceQuorum used for setting the number of votes to decide proposals
+func WithGovernanceQuorum(quorum int) func(*Governance) {
+	return func(g *Governance) {
+		g.Quorum = quorum
+	}
+}
+
+// WithGovernanceThreshold used for setting the fraction of votes approvals should exceed
+func WithGovernanceThreshold(threshold float64) func(*Governance) {
+	return func(g *Governance) {
+		g.Threshold = threshold
+	}
+}
+
+// WithProposalTTL used for setting the lifetime of proposals
+func WithProposalTTL(ttl time.Duration) func(*Governance) {
+	return func(g *Governance) {
+		g.TTL = ttl
+	}
+}
+
+// Propose proposes an admin action, the caller of ctx should be an admin
+// and approves the proposal at once. The returned proposal may be
+// decided already if one vote is enough.
+func (g *Governance) Propose(ctx context.Context, p *Proposal) (*Proposal, error) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	if g.registry == nil {
+		return nil, fmt.Errorf("governance is not bound to a registry")
+	}
+	caller, err := g.checkAdmin(ctx, "propose")
+	if err != nil {
+		return nil, err
+	}
+	if !g.registry.supportsAction(p.Action) {
+		return nil, &InvalidFormatError{What: "proposal", Reason: fmt.Sprintf("unsupported action %s", p.Action)}
+	}
+	now := g.now()
+	prop := *p
+	prop.ID = g.nextID
+	prop.Proposer = caller
+	prop.Created = now.UnixNano()
+	prop.Deadline = now.Add(g.TTL).UnixNano()
+	prop.Votes = []Vote{{Voter: caller, Approve: true, Timestamp: now.UnixNano()}}
+	prop.State = ProposalPending
+	prop.Error = ""
+	g.nextID++
+	return &prop, g.decide(ctx, &prop)
+}
+
+// Vote votes on a pending proposal, the caller of ctx should be an admin
+// who has not voted on it. The proposal is executed once it passes.
+func (g *Governance) Vote(ctx context.Context, id uint64, approve bool) (*Proposal, error) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	if g.registry == nil {
+		return nil, fmt.Errorf("governance is not bound to a registry")
+	}
+	caller, err := g.checkAdmin(ctx, "vote")
+	if err != nil {
+		return nil, err
+	}
+	p, err := g.getProposal(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := g.expire(p); err != nil {
+		return nil, err
+	}
+	if p.State != ProposalPending {
+		return p, fmt.Errorf("vote on proposal %d under state %s: %w", id, p.State, ErrInvalidStatus)
+	}
+	for _, v := range p.Votes {
+		if v.Voter == caller {
+			return p, &AlreadyExistsError{ID: string(caller), Store: fmt.Sprintf("votes of proposal %d", id)}
+		}
+	}
+	p.Votes = append(p.Votes, Vote{Voter: caller, Approve: approve, Timestamp: g.now().UnixNano()})
+	return p, g.decide(ctx, p)
+}
+
+// GetProposal gets a proposal, expired ones are marked so
+func (g *Governance) GetProposal(id uint64) (*Proposal, error) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	p, err := g.getProposal(id)
+	if err != nil {
+		return nil, err
+	}
+	return p, g.expire(p)
+}
+
+// Proposals lists proposals under state, or all proposals if state is empty
+func (g *Governance) Proposals(state ProposalState) ([]*Proposal, error) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	ps := []*Proposal{}
+	it := g.Store.Prefix([]byte(govPrefix))
+	for it.Next() {
+		p := &Proposal{}
+		if err := decodeRecord(it.Value(), p); err != nil {
+			return nil, fmt.Errorf("governance unmarshal %s: %w", it.Key(), err)
+		}
+		if err := g.expire(p); err != nil {
+			return nil, err
+		}
+		if state == "" || p.State == state {
+			ps = append(ps, p)
+		}
+	}
+	return ps, nil
+}
+
+func (g *Governance) checkAdmin(ctx context.Context, op string) (DID, error) {
+	caller, _ := CallerFromContext(ctx)
+	for _, admin := range g.registry.GetAdmins() {
+		if admin == caller {
+			return caller, nil
+		}
+	}
+	return "", &PermissionDeniedError{Caller: caller, Op: op}
+}
+
+// decide tallies votes of p, executes it if it passes, and saves it
+func (g *Governance) decide(ctx context.Context, p *Proposal) error {
+	admins := g.registry.GetAdmins()
+	quorum := g.Quorum
+	if quorum <= 0 {
+		quorum = len(admins)/2 + 1
+	}
+	yes, votes := 0, 0
+	for _, v := range p.Votes {
+		// votes of removed admins are not counted
+		for _, admin := range admins {
+			if admin == v.Voter {
+				votes++
+				if v.Approve {
+					yes++
+				}
+				break
+			}
+		}
+	}
+	var err error
+	if votes >= quorum {
+		if float64(yes) > g.Threshold*float64(votes) {
+			ctx = ContextWithReason(ContextWithCaller(withGovernance(ctx), p.Proposer), p.Reason)
+			if err = g.registry.executeProposal(ctx, p); err != nil {
+				p.State = ProposalFailed
+				p.Error = err.Error()
+				err = fmt.Errorf("execute proposal %d: %w", p.ID, err)
+			} else {
+				p.State = ProposalExecuted
+			}
+		} else {
+			p.State = ProposalRejected
+		}
+	}
+	if serr := g.saveProposal(p); serr != nil {
+		return serr
+	}
+	return err
+}
+
+// expire marks p expired if it is still pending after its deadline
+func (g *Governance) expire(p *Proposal) error {
+	if p.State != ProposalPending || g.now().UnixNano() <= p.Deadline {
+		return nil
+	}
+	p.State = ProposalExpired
+	return g.saveProposal(p)
+}
+
+func (g *Governance) getProposal(id uint64) (*Proposal, error) {
+	data := g.Store.Get(govKey(id))
+	if data == nil {
+		return nil, &NotFoundError{ID: fmt.Sprint(id), Store: "proposals"}
+	}
+	p := &Proposal{}
+	if err := decodeRecord(data, p); err != nil {
+		return nil, fmt.Errorf("governance unmarshal proposal %d: %w", id, err)
+	}
+	return p, nil
+}
+
+func (g *Governance) saveProposal(p *Proposal) error {
+	data, err := encodeRecord(&JSONCodec{}, p)
+	if err != nil {
+		return fmt.Errorf("governance marshal proposal %d: %w", p.ID, err)
+	}
+	g.Store.Put(govKey(p.ID), data)
+	return nil
+}
+
+func (g *Governance) backingStore() storage.Storage {
+	return g.Store
+}
+
+// withGovernance marks ctx as executing a passed proposal or the genesis
+func withGovernance(ctx context.Context) context.Context {
+	return context.WithValue(ctx, governanceKey, true)
+}
+
+// checkGoverned refuses admin actions not made by proposals if g is set
+func checkGoverned(ctx context.Context, g *Governance, action AuditAction) error {
+	if g == nil {
+		return nil
+	}
+	if executing, _ := ctx.Value(governanceKey).(bool); executing {
+		return nil
+	}
+	caller, _ := CallerFromContext(ctx)
+	return &PermissionDeniedError{Caller: caller, Op: string(action) + " without a proposal"}
+}
+
+const govPrefix = "gov-"
+
+func govKey(id uint64) []byte {
+	return []byte(fmt.Sprintf("%s%020d", govPrefix, id))
+}
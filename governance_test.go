@@ -0,0 +1,167 @@
+package bitxid
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var admin2 = DID("did:bitxhub:relayroot:admin2")
+
+func newGovernedChainDID(t *testing.T, options ...func(*Governance)) (*ChainDIDRegistry, *Governance, string) {
+	mr, tablePath := newChainDIDModeExternal(t)
+	g, err := NewGovernance(mr.Table.(*KVTable).Store, options...)
+	assert.Nil(t, err)
+	WithChainGovernance(g)(mr)
+	mr.Admins = append(mr.Admins, admin, admin2)
+	testChainDIDSetupGenesSucceed(t, mr)
+	testChainDIDApplySucceed(t, mr)
+	return mr, g, tablePath
+}
+
+func asAdmin(a DID) context.Context {
+	return ContextWithCaller(context.Background(), a)
+}
+
+func TestGovernanceDirectCallsRefused(t *testing.T) {
+	mr, _, tablePath := newGovernedChainDID(t)
+	defer os.RemoveAll(tablePath)
+
+	assert.True(t, errors.Is(mr.AuditApply(chainDID, true), ErrPermissionDenied))
+	assert.True(t, errors.Is(mr.FreezeContext(asAdmin(superAdmin), rootChainDID), ErrPermissionDenied))
+	assert.True(t, errors.Is(mr.RemoveAdmin(admin), ErrPermissionDenied))
+	assert.True(t, errors.Is(mr.Delete(rootChainDID), ErrPermissionDenied))
+	assert.True(t, mr.HasAdmin(admin))
+	// non admin actions are not governed
+	item, _, _, err := mr.Resolve(chainDID)
+	assert.Nil(t, err)
+	assert.Equal(t, ApplyAudit, item.Status)
+}
+
+func TestGovernanceProposal(t *testing.T) {
+	mr, g, tablePath := newGovernedChainDID(t)
+	defer os.RemoveAll(tablePath)
+
+	_, err := g.Propose(asAdmin(mcaller), &Proposal{Action: ActionAuditApply, Target: chainDID, Result: true})
+	assert.True(t, errors.Is(err, ErrPermissionDenied))
+	_, err = g.Propose(asAdmin(superAdmin), &Proposal{Action: "Rename", Target: chainDID})
+	assert.True(t, errors.Is(err, ErrInvalidFormat))
+
+	reason := Reason{Code: ReasonIncompleteInfo, Comment: "approved after review"}
+	p, err := g.Propose(asAdmin(superAdmin), &Proposal{Action: ActionAuditApply, Target: chainDID, Result: true, Reason: reason})
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(1), p.ID)
+	assert.Equal(t, ProposalPending, p.State)
+	assert.Equal(t, superAdmin, p.Proposer)
+
+	_, err = g.Vote(asAdmin(superAdmin), p.ID, true)
+	assert.True(t, errors.Is(err, ErrAlreadyExists))
+	_, err = g.Vote(asAdmin(mcaller), p.ID, true)
+	assert.True(t, errors.Is(err, ErrPermissionDenied))
+	_, err = g.Vote(asAdmin(admin), 100, true)
+	assert.True(t, errors.Is(err, ErrNotFound))
+
+	// 2 of 3 admins decide, approvals exceed half of the votes
+	p, err = g.Vote(asAdmin(admin), p.ID, true)
+	assert.Nil(t, err)
+	assert.Equal(t, ProposalExecuted, p.State)
+	item, _, _, err := mr.Resolve(chainDID)
+	assert.Nil(t, err)
+	assert.Equal(t, ApplySuccess, item.Status)
+	assert.Equal(t, superAdmin, item.Decisions[0].Caller)
+	assert.Equal(t, reason, item.Decisions[0].Reason)
+
+	_, err = g.Vote(asAdmin(admin2), p.ID, true)
+	assert.True(t, errors.Is(err, ErrInvalidStatus))
+
+	// rejected
+	p, err = g.Propose(asAdmin(admin), &Proposal{Action: ActionRemoveAdmin, Target: superAdmin})
+	assert.Nil(t, err)
+	p, err = g.Vote(asAdmin(superAdmin), p.ID, false)
+	assert.Nil(t, err)
+	assert.Equal(t, ProposalRejected, p.State)
+	assert.True(t, mr.HasAdmin(superAdmin))
+
+	// passed but failed to execute
+	p, err = g.Propose(asAdmin(admin), &Proposal{Action: ActionFreeze, Target: DID("did:bitxhub:nochain:.")})
+	assert.Nil(t, err)
+	p, err = g.Vote(asAdmin(admin2), p.ID, true)
+	assert.True(t, errors.Is(err, ErrNotFound))
+	assert.Equal(t, ProposalFailed, p.State)
+	assert.NotEmpty(t, p.Error)
+
+	// persisted
+	g2, err := NewGovernance(g.Store)
+	assert.Nil(t, err)
+	WithChainGovernance(g2)(mr)
+	ps, err := g2.Proposals("")
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(ps))
+	assert.Equal(t, 2, len(ps[0].Votes))
+	ps, err = g2.Proposals(ProposalRejected)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(ps))
+	p, err = g2.Propose(asAdmin(admin), &Proposal{Action: ActionAddAdmin, Target: mcaller})
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(4), p.ID)
+}
+
+func TestGovernanceQuorumAndExpiry(t *testing.T) {
+	mr, g, tablePath := newGovernedChainDID(t,
+		WithGovernanceQuorum(3),
+		WithGovernanceThreshold(0.6),
+		WithProposalTTL(time.Hour))
+	defer os.RemoveAll(tablePath)
+	now := time.Now()
+	g.now = func() time.Time { return now }
+
+	p, err := g.Propose(asAdmin(superAdmin), &Proposal{Action: ActionAuditApply, Target: chainDID, Result: true})
+	assert.Nil(t, err)
+	p, err = g.Vote(asAdmin(admin), p.ID, true)
+	assert.Nil(t, err)
+	assert.Equal(t, ProposalPending, p.State)
+	// 2 of 3 votes exceed 0.6
+	p, err = g.Vote(asAdmin(admin2), p.ID, false)
+	assert.Nil(t, err)
+	assert.Equal(t, ProposalExecuted, p.State)
+
+	p, err = g.Propose(asAdmin(superAdmin), &Proposal{Action: ActionFreeze, Target: chainDID})
+	assert.Nil(t, err)
+	now = now.Add(2 * time.Hour)
+	_, err = g.Vote(asAdmin(admin), p.ID, true)
+	assert.True(t, errors.Is(err, ErrInvalidStatus))
+	p, err = g.GetProposal(p.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, ProposalExpired, p.State)
+	item, _, _, err := mr.Resolve(chainDID)
+	assert.Nil(t, err)
+	assert.Equal(t, ApplySuccess, item.Status)
+
+	_, err = NewGovernance(g.Store, WithGovernanceThreshold(1))
+	assert.True(t, errors.Is(err, ErrInvalidFormat))
+}
+
+func TestGovernanceAccountDID(t *testing.T) {
+	r, drtPath, ddbPath := newDIDModeInternal(t)
+	defer os.RemoveAll(drtPath)
+	defer os.RemoveAll(ddbPath)
+	g, err := NewGovernance(r.Table.(*KVTable).Store, WithGovernanceQuorum(1))
+	assert.Nil(t, err)
+	WithAccountGovernance(g)(r)
+	testSetupDIDSucceed(t, r)
+	testDIDRegisterSucceedInternal(t, r)
+
+	assert.True(t, errors.Is(r.Freeze(testAccountDID), ErrPermissionDenied))
+	_, err = g.Propose(asAdmin(rootAccountDID), &Proposal{Action: ActionAudit, Target: testAccountDID})
+	assert.True(t, errors.Is(err, ErrInvalidFormat))
+	p, err := g.Propose(asAdmin(rootAccountDID), &Proposal{Action: ActionFreeze, Target: testAccountDID})
+	assert.Nil(t, err)
+	assert.Equal(t, ProposalExecuted, p.State)
+	item, _, _, err := r.Resolve(testAccountDID)
+	assert.Nil(t, err)
+	assert.Equal(t, Frozen, item.Status)
+}
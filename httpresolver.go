@@ -0,0 +1,193 @@
+package bitxid
+
+import (
+	"encoding/json"
+	"errors"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// media types of resolution responses
+const (
+	MediaTypeDIDJSON          = "application/did+json"
+	MediaTypeDIDLDJSON        = "application/did+ld+json"
+	MediaTypeResolutionResult = `application/ld+json;profile="https://w3id.org/did-resolution"`
+
+	didContext        = "https://www.w3.org/ns/did/v1"
+	resolutionContext = "https://w3id.org/did-resolution/v1"
+	resolutionProfile = "https://w3id.org/did-resolution"
+)
+
+// ResolverPath is the path prefix served by ResolverHandler
+const ResolverPath = "/1.0/identifiers/"
+
+// resolution errors
+const (
+	ResolutionInvalidDID                 = "invalidDid"
+	ResolutionNotFound                   = "notFound"
+	ResolutionRepresentationNotSupported = "representationNotSupported"
+	ResolutionMethodNotSupported         = "methodNotSupported"
+	ResolutionInternalError              = "internalError"
+)
+
+// ResolutionResult is the resolution result representation
+type ResolutionResult struct {
+	Context          string                 `json:"@context"`
+	Document         json.RawMessage        `json:"didDocument"`
+	ResolutionMeta   map[string]interface{} `json:"didResolutionMetadata"`
+	DocumentMetadata *DocumentMetadata      `json:"didDocumentMetadata"`
+}
+
+// ResolverHandler serves GET /1.0/identifiers/{did} as a driver of
+// the DIF Universal Resolver, dids are resolved by Resolver.
+type ResolverHandler struct {
+	Resolver Resolver
+}
+
+var _ http.Handler = (*ResolverHandler)(nil)
+
+// NewResolverHandler news a ResolverHandler, use a Router as res
+// for serving both chain dids and account dids
+func NewResolverHandler(res Resolver) *ResolverHandler {
+	return &ResolverHandler{Resolver: res}
+}
+
+// ServeHTTP .
+func (h *ResolverHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !strings.HasPrefix(req.URL.EscapedPath(), ResolverPath) {
+		http.NotFound(w, req)
+		return
+	}
+	raw, err := url.PathUnescape(strings.TrimPrefix(req.URL.EscapedPath(), ResolverPath))
+	if err != nil {
+		writeResolutionError(w, ResolutionInvalidDID, err.Error())
+		return
+	}
+	mediaType, ok := negotiate(req.Header.Get("Accept"))
+	if !ok {
+		writeResolutionError(w, ResolutionRepresentationNotSupported, req.Header.Get("Accept"))
+		return
+	}
+	did := DID(raw)
+	if !did.IsValid() {
+		writeResolutionError(w, ResolutionInvalidDID, raw)
+		return
+	}
+	res, err := h.Resolver.ResolveDID(req.Context(), did)
+	if err != nil {
+		writeResolutionError(w, resolutionError(err), err.Error())
+		return
+	}
+	writeResolution(w, mediaType, res)
+}
+
+// negotiate picks the media type of the response by the Accept header,
+// resolution results are served by default
+func negotiate(accept string) (string, bool) {
+	if strings.TrimSpace(accept) == "" {
+		return MediaTypeResolutionResult, true
+	}
+	for _, part := range strings.Split(accept, ",") {
+		typ, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		switch typ {
+		case MediaTypeDIDJSON, MediaTypeDIDLDJSON:
+			return typ, true
+		case "application/ld+json":
+			if params["profile"] == resolutionProfile {
+				return MediaTypeResolutionResult, true
+			}
+		case "application/json", "application/*", "*/*":
+			return MediaTypeResolutionResult, true
+		}
+	}
+	return "", false
+}
+
+func resolutionError(err error) string {
+	switch {
+	case errors.Is(err, ErrMethodNotSupported):
+		return ResolutionMethodNotSupported
+	case errors.Is(err, ErrNotFound):
+		return ResolutionNotFound
+	case errors.Is(err, ErrInvalidFormat):
+		return ResolutionInvalidDID
+	}
+	return ResolutionInternalError
+}
+
+func resolutionStatus(code string) int {
+	switch code {
+	case ResolutionInvalidDID:
+		return http.StatusBadRequest
+	case ResolutionNotFound:
+		return http.StatusNotFound
+	case ResolutionRepresentationNotSupported:
+		return http.StatusNotAcceptable
+	case ResolutionMethodNotSupported:
+		return http.StatusNotImplemented
+	}
+	return http.StatusInternalServerError
+}
+
+func writeResolution(w http.ResponseWriter, mediaType string, res *Resolution) {
+	docJSON, err := json.Marshal(res.Document)
+	if err == nil && mediaType != MediaTypeDIDJSON {
+		docJSON, err = withJSONLDContext(docJSON)
+	}
+	if err != nil {
+		writeResolutionError(w, ResolutionInternalError, err.Error())
+		return
+	}
+	if mediaType != MediaTypeResolutionResult {
+		w.Header().Set("Content-Type", mediaType)
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write(docJSON)
+		return
+	}
+	writeResolutionResult(w, http.StatusOK, &ResolutionResult{
+		Context:          resolutionContext,
+		Document:         docJSON,
+		ResolutionMeta:   map[string]interface{}{"contentType": MediaTypeDIDLDJSON},
+		DocumentMetadata: res.Metadata,
+	})
+}
+
+func writeResolutionError(w http.ResponseWriter, code, message string) {
+	writeResolutionResult(w, resolutionStatus(code), &ResolutionResult{
+		Context:          resolutionContext,
+		Document:         json.RawMessage("null"),
+		ResolutionMeta:   map[string]interface{}{"error": code, "errorMessage": message},
+		DocumentMetadata: &DocumentMetadata{},
+	})
+}
+
+func writeResolutionResult(w http.ResponseWriter, status int, res *ResolutionResult) {
+	data, err := json.Marshal(res)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", MediaTypeResolutionResult)
+	w.WriteHeader(status)
+	_, _ = w.Write(data)
+}
+
+// withJSONLDContext adds the did context to a json doc
+func withJSONLDContext(docJSON []byte) ([]byte, error) {
+	m := map[string]json.RawMessage{}
+	if err := json.Unmarshal(docJSON, &m); err != nil {
+		return nil, err
+	}
+	m["@context"] = json.RawMessage(`"` + didContext + `"`)
+	return json.Marshal(m)
+}
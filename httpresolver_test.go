@@ -0,0 +1,119 @@
+package bitxid
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func getResolution(t *testing.T, srv *httptest.Server, did, accept string) (*http.Response, []byte) {
+	req, err := http.NewRequest(http.MethodGet, srv.URL+ResolverPath+did, nil)
+	assert.Nil(t, err)
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	assert.Nil(t, err)
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	assert.Nil(t, err)
+	return resp, body
+}
+
+func TestResolverHandler(t *testing.T) {
+	cr, tablePath, docdbPath := newChainDIDModeInternal(t)
+	defer os.RemoveAll(tablePath)
+	defer os.RemoveAll(docdbPath)
+	testChainDIDSetupGenesSucceed(t, cr)
+	ar, drtPath, ddbPath := newDIDModeInternal(t)
+	defer os.RemoveAll(drtPath)
+	defer os.RemoveAll(ddbPath)
+	testSetupDIDSucceed(t, ar)
+
+	rt := NewRouter()
+	assert.Nil(t, rt.Register("bitxhub", cr))
+	assert.Nil(t, rt.Register("bitxhub:appchain001", ar))
+	srv := httptest.NewServer(NewResolverHandler(rt))
+	defer srv.Close()
+
+	// resolution results by default
+	resp, body := getResolution(t, srv, string(rootChainDID), "")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, MediaTypeResolutionResult, resp.Header.Get("Content-Type"))
+	res := &ResolutionResult{}
+	assert.Nil(t, json.Unmarshal(body, res))
+	assert.Equal(t, resolutionContext, res.Context)
+	assert.Equal(t, MediaTypeDIDLDJSON, res.ResolutionMeta["contentType"])
+	assert.NotEmpty(t, res.DocumentMetadata.Status)
+	doc := map[string]interface{}{}
+	assert.Nil(t, json.Unmarshal(res.Document, &doc))
+	assert.Equal(t, string(rootChainDID), doc["id"])
+	assert.Equal(t, didContext, doc["@context"])
+
+	resp, body = getResolution(t, srv, string(rootAccountDID), MediaTypeDIDJSON)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, MediaTypeDIDJSON, resp.Header.Get("Content-Type"))
+	doc = map[string]interface{}{}
+	assert.Nil(t, json.Unmarshal(body, &doc))
+	assert.Equal(t, string(rootAccountDID), doc["id"])
+	assert.Nil(t, doc["@context"])
+
+	resp, body = getResolution(t, srv, string(rootAccountDID), "text/html, "+MediaTypeDIDLDJSON)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, MediaTypeDIDLDJSON, resp.Header.Get("Content-Type"))
+	doc = map[string]interface{}{}
+	assert.Nil(t, json.Unmarshal(body, &doc))
+	assert.Equal(t, didContext, doc["@context"])
+
+	resp, body = getResolution(t, srv, string(rootAccountDID), `application/ld+json;profile="https://w3id.org/did-resolution"`)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	res = &ResolutionResult{}
+	assert.Nil(t, json.Unmarshal(body, res))
+	assert.Equal(t, uint64(1617006461), res.DocumentMetadata.Created)
+}
+
+func TestResolverHandlerErrors(t *testing.T) {
+	cr, tablePath, docdbPath := newChainDIDModeInternal(t)
+	defer os.RemoveAll(tablePath)
+	defer os.RemoveAll(docdbPath)
+	testChainDIDSetupGenesSucceed(t, cr)
+	assert.Nil(t, cr.Apply(mcaller, chainDID))
+
+	srv := httptest.NewServer(NewResolverHandler(cr))
+	defer srv.Close()
+
+	tests := []struct {
+		did    string
+		accept string
+		status int
+		code   string
+	}{
+		{"did:bitxhub:appchain002:.", "", http.StatusNotFound, ResolutionNotFound},
+		{string(chainDID), "", http.StatusNotFound, ResolutionNotFound}, // applied without doc
+		{"not-a-did", "", http.StatusBadRequest, ResolutionInvalidDID},
+		{"did:example:sub:123", "", http.StatusNotImplemented, ResolutionMethodNotSupported},
+		{"did:web:example.com", "", http.StatusNotImplemented, ResolutionMethodNotSupported},
+		{string(rootAccountDID), "", http.StatusNotImplemented, ResolutionMethodNotSupported},
+		{string(rootChainDID), "text/html", http.StatusNotAcceptable, ResolutionRepresentationNotSupported},
+	}
+	for _, tt := range tests {
+		resp, body := getResolution(t, srv, tt.did, tt.accept)
+		assert.Equal(t, tt.status, resp.StatusCode, tt.did)
+		assert.Equal(t, MediaTypeResolutionResult, resp.Header.Get("Content-Type"))
+		res := &ResolutionResult{}
+		assert.Nil(t, json.Unmarshal(body, res))
+		assert.Equal(t, tt.code, res.ResolutionMeta["error"], tt.did)
+		assert.Equal(t, "null", string(res.Document))
+	}
+
+	resp, err := http.Post(srv.URL+ResolverPath+string(rootChainDID), "application/json", strings.NewReader("{}"))
+	assert.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+}
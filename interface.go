@@ -1,5 +1,7 @@
 package bitxid
 
+import "context"
+
 // Doc represents did doc
 type Doc interface {
 	Marshal() ([]byte, error)
@@ -36,6 +38,34 @@ type RegistryTable interface {
 	Close() error
 }
 
+// DocDBContext is DocDB with context
+type DocDBContext interface {
+	CreateContext(ctx context.Context, doc Doc) (string, error)
+	UpdateContext(ctx context.Context, doc Doc) (string, error)
+	GetContext(ctx context.Context, did DID, typ DIDType) (Doc, error)
+	DeleteContext(ctx context.Context, did DID) error
+	HasContext(ctx context.Context, did DID) (bool, error)
+	Close() error
+}
+
+// RegistryTableContext is RegistryTable with context
+type RegistryTableContext interface {
+	CreateItemContext(ctx context.Context, item TableItem) error
+	UpdateItemContext(ctx context.Context, item TableItem) error
+	GetItemContext(ctx context.Context, did DID, typ DIDType) (TableItem, error)
+	HasItemContext(ctx context.Context, did DID) (bool, error)
+	DeleteItemContext(ctx context.Context, did DID) error
+	Close() error
+}
+
+// ProvableTable represents a registry table whose state is committed
+// by a root hash and proved by merkle proofs
+type ProvableTable interface {
+	RegistryTable
+	Root() []byte
+	Prove(did DID) (*MerkleProof, error)
+}
+
 // BasicManager represents basic did management that should be used
 // by other type of did management registry.
 type BasicManager interface {
@@ -65,6 +95,12 @@ type ChainDIDManager interface {
 	Delete(chainDID DID) error
 }
 
+// ChainDIDResolver resolves status of chain dids,
+// Initial is returned for unknown chain dids
+type ChainDIDResolver interface {
+	ChainDIDStatus(ctx context.Context, chainDID DID) (StatusType, error)
+}
+
 // AccountDIDManager represents account did management registry
 type AccountDIDManager interface {
 	BasicManager
@@ -81,6 +117,50 @@ type AccountDIDManager interface {
 	Resolve(did DID) (*AccountItem, *AccountDoc, bool, error)
 }
 
+// BasicManagerContext is BasicManager with context
+type BasicManagerContext interface {
+	SetupGenesisContext(ctx context.Context) error
+	GetSelfID() DID
+	GetAdmins() []DID
+	AddAdminContext(ctx context.Context, caller DID) error
+	RemoveAdminContext(ctx context.Context, caller DID) error
+	HasAdmin(caller DID) bool
+}
+
+// ChainDIDManagerContext is ChainDIDManager with context
+type ChainDIDManagerContext interface {
+	BasicManagerContext
+	HasChainDIDContext(ctx context.Context, chainDID DID) (bool, error)
+
+	ApplyContext(ctx context.Context, caller DID, chainDID DID) error
+	AuditApplyContext(ctx context.Context, chainDID DID, result bool) error
+	AuditContext(ctx context.Context, chainDID DID, status StatusType) error
+	RegisterContext(ctx context.Context, chainDID DID, addr string, hash []byte) (string, []byte, error)
+	RegisterWithDocContext(ctx context.Context, doc Doc) (string, []byte, error)
+	UpdateContext(ctx context.Context, chainDID DID, addr string, hash []byte) (string, []byte, error)
+	UpdateWithDocContext(ctx context.Context, doc Doc) (string, []byte, error)
+	FreezeContext(ctx context.Context, chainDID DID) error
+	UnFreezeContext(ctx context.Context, chainDID DID) error
+	ResolveContext(ctx context.Context, chainDID DID) (*ChainItem, *ChainDoc, bool, error)
+	DeleteContext(ctx context.Context, chainDID DID) error
+}
+
+// AccountDIDManagerContext is AccountDIDManager with context
+type AccountDIDManagerContext interface {
+	BasicManagerContext
+	GetChainDID() DID
+	HasAccountDIDContext(ctx context.Context, did DID) (bool, error)
+
+	RegisterContext(ctx context.Context, did DID, addr string, hash []byte) (string, []byte, error)
+	RegisterWithDocContext(ctx context.Context, doc Doc) (string, []byte, error)
+	UpdateContext(ctx context.Context, did DID, addr string, hash []byte) (string, []byte, error)
+	UpdateWithDocContext(ctx context.Context, doc Doc) (string, []byte, error)
+	FreezeContext(ctx context.Context, did DID) error
+	UnFreezeContext(ctx context.Context, did DID) error
+	DeleteContext(ctx context.Context, did DID) error
+	ResolveContext(ctx context.Context, did DID) (*AccountItem, *AccountDoc, bool, error)
+}
+
 // VCManager interface for verifiable credential management registry
 type VCManager interface {
 	CreateClaimTyp(ct *ClaimTyp) (string, error)
@@ -94,3 +174,15 @@ type VCManager interface {
 	// IssueVC(did DID, claimContent string, claimTye string, signature Sig) ([]byte, error)
 	// RevokeVC(did DID) error
 }
+
+// VCManagerContext is VCManager with context
+type VCManagerContext interface {
+	CreateClaimTypContext(ctx context.Context, ct *ClaimTyp) (string, error)
+	GetClaimTypContext(ctx context.Context, ctid string) (*ClaimTyp, error)
+	DeleteClaimtypContext(ctx context.Context, ctid string) error
+	GetAllClaimTypsContext(ctx context.Context) ([]*ClaimTyp, error)
+
+	StoreVCContext(ctx context.Context, c *Credential) (string, error)
+	GetVCContext(ctx context.Context, cid string) (*Credential, error)
+	DeleteVCContext(ctx context.Context, cid string) error
+}
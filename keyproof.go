@@ -0,0 +1,164 @@
+package bitxid
+
+import (
+	"context"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/meshplus/bitxhub-kit/crypto"
+	"github.com/meshplus/bitxhub-kit/crypto/asym/ecdsa"
+	"github.com/meshplus/bitxhub-kit/types"
+)
+
+// Address computes the bitxhub address of k: the last 20 bytes of the
+// keccak256 hash of the uncompressed point without its 0x04 prefix for
+// ecdsa keys, as bitxhub-kit does, and of the raw key for Ed25519 keys.
+func (k *VerificationKey) Address() (string, error) {
+	var data []byte
+	switch k.Type {
+	case crypto.Ed25519:
+		data = k.Key
+	case crypto.Secp256k1:
+		pub, err := ecdsa.DecompressPubkey(k.Key)
+		if err != nil {
+			return "", err
+		}
+		data = elliptic.Marshal(pub.Curve, pub.X, pub.Y)[1:]
+	case crypto.ECDSA_P256:
+		pub, err := decompressPoint(elliptic.P256(), k.Key)
+		if err != nil {
+			return "", err
+		}
+		data = elliptic.Marshal(pub.Curve, pub.X, pub.Y)[1:]
+	default:
+		return "", &InvalidFormatError{What: "public key", Reason: fmt.Sprintf("unsupported key type %d", k.Type)}
+	}
+	return types.Bytes2Address(ecdsa.Keccak256(data)[12:]).String(), nil
+}
+
+// AddressFromPublicKey computes the bitxhub address of a raw public key of typ
+func AddressFromPublicKey(typ crypto.KeyType, pub []byte) (string, error) {
+	key, err := normalizeKey(typ, pub)
+	if err != nil {
+		return "", &InvalidFormatError{What: "public key", Reason: "bad public key", Err: err}
+	}
+	return (&VerificationKey{Type: typ, Key: key}).Address()
+}
+
+// NewAccountDID builds the account did under chainDID whose address is
+// derived from a raw public key of typ
+func NewAccountDID(chainDID DID, typ crypto.KeyType, pub []byte) (DID, error) {
+	if !chainDID.IsValidFormat() || DIDType(chainDID.GetType()) != ChainDIDType {
+		return "", &InvalidFormatError{What: "chain did", Reason: string(chainDID)}
+	}
+	addr, err := AddressFromPublicKey(typ, pub)
+	if err != nil {
+		return "", err
+	}
+	return DID(strings.TrimSuffix(string(chainDID), ".") + addr), nil
+}
+
+// AccountDIDFromPublicKey builds the account did under chainDID whose
+// address is derived from a public key of bitxhub-kit
+func AccountDIDFromPublicKey(chainDID DID, pub crypto.PublicKey) (DID, error) {
+	key, err := verificationKeyOf(pub)
+	if err != nil {
+		return "", err
+	}
+	return NewAccountDID(chainDID, key.Type, key.Key)
+}
+
+// KeyProof proves the control of the key an account did is derived from
+type KeyProof struct {
+	KeyType   crypto.KeyType `json:"key_type"`
+	PublicKey []byte         `json:"public_key"` // raw Ed25519 key or ecdsa point
+	Signature []byte         `json:"signature"`  // signature of KeyProofDigest
+}
+
+// KeyProofTarget is the registration a key proof is made for, so that the
+// proof can not be used to register other docs or under other registries
+type KeyProofTarget struct {
+	Registry DID    `json:"registry"` // chain did of the registry
+	DID      DID    `json:"did"`
+	DocAddr  string `json:"doc_addr,omitempty"` // empty under InternalDocDB mode
+	DocHash  []byte `json:"doc_hash"`           // HashDoc by the codec of the registry
+}
+
+// KeyProofDigest gets the digest signed by key proofs of t
+func KeyProofDigest(t *KeyProofTarget) []byte {
+	data, _ := json.Marshal(t) // strings and bytes only
+	digest := sha256.Sum256(append([]byte("bitxid key proof:"), data...))
+	return digest[:]
+}
+
+// SignKeyProof signs a key proof of t by a key of bitxhub-kit,
+// Ed25519 keys sign KeyProofDigest themselves.
+func SignKeyProof(t *KeyProofTarget, key crypto.PrivateKey) (*KeyProof, error) {
+	pub, err := verificationKeyOf(key.PublicKey())
+	if err != nil {
+		return nil, err
+	}
+	sig, err := key.Sign(KeyProofDigest(t))
+	if err != nil {
+		return nil, fmt.Errorf("sign key proof: %w", err)
+	}
+	return &KeyProof{KeyType: pub.Type, PublicKey: pub.Key, Signature: sig}, nil
+}
+
+// Verify checks that the address of the did of t is derived from the key
+// of p and the signature of p over t is made by that key
+func (p *KeyProof) Verify(t *KeyProofTarget) error {
+	addr, err := AddressFromPublicKey(p.KeyType, p.PublicKey)
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(addr, t.DID.GetAddress()) {
+		return &InvalidFormatError{What: "key proof", Reason: fmt.Sprintf("%s is not derived from key of address %s", t.DID, addr)}
+	}
+	key, _ := normalizeKey(p.KeyType, p.PublicKey)
+	if !(&VerificationKey{Type: p.KeyType, Key: key}).Verify(KeyProofDigest(t), p.Signature) {
+		return &InvalidFormatError{What: "key proof", Reason: "bad signature"}
+	}
+	return nil
+}
+
+// ContextWithKeyProof returns a copy of ctx carrying the key proof of the
+// did being registered
+func ContextWithKeyProof(ctx context.Context, p *KeyProof) context.Context {
+	return context.WithValue(ctx, keyProofKey, p)
+}
+
+// KeyProofFromContext gets the key proof carried by ctx
+func KeyProofFromContext(ctx context.Context) (*KeyProof, bool) {
+	p, ok := ctx.Value(keyProofKey).(*KeyProof)
+	return p, ok && p != nil
+}
+
+// checkKeyProof checks the key proof of t in ctx,
+// the genesis and passed proposals need no proofs
+func checkKeyProof(ctx context.Context, t *KeyProofTarget) error {
+	if executing, _ := ctx.Value(governanceKey).(bool); executing {
+		return nil
+	}
+	p, ok := KeyProofFromContext(ctx)
+	if !ok {
+		caller, _ := CallerFromContext(ctx)
+		return &PermissionDeniedError{Caller: caller, Op: "register " + string(t.DID) + " without a key proof"}
+	}
+	return p.Verify(t)
+}
+
+// verificationKeyOf gets the VerificationKey of a public key of bitxhub-kit
+func verificationKeyOf(pub crypto.PublicKey) (*VerificationKey, error) {
+	k, ok := pub.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, &InvalidFormatError{What: "public key", Reason: fmt.Sprintf("unsupported public key %T", pub)}
+	}
+	if _, ok := didKeyCodecs[pub.Type()]; !ok {
+		return nil, &InvalidFormatError{What: "public key", Reason: fmt.Sprintf("unsupported key type %d", pub.Type())}
+	}
+	return &VerificationKey{Type: pub.Type(), Key: compressPoint(k.K.X, k.K.Y)}, nil
+}
@@ -0,0 +1,104 @@
+package bitxid
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/meshplus/bitxhub-kit/crypto"
+	"github.com/meshplus/bitxhub-kit/crypto/asym"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAddressFromPublicKey(t *testing.T) {
+	for _, typ := range []crypto.KeyType{crypto.Secp256k1, crypto.ECDSA_P256} {
+		key, err := asym.GenerateKeyPair(typ)
+		assert.Nil(t, err)
+		addr, err := key.PublicKey().Address()
+		assert.Nil(t, err)
+		did, err := AccountDIDFromPublicKey(rootChainDID, key.PublicKey())
+		assert.Nil(t, err)
+		assert.Equal(t, DID("did:bitxhub:relayroot:"+addr.String()), did)
+		assert.Equal(t, AccountDIDType, DIDType(did.GetType()))
+	}
+
+	// the address of the secp256k1 key of accountDoc2
+	pub, err := ParsePubKey(getAccountDoc(2).PublicKey[0])
+	assert.Nil(t, err)
+	addr, err := pub.Address()
+	assert.Nil(t, err)
+	addr2, err := AddressFromPublicKey(crypto.Secp256k1, pub.Key)
+	assert.Nil(t, err)
+	assert.Equal(t, addr, addr2)
+
+	edPub, _, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(t, err)
+	addr, err = AddressFromPublicKey(crypto.Ed25519, edPub)
+	assert.Nil(t, err)
+	assert.Equal(t, 42, len(addr))
+
+	_, err = AddressFromPublicKey(crypto.Ed25519, edPub[1:])
+	assert.True(t, errors.Is(err, ErrInvalidFormat))
+	_, err = NewAccountDID(rootAccountDID, crypto.Ed25519, edPub)
+	assert.True(t, errors.Is(err, ErrInvalidFormat))
+}
+
+func TestKeyProof(t *testing.T) {
+	key, err := asym.GenerateKeyPair(crypto.Secp256k1)
+	assert.Nil(t, err)
+	did, err := AccountDIDFromPublicKey(rootAccountDID.GetChainDID(), key.PublicKey())
+	assert.Nil(t, err)
+	target := &KeyProofTarget{Registry: rootChainDID, DID: did, DocAddr: "/addr", DocHash: []byte{1}}
+	p, err := SignKeyProof(target, key)
+	assert.Nil(t, err)
+	assert.Nil(t, p.Verify(target))
+	assert.True(t, errors.Is(p.Verify(&KeyProofTarget{Registry: rootChainDID, DID: testAccountDID, DocAddr: "/addr", DocHash: []byte{1}}), ErrInvalidFormat))
+	// bound to the doc and the registry
+	assert.True(t, errors.Is(p.Verify(&KeyProofTarget{Registry: rootChainDID, DID: did, DocAddr: "/addr", DocHash: []byte{2}}), ErrInvalidFormat))
+	assert.True(t, errors.Is(p.Verify(&KeyProofTarget{Registry: rootChainDID, DID: did, DocAddr: "/other", DocHash: []byte{1}}), ErrInvalidFormat))
+	assert.True(t, errors.Is(p.Verify(&KeyProofTarget{Registry: chainDID, DID: did, DocAddr: "/addr", DocHash: []byte{1}}), ErrInvalidFormat))
+
+	edPub, edPriv, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(t, err)
+	edDID, err := NewAccountDID(rootAccountDID.GetChainDID(), crypto.Ed25519, edPub)
+	assert.Nil(t, err)
+	edTarget := &KeyProofTarget{Registry: rootChainDID, DID: edDID, DocHash: []byte{1}}
+	edProof := &KeyProof{KeyType: crypto.Ed25519, PublicKey: edPub, Signature: ed25519.Sign(edPriv, KeyProofDigest(edTarget))}
+	assert.Nil(t, edProof.Verify(edTarget))
+
+	r, drtPath, ddbPath := newDIDModeInternal(t)
+	defer os.RemoveAll(drtPath)
+	defer os.RemoveAll(ddbPath)
+	WithAccountKeyProof()(r)
+	testSetupDIDSucceed(t, r) // the genesis needs no proof
+
+	doc := getAccountDoc(2)
+	doc.ID = did
+	_, _, err = r.RegisterWithDoc(&doc)
+	assert.True(t, errors.Is(err, ErrPermissionDenied))
+	_, _, err = r.RegisterWithDocContext(ContextWithKeyProof(context.Background(), edProof), &doc)
+	assert.True(t, errors.Is(err, ErrInvalidFormat))
+	// proofs of other docs
+	_, _, err = r.RegisterWithDocContext(ContextWithKeyProof(context.Background(), p), &doc)
+	assert.True(t, errors.Is(err, ErrInvalidFormat))
+	assert.False(t, r.Table.HasItem(did))
+
+	hash, err := HashDoc(r.Codec, &doc)
+	assert.Nil(t, err)
+	p, err = SignKeyProof(&KeyProofTarget{Registry: r.GetChainDID(), DID: did, DocHash: hash}, key)
+	assert.Nil(t, err)
+	_, _, err = r.RegisterWithDocContext(ContextWithKeyProof(context.Background(), p), &doc)
+	assert.Nil(t, err)
+	assert.True(t, r.Table.HasItem(did))
+	// updates are authorized as before
+	_, _, err = r.UpdateWithDoc(&doc)
+	assert.Nil(t, err)
+	// the proof registers only this doc after deletion
+	assert.Nil(t, r.Delete(did))
+	doc.Service = "changed"
+	_, _, err = r.RegisterWithDocContext(ContextWithKeyProof(context.Background(), p), &doc)
+	assert.True(t, errors.Is(err, ErrInvalidFormat))
+}
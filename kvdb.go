@@ -10,6 +10,8 @@ import (
 type KVDocDB struct {
 	BasicAddr string          `json:"basic_addr"`
 	Store     storage.Storage `json:"store"`
+	Codec     Codec           `json:"codec"`
+	Migrator  *Migrator       `json:"-"` // upgrades old docs lazily on read if set
 }
 
 var _ DocDB = (*KVDocDB)(nil)
@@ -19,11 +21,24 @@ func NewKVDocDB(s storage.Storage) (*KVDocDB, error) {
 	return &KVDocDB{
 		Store:     s,
 		BasicAddr: ".",
+		Codec:     DefaultCodec(),
 	}, nil
 }
 
+// SetCodec sets the codec used to encode docs
+func (d *KVDocDB) SetCodec(c Codec) {
+	d.Codec = c
+}
+
+// SetMigrator sets the migrator used to upgrade docs on read
+func (d *KVDocDB) SetMigrator(m *Migrator) {
+	d.Migrator = m
+}
+
+const docPrefix = "doc-"
+
 func docKey(id DID) []byte {
-	return []byte("doc-" + string(id))
+	return []byte(docPrefix + string(id))
 }
 
 // Has whether db has the item(by key)
@@ -35,13 +50,13 @@ func (d *KVDocDB) Has(did DID) bool {
 func (d *KVDocDB) Create(doc Doc) (string, error) {
 	did := doc.GetID()
 	if did == DID("") {
-		return "", fmt.Errorf("kvdb create doc id is null")
+		return "", &InvalidFormatError{What: "kvdb doc", Reason: "id is null"}
 	}
 	exist := d.Has(did)
 	if exist {
-		return "", fmt.Errorf("item %s already existed in kvdb", did)
+		return "", &AlreadyExistsError{ID: string(did), Store: "kvdb"}
 	}
-	valueBytes, err := doc.Marshal()
+	valueBytes, err := encodeRecord(d.Codec, doc)
 	if err != nil {
 		return "", err
 	}
@@ -53,13 +68,13 @@ func (d *KVDocDB) Create(doc Doc) (string, error) {
 func (d *KVDocDB) Update(doc Doc) (string, error) {
 	did := doc.GetID()
 	if did == DID("") {
-		return "", fmt.Errorf("kvdb update doc id is null")
+		return "", &InvalidFormatError{What: "kvdb doc", Reason: "id is null"}
 	}
 	exist := d.Has(did)
 	if !exist {
-		return "", fmt.Errorf("item %s not existed in kvdb", did)
+		return "", &NotFoundError{ID: string(did), Store: "kvdb"}
 	}
-	valueBytes, err := doc.Marshal()
+	valueBytes, err := encodeRecord(d.Codec, doc)
 	if err != nil {
 		return "", err
 	}
@@ -71,26 +86,29 @@ func (d *KVDocDB) Update(doc Doc) (string, error) {
 func (d *KVDocDB) Get(did DID, typ DIDType) (Doc, error) {
 	exist := d.Has(did)
 	if !exist {
-		return nil, fmt.Errorf("key %s not existed in kvdb", did)
+		return nil, &NotFoundError{ID: string(did), Store: "kvdb"}
+	}
+	valueBytes, err := migrateOnRead(d.Migrator, d.Store, docKey(did), docRecordKind(typ), d.Store.Get(docKey(did)))
+	if err != nil {
+		return nil, fmt.Errorf("kvdb migrate doc: %w", err)
 	}
-	valueBytes := d.Store.Get(docKey(did))
 	switch typ {
 	case AccountDIDType:
 		dt := &AccountDoc{}
-		err := dt.Unmarshal(valueBytes)
+		err := decodeRecord(valueBytes, dt)
 		if err != nil {
 			return nil, fmt.Errorf("kvdb unmarshal did doc: %w", err)
 		}
 		return dt, nil
 	case ChainDIDType:
 		mt := &ChainDoc{}
-		err := mt.Unmarshal(valueBytes)
+		err := decodeRecord(valueBytes, mt)
 		if err != nil {
 			return nil, fmt.Errorf("kvdb unmarshal method doc: %w", err)
 		}
 		return mt, nil
 	default:
-		return nil, fmt.Errorf("kvdb unknown doc type: %d", typ)
+		return nil, &InvalidFormatError{What: "kvdb doc type", Reason: fmt.Sprintf("unknown type %d", typ)}
 	}
 }
 
@@ -99,6 +117,10 @@ func (d *KVDocDB) Delete(did DID) {
 	d.Store.Delete(docKey(did))
 }
 
+func (d *KVDocDB) backingStore() storage.Storage {
+	return d.Store
+}
+
 // Close .
 func (d *KVDocDB) Close() error {
 	err := d.Store.Close()
@@ -8,7 +8,9 @@ import (
 
 // KVTable .
 type KVTable struct {
-	Store storage.Storage `json:"store"`
+	Store    storage.Storage `json:"store"`
+	Codec    Codec           `json:"codec"`
+	Migrator *Migrator       `json:"-"` // upgrades old items lazily on read if set
 }
 
 var _ RegistryTable = (*KVTable)(nil)
@@ -17,11 +19,24 @@ var _ RegistryTable = (*KVTable)(nil)
 func NewKVTable(s storage.Storage) (*KVTable, error) {
 	return &KVTable{
 		Store: s,
+		Codec: DefaultCodec(),
 	}, nil
 }
 
+// SetCodec sets the codec used to encode items
+func (r *KVTable) SetCodec(c Codec) {
+	r.Codec = c
+}
+
+// SetMigrator sets the migrator used to upgrade items on read
+func (r *KVTable) SetMigrator(m *Migrator) {
+	r.Migrator = m
+}
+
+const tbPrefix = "tb-"
+
 func tbKey(id DID) []byte {
-	return []byte("tb-" + string(id))
+	return []byte(tbPrefix + string(id))
 }
 
 // HasItem whether table has the item(by key)
@@ -32,7 +47,7 @@ func (r *KVTable) HasItem(did DID) bool {
 
 // SetItem sets without any checks
 func (r *KVTable) setItem(did DID, item TableItem) error {
-	bitem, err := item.Marshal()
+	bitem, err := encodeRecord(r.Codec, item)
 	if err != nil {
 		return fmt.Errorf("kvtable marshal: %w", err)
 	}
@@ -44,11 +59,11 @@ func (r *KVTable) setItem(did DID, item TableItem) error {
 func (r *KVTable) CreateItem(item TableItem) error {
 	did := item.GetID()
 	if did == DID("") {
-		return fmt.Errorf("kvtable create item id is null")
+		return &InvalidFormatError{What: "kvtable item", Reason: "id is null"}
 	}
 	exist := r.HasItem(did)
 	if exist {
-		return fmt.Errorf("key %s already existed in kvtable", did)
+		return &AlreadyExistsError{ID: string(did), Store: "kvtable"}
 	}
 	return r.setItem(did, item)
 }
@@ -57,11 +72,11 @@ func (r *KVTable) CreateItem(item TableItem) error {
 func (r *KVTable) UpdateItem(item TableItem) error {
 	did := item.GetID()
 	if did == DID("") {
-		return fmt.Errorf("kvtable create item id is null")
+		return &InvalidFormatError{What: "kvtable item", Reason: "id is null"}
 	}
 	exist := r.HasItem(did)
 	if !exist {
-		return fmt.Errorf("key %s not existed in kvtable", did)
+		return &NotFoundError{ID: string(did), Store: "kvtable"}
 	}
 	return r.setItem(did, item)
 }
@@ -70,26 +85,29 @@ func (r *KVTable) UpdateItem(item TableItem) error {
 func (r *KVTable) GetItem(did DID, typ DIDType) (TableItem, error) {
 	exist := r.HasItem(did)
 	if !exist {
-		return nil, fmt.Errorf("key %s not existed in kvtable", did)
+		return nil, &NotFoundError{ID: string(did), Store: "kvtable"}
+	}
+	itemBytes, err := migrateOnRead(r.Migrator, r.Store, tbKey(did), itemRecordKind(typ), r.Store.Get(tbKey(did)))
+	if err != nil {
+		return nil, fmt.Errorf("kvtable migrate item: %w", err)
 	}
-	itemBytes := r.Store.Get(tbKey(did))
 	switch typ {
 	case AccountDIDType:
 		di := &AccountItem{}
-		err := di.Unmarshal(itemBytes)
+		err := decodeRecord(itemBytes, di)
 		if err != nil {
 			return nil, fmt.Errorf("kvtable unmarshal did item: %w", err)
 		}
 		return di, nil
 	case ChainDIDType:
 		mi := &ChainItem{}
-		err := mi.Unmarshal(itemBytes)
+		err := decodeRecord(itemBytes, mi)
 		if err != nil {
 			return nil, fmt.Errorf("kvtable unmarshal method item: %w", err)
 		}
 		return mi, nil
 	default:
-		return nil, fmt.Errorf("kvtable unknown table type: %d", typ)
+		return nil, &InvalidFormatError{What: "kvtable item type", Reason: fmt.Sprintf("unknown type %d", typ)}
 	}
 }
 
@@ -98,6 +116,10 @@ func (r *KVTable) DeleteItem(did DID) {
 	r.Store.Delete(tbKey(did))
 }
 
+func (r *KVTable) backingStore() storage.Storage {
+	return r.Store
+}
+
 // Close .
 func (r *KVTable) Close() error {
 	err := r.Store.Close()
@@ -0,0 +1,328 @@
+package bitxid
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/meshplus/bitxhub-kit/storage"
+)
+
+// The registry state is committed in a sparse merkle tree of depth 256:
+// - a leaf sits at the path of sha256(did) and its value is ItemHash(item)
+// - a subtree with a single leaf is represented by that leaf
+// - an empty subtree is represented by 32 zero bytes
+const (
+	smtPrefix   = "smt-"
+	smtLeafTag  = byte(0x00)
+	smtInnerTag = byte(0x01)
+)
+
+var smtEmpty = make([]byte, sha256.Size)
+
+// MerkleLeaf represents a leaf of the registry merkle tree
+type MerkleLeaf struct {
+	Key       []byte `json:"key"`       // sha256 of the did
+	ValueHash []byte `json:"valueHash"` // ItemHash of the item
+}
+
+// MerkleProof proves inclusion or non-inclusion of a did in a registry.
+// Siblings are ordered from the root downwards.
+type MerkleProof struct {
+	Root     []byte      `json:"root"`
+	Leaf     *MerkleLeaf `json:"leaf,omitempty"` // nil if the path ends in an empty subtree
+	Siblings [][]byte    `json:"siblings"`
+}
+
+var _ ProvableTable = (*MerkleTable)(nil)
+
+// MerkleTable is a RegistryTable decorator which commits all items
+// into a sparse merkle tree. Leaves are persisted in its own storage
+// so that the tree can be rebuilt when reopened.
+type MerkleTable struct {
+	Table  RegistryTable
+	Store  storage.Storage
+	leaves map[string][]byte // sha256(did) => item hash
+	keys   []string          // sorted keys of leaves
+	nodes  map[string][]byte // cached hashes of inner subtrees by smtNodeID
+	lock   sync.Mutex
+}
+
+// NewMerkleTable wraps table t, leaves are kept in storage s
+// which can be the same storage as the table.
+func NewMerkleTable(t RegistryTable, s storage.Storage) (*MerkleTable, error) {
+	mt := &MerkleTable{
+		Table:  t,
+		Store:  s,
+		leaves: make(map[string][]byte),
+		nodes:  make(map[string][]byte),
+	}
+	it := s.Prefix([]byte(smtPrefix))
+	for it.Next() {
+		did := DID(bytes.TrimPrefix(it.Key(), []byte(smtPrefix)))
+		key := string(smtKey(did))
+		mt.leaves[key] = append([]byte{}, it.Value()...)
+		mt.keys = append(mt.keys, key)
+	}
+	sort.Strings(mt.keys)
+	return mt, nil
+}
+
+// ItemHash computes the hash committed for an item,
+// items are encoded by ProtoCodec so that any language can recompute it.
+func ItemHash(item TableItem) ([]byte, error) {
+	b, err := (&ProtoCodec{}).Marshal(item)
+	if err != nil {
+		return nil, err
+	}
+	h := sha256.Sum256(b)
+	return h[:], nil
+}
+
+func smtKey(did DID) []byte {
+	h := sha256.Sum256([]byte(did))
+	return h[:]
+}
+
+func smtLeafKey(did DID) []byte {
+	return []byte(smtPrefix + string(did))
+}
+
+// smtNodeID identifies the subtree at depth on the path of key
+func smtNodeID(key []byte, depth int) string {
+	id := make([]byte, 2+(depth+7)/8)
+	binary.BigEndian.PutUint16(id, uint16(depth))
+	copy(id[2:], key)
+	if depth%8 != 0 {
+		id[len(id)-1] &= byte(0xff << (8 - uint(depth%8)))
+	}
+	return string(id)
+}
+
+func smtBit(key []byte, depth int) int {
+	return int(key[depth/8]>>(7-uint(depth%8))) & 1
+}
+
+func smtLeafHash(key, valueHash []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{smtLeafTag})
+	h.Write(key)
+	h.Write(valueHash)
+	return h.Sum(nil)
+}
+
+func smtInnerHash(left, right []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte{smtInnerTag})
+	h.Write(left)
+	h.Write(right)
+	return h.Sum(nil)
+}
+
+// HasItem .
+func (mt *MerkleTable) HasItem(did DID) bool {
+	return mt.Table.HasItem(did)
+}
+
+// GetItem .
+func (mt *MerkleTable) GetItem(did DID, typ DIDType) (TableItem, error) {
+	return mt.Table.GetItem(did, typ)
+}
+
+// CreateItem creates item and commits it
+func (mt *MerkleTable) CreateItem(item TableItem) error {
+	valueHash, err := ItemHash(item)
+	if err != nil {
+		return fmt.Errorf("merkle table item hash: %w", err)
+	}
+	if err := mt.Table.CreateItem(item); err != nil {
+		return err
+	}
+	mt.commit(item.GetID(), valueHash)
+	return nil
+}
+
+// UpdateItem updates item and commits it
+func (mt *MerkleTable) UpdateItem(item TableItem) error {
+	valueHash, err := ItemHash(item)
+	if err != nil {
+		return fmt.Errorf("merkle table item hash: %w", err)
+	}
+	if err := mt.Table.UpdateItem(item); err != nil {
+		return err
+	}
+	mt.commit(item.GetID(), valueHash)
+	return nil
+}
+
+// DeleteItem deletes item and removes it from the tree
+func (mt *MerkleTable) DeleteItem(did DID) {
+	mt.Table.DeleteItem(did)
+
+	mt.lock.Lock()
+	defer mt.lock.Unlock()
+	key := smtKey(did)
+	if _, ok := mt.leaves[string(key)]; ok {
+		delete(mt.leaves, string(key))
+		i := sort.SearchStrings(mt.keys, string(key))
+		mt.keys = append(mt.keys[:i], mt.keys[i+1:]...)
+	}
+	mt.Store.Delete(smtLeafKey(did))
+	mt.invalidate(key)
+}
+
+// Close .
+func (mt *MerkleTable) Close() error {
+	return mt.Table.Close()
+}
+
+func (mt *MerkleTable) backingStore() storage.Storage {
+	return mt.Store
+}
+
+func (mt *MerkleTable) decorated() RegistryTable {
+	return mt.Table
+}
+
+// commit sets the leaf of did to valueHash
+func (mt *MerkleTable) commit(did DID, valueHash []byte) {
+	mt.lock.Lock()
+	defer mt.lock.Unlock()
+	key := smtKey(did)
+	if _, ok := mt.leaves[string(key)]; !ok {
+		i := sort.SearchStrings(mt.keys, string(key))
+		mt.keys = append(mt.keys, "")
+		copy(mt.keys[i+1:], mt.keys[i:])
+		mt.keys[i] = string(key)
+	}
+	mt.leaves[string(key)] = valueHash
+	mt.Store.Put(smtLeafKey(did), valueHash)
+	mt.invalidate(key)
+}
+
+// invalidate drops cached hashes of subtrees on the path of key
+func (mt *MerkleTable) invalidate(key []byte) {
+	for depth := 0; depth <= len(key)*8; depth++ {
+		delete(mt.nodes, smtNodeID(key, depth))
+	}
+}
+
+// Root gets root hash of the registry state
+func (mt *MerkleTable) Root() []byte {
+	mt.lock.Lock()
+	defer mt.lock.Unlock()
+	return mt.subtreeHash(mt.keys, 0)
+}
+
+// Prove builds an inclusion proof if did is in the table,
+// otherwise a non-inclusion proof.
+func (mt *MerkleTable) Prove(did DID) (*MerkleProof, error) {
+	mt.lock.Lock()
+	defer mt.lock.Unlock()
+	key := smtKey(did)
+	keys := mt.keys
+	proof := &MerkleProof{Root: mt.subtreeHash(keys, 0), Siblings: [][]byte{}}
+	for depth := 0; len(keys) > 1; depth++ {
+		left, right := smtSplit(keys, depth)
+		if smtBit(key, depth) == 0 {
+			proof.Siblings = append(proof.Siblings, mt.subtreeHash(right, depth+1))
+			keys = left
+		} else {
+			proof.Siblings = append(proof.Siblings, mt.subtreeHash(left, depth+1))
+			keys = right
+		}
+	}
+	if len(keys) == 1 {
+		proof.Leaf = &MerkleLeaf{
+			Key:       []byte(keys[0]),
+			ValueHash: mt.leaves[keys[0]],
+		}
+	}
+	return proof, nil
+}
+
+// subtreeHash gets hash of the subtree at depth holding sorted keys,
+// hashes of inner subtrees are cached until their leaves change.
+func (mt *MerkleTable) subtreeHash(keys []string, depth int) []byte {
+	switch len(keys) {
+	case 0:
+		return smtEmpty
+	case 1:
+		return smtLeafHash([]byte(keys[0]), mt.leaves[keys[0]])
+	}
+	id := smtNodeID([]byte(keys[0]), depth)
+	if h, ok := mt.nodes[id]; ok {
+		return h
+	}
+	left, right := smtSplit(keys, depth)
+	h := smtInnerHash(mt.subtreeHash(left, depth+1), mt.subtreeHash(right, depth+1))
+	mt.nodes[id] = h
+	return h
+}
+
+// smtSplit splits sorted keys by their bit at depth
+func smtSplit(keys []string, depth int) ([]string, []string) {
+	i := sort.Search(len(keys), func(i int) bool {
+		return smtBit([]byte(keys[i]), depth) == 1
+	})
+	return keys[:i], keys[i:]
+}
+
+// VerifyInclusionProof checks that item is in the registry committed by root
+func VerifyInclusionProof(root []byte, item TableItem, proof *MerkleProof) (bool, error) {
+	valueHash, err := ItemHash(item)
+	if err != nil {
+		return false, fmt.Errorf("item hash: %w", err)
+	}
+	key := smtKey(item.GetID())
+	if proof == nil || proof.Leaf == nil ||
+		!bytes.Equal(proof.Leaf.Key, key) ||
+		!bytes.Equal(proof.Leaf.ValueHash, valueHash) {
+		return false, nil
+	}
+	return verifyMerklePath(root, key, proof)
+}
+
+// VerifyNonInclusionProof checks that did is not in the registry committed by root
+func VerifyNonInclusionProof(root []byte, did DID, proof *MerkleProof) (bool, error) {
+	if proof == nil {
+		return false, nil
+	}
+	key := smtKey(did)
+	if proof.Leaf != nil {
+		if bytes.Equal(proof.Leaf.Key, key) {
+			return false, nil
+		}
+		// the other leaf must sit on the path of did
+		for depth := range proof.Siblings {
+			if smtBit(proof.Leaf.Key, depth) != smtBit(key, depth) {
+				return false, nil
+			}
+		}
+	}
+	return verifyMerklePath(root, key, proof)
+}
+
+func verifyMerklePath(root, key []byte, proof *MerkleProof) (bool, error) {
+	if len(proof.Siblings) > len(key)*8 {
+		return false, fmt.Errorf("proof has %d siblings, too deep", len(proof.Siblings))
+	}
+	if proof.Leaf != nil && len(proof.Leaf.Key) != len(key) {
+		return false, fmt.Errorf("proof leaf key has wrong length %d", len(proof.Leaf.Key))
+	}
+	current := smtEmpty
+	if proof.Leaf != nil {
+		current = smtLeafHash(proof.Leaf.Key, proof.Leaf.ValueHash)
+	}
+	for depth := len(proof.Siblings) - 1; depth >= 0; depth-- {
+		if smtBit(key, depth) == 0 {
+			current = smtInnerHash(current, proof.Siblings[depth])
+		} else {
+			current = smtInnerHash(proof.Siblings[depth], current)
+		}
+	}
+	return bytes.Equal(current, root), nil
+}
@@ -0,0 +1,103 @@
+package bitxid
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMerkleTable(t *testing.T) {
+	s, dir := newTestStorage(t, "merkle.table")
+	defer os.RemoveAll(dir)
+	rt, err := NewKVTable(s)
+	assert.Nil(t, err)
+	mt, err := NewMerkleTable(rt, s)
+	assert.Nil(t, err)
+	assert.Equal(t, smtEmpty, mt.Root())
+
+	items := []*AccountItem{}
+	for i := 0; i < 20; i++ {
+		item := &AccountItem{BasicItem{ID: DID(fmt.Sprintf("did:bitxhub:appchain001:0x%02d", i)), Status: Normal}}
+		assert.Nil(t, mt.CreateItem(item))
+		items = append(items, item)
+	}
+	root := mt.Root()
+
+	for _, item := range items {
+		proof, err := mt.Prove(item.ID)
+		assert.Nil(t, err)
+		ok, err := VerifyInclusionProof(root, item, proof)
+		assert.Nil(t, err)
+		assert.True(t, ok)
+		ok, err = VerifyNonInclusionProof(root, item.ID, proof)
+		assert.Nil(t, err)
+		assert.False(t, ok)
+	}
+
+	// tampered item is not included
+	forged := &AccountItem{BasicItem{ID: items[3].ID, Status: Frozen}}
+	proof, err := mt.Prove(forged.ID)
+	assert.Nil(t, err)
+	ok, err := VerifyInclusionProof(root, forged, proof)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+
+	absent := DID("did:bitxhub:appchain001:0xff")
+	proof, err = mt.Prove(absent)
+	assert.Nil(t, err)
+	ok, err = VerifyNonInclusionProof(root, absent, proof)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+
+	// root follows updates and deletes
+	items[3].Status = Frozen
+	assert.Nil(t, mt.UpdateItem(items[3]))
+	assert.NotEqual(t, root, mt.Root())
+	mt.DeleteItem(items[5].ID)
+	proof, err = mt.Prove(items[5].ID)
+	assert.Nil(t, err)
+	ok, err = VerifyNonInclusionProof(mt.Root(), items[5].ID, proof)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+
+	// failed writes leave the tree unchanged
+	root = mt.Root()
+	assert.NotNil(t, mt.CreateItem(&AccountItem{BasicItem{ID: items[3].ID}}))
+	assert.Equal(t, root, mt.Root())
+
+	// leaves are reloaded from storage
+	mt2, err := NewMerkleTable(rt, s)
+	assert.Nil(t, err)
+	assert.Equal(t, mt.Root(), mt2.Root())
+}
+
+func TestChainDIDResolveWithProof(t *testing.T) {
+	mr, tablePath, docdbPath := newChainDIDModeInternal(t)
+	defer os.RemoveAll(tablePath)
+	defer os.RemoveAll(docdbPath)
+
+	_, _, err := mr.ResolveWithProof(chainDID)
+	assert.NotNil(t, err)
+
+	mt, err := NewMerkleTable(mr.Table, backingStore(mr.Table))
+	assert.Nil(t, err)
+	mr.Table = mt
+	testChainDIDSetupGenesSucceed(t, mr)
+	testChainDIDAddAdminsSucceed(t, mr)
+	testChainDIDApplySucceed(t, mr)
+
+	item, proof, err := mr.ResolveWithProof(chainDID)
+	assert.Nil(t, err)
+	ok, err := VerifyInclusionProof(mt.Root(), item, proof)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+
+	item, proof, err = mr.ResolveWithProof(DID("did:bitxhub:appchain404:."))
+	assert.Nil(t, err)
+	assert.Nil(t, item)
+	ok, err = VerifyNonInclusionProof(mt.Root(), DID("did:bitxhub:appchain404:."), proof)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+}
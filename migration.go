@@ -0,0 +1,213 @@
+package bitxid
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/meshplus/bitxhub-kit/storage"
+)
+
+// schema versions of stored records:
+// @LegacySchemaVersion: records written before the record header existed
+// @CurrentSchemaVersion: records written by this version of the package
+const (
+	LegacySchemaVersion  uint8 = 0
+	CurrentSchemaVersion uint8 = 1
+)
+
+// RecordKind represents the kind of a stored record
+type RecordKind string
+
+// kind of stored records
+const (
+	ChainItemRecord   RecordKind = "chain-item"
+	AccountItemRecord RecordKind = "account-item"
+	ChainDocRecord    RecordKind = "chain-doc"
+	AccountDocRecord  RecordKind = "account-doc"
+	ClaimTypRecord    RecordKind = "claim-typ"
+	CredentialRecord  RecordKind = "credential"
+)
+
+// MigrationFunc upgrades the payload of a record by one schema version,
+// the payload is encoded by codec c before and after the upgrade.
+type MigrationFunc func(c Codec, payload []byte) ([]byte, error)
+
+// Migrator upgrades stored records to CurrentSchemaVersion,
+// either in place by Run or lazily on read by tables and docdbs.
+type Migrator struct {
+	migrations map[RecordKind]map[uint8]MigrationFunc
+}
+
+// NewMigrator news a Migrator with the built-in migrations registered
+func NewMigrator() *Migrator {
+	m := &Migrator{
+		migrations: make(map[RecordKind]map[uint8]MigrationFunc),
+	}
+	// legacy records are gob of the same structs, only the header is added
+	for _, kind := range []RecordKind{
+		ChainItemRecord, AccountItemRecord,
+		ChainDocRecord, AccountDocRecord,
+		ClaimTypRecord, CredentialRecord} {
+		m.Register(kind, LegacySchemaVersion, keepPayload)
+	}
+	return m
+}
+
+func keepPayload(_ Codec, payload []byte) ([]byte, error) {
+	return payload, nil
+}
+
+// Register registers the migration of kind from version `from` to `from+1`,
+// an existing migration of the same step is replaced.
+func (m *Migrator) Register(kind RecordKind, from uint8, fn MigrationFunc) {
+	if m.migrations[kind] == nil {
+		m.migrations[kind] = make(map[uint8]MigrationFunc)
+	}
+	m.migrations[kind][from] = fn
+}
+
+// Upgrade upgrades a stored record to CurrentSchemaVersion,
+// it reports whether the record is changed.
+func (m *Migrator) Upgrade(kind RecordKind, record []byte) ([]byte, bool, error) {
+	c, version, payload, err := splitRecord(record)
+	if err != nil {
+		return nil, false, err
+	}
+	if version > CurrentSchemaVersion {
+		return nil, false, fmt.Errorf("record schema version %d is newer than supported %d", version, CurrentSchemaVersion)
+	}
+	if version == CurrentSchemaVersion {
+		return record, false, nil
+	}
+	for ; version < CurrentSchemaVersion; version++ {
+		fn, ok := m.migrations[kind][version]
+		if !ok {
+			return nil, false, fmt.Errorf("no migration of %s from version %d", kind, version)
+		}
+		payload, err = fn(c, payload)
+		if err != nil {
+			return nil, false, fmt.Errorf("migrate %s from version %d: %w", kind, version, err)
+		}
+	}
+	return joinRecord(c, version, payload), true, nil
+}
+
+// MigrationReport represents the result of a migration run
+type MigrationReport struct {
+	DryRun   bool
+	Scanned  int
+	Upgraded int
+	UpToDate int
+	Failed   int
+	Versions map[uint8]int    // count of records by version before the run
+	Errors   map[string]error // errors by record key
+}
+
+// String summarizes the report
+func (rp *MigrationReport) String() string {
+	versions := make([]int, 0, len(rp.Versions))
+	for v := range rp.Versions {
+		versions = append(versions, int(v))
+	}
+	sort.Ints(versions)
+	vs := make([]string, 0, len(versions))
+	for _, v := range versions {
+		vs = append(vs, fmt.Sprintf("v%d:%d", v, rp.Versions[uint8(v)]))
+	}
+	return fmt.Sprintf("dry-run: %t, scanned: %d, upgraded: %d, up-to-date: %d, failed: %d, versions: [%s]",
+		rp.DryRun, rp.Scanned, rp.Upgraded, rp.UpToDate, rp.Failed, strings.Join(vs, " "))
+}
+
+// Run upgrades all records of a table, docdb or vc store in place.
+// Under dry-run mode nothing is written and the report tells what would be done.
+func (m *Migrator) Run(s storage.Storage, dryRun bool) (*MigrationReport, error) {
+	report := &MigrationReport{
+		DryRun:   dryRun,
+		Versions: make(map[uint8]int),
+		Errors:   make(map[string]error),
+	}
+	batch := s.NewBatch()
+	for _, prefix := range []string{tbPrefix, docPrefix, claimPrefix, vcPrefix} {
+		it := s.Prefix([]byte(prefix))
+		for it.Next() {
+			key := append([]byte{}, it.Key()...)
+			record := it.Value()
+			report.Scanned++
+
+			_, version, _, err := splitRecord(record)
+			if err != nil {
+				report.Failed++
+				report.Errors[string(key)] = err
+				continue
+			}
+			report.Versions[version]++
+
+			upgraded, changed, err := m.Upgrade(recordKindOf(prefix, key), record)
+			if err != nil {
+				report.Failed++
+				report.Errors[string(key)] = err
+				continue
+			}
+			if !changed {
+				report.UpToDate++
+				continue
+			}
+			report.Upgraded++
+			if !dryRun {
+				batch.Put(key, upgraded)
+			}
+		}
+	}
+	if !dryRun {
+		batch.Commit()
+	}
+	if report.Failed != 0 {
+		return report, fmt.Errorf("migration: %d records failed", report.Failed)
+	}
+	return report, nil
+}
+
+func recordKindOf(prefix string, key []byte) RecordKind {
+	did := DID(strings.TrimPrefix(string(key), prefix))
+	switch prefix {
+	case tbPrefix:
+		return itemRecordKind(DIDType(did.GetType()))
+	case docPrefix:
+		return docRecordKind(DIDType(did.GetType()))
+	case claimPrefix:
+		return ClaimTypRecord
+	default:
+		return CredentialRecord
+	}
+}
+
+func itemRecordKind(typ DIDType) RecordKind {
+	if typ == ChainDIDType {
+		return ChainItemRecord
+	}
+	return AccountItemRecord
+}
+
+func docRecordKind(typ DIDType) RecordKind {
+	if typ == ChainDIDType {
+		return ChainDocRecord
+	}
+	return AccountDocRecord
+}
+
+// migrateOnRead upgrades a record read from s lazily and writes it back,
+// it does nothing if m is nil.
+func migrateOnRead(m *Migrator, s storage.Storage, key []byte, kind RecordKind, record []byte) ([]byte, error) {
+	if m == nil {
+		return record, nil
+	}
+	upgraded, changed, err := m.Upgrade(kind, record)
+	if err != nil {
+		return nil, err
+	}
+	if changed {
+		s.Put(key, upgraded)
+	}
+	return upgraded, nil
+}
@@ -0,0 +1,97 @@
+package bitxid
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/meshplus/bitxhub-kit/storage/leveldb"
+	"github.com/stretchr/testify/assert"
+)
+
+// chainItemV0 is a made-up flat layout of chain item used by old data
+type chainItemV0 struct {
+	ID     DID
+	Status StatusType
+	Owner  DID
+}
+
+func TestMigratorRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "registry.table")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	s, err := leveldb.New(dir)
+	assert.Nil(t, err)
+	rt, err := NewKVTable(s)
+	assert.Nil(t, err)
+
+	legacy := &AccountItem{BasicItem{ID: "did:bitxhub:appchain001:0x01", Status: Normal}}
+	lb, err := legacy.Marshal()
+	assert.Nil(t, err)
+	s.Put(tbKey(legacy.ID), lb)
+	err = rt.CreateItem(&AccountItem{BasicItem{ID: "did:bitxhub:appchain001:0x02", Status: Normal}})
+	assert.Nil(t, err)
+
+	m := NewMigrator()
+	report, err := m.Run(s, true)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, report.Scanned)
+	assert.Equal(t, 1, report.Upgraded)
+	assert.Equal(t, 1, report.UpToDate)
+	assert.Equal(t, map[uint8]int{LegacySchemaVersion: 1, CurrentSchemaVersion: 1}, report.Versions)
+	assert.Equal(t, lb, s.Get(tbKey(legacy.ID))) // dry run writes nothing
+
+	report, err = m.Run(s, false)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, report.Upgraded)
+	_, version, _, err := splitRecord(s.Get(tbKey(legacy.ID)))
+	assert.Nil(t, err)
+	assert.Equal(t, CurrentSchemaVersion, version)
+
+	report, err = m.Run(s, false)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, report.Upgraded)
+	assert.Equal(t, 2, report.UpToDate)
+
+	item, err := rt.GetItem(legacy.ID, AccountDIDType)
+	assert.Nil(t, err)
+	assert.Equal(t, legacy, item)
+}
+
+func TestMigratorLazy(t *testing.T) {
+	dir, err := ioutil.TempDir("", "registry.table")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	s, err := leveldb.New(dir)
+	assert.Nil(t, err)
+	rt, err := NewKVTable(s)
+	assert.Nil(t, err)
+
+	old, err := Marshal(chainItemV0{ID: chainDID, Status: Frozen, Owner: mcaller})
+	assert.Nil(t, err)
+	s.Put(tbKey(chainDID), old)
+
+	m := NewMigrator()
+	m.Register(ChainItemRecord, LegacySchemaVersion, func(c Codec, payload []byte) ([]byte, error) {
+		v0 := chainItemV0{}
+		if err := c.Unmarshal(payload, &v0); err != nil {
+			return nil, err
+		}
+		return c.Marshal(&ChainItem{BasicItem{ID: v0.ID, Status: v0.Status}, v0.Owner})
+	})
+	rt.SetMigrator(m)
+
+	item, err := rt.GetItem(chainDID, ChainDIDType)
+	assert.Nil(t, err)
+	assert.Equal(t, &ChainItem{BasicItem{ID: chainDID, Status: Frozen}, mcaller}, item)
+
+	// upgraded item is written back
+	_, version, _, err := splitRecord(s.Get(tbKey(chainDID)))
+	assert.Nil(t, err)
+	assert.Equal(t, CurrentSchemaVersion, version)
+
+	// records from the future are refused
+	s.Put(tbKey(chainDID), joinRecord(DefaultCodec(), CurrentSchemaVersion+1, old))
+	_, err = rt.GetItem(chainDID, ChainDIDType)
+	assert.NotNil(t, err)
+}
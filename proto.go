@@ -0,0 +1,379 @@
+package bitxid
+
+import (
+	"encoding/binary"
+	"fmt"
+	"reflect"
+	"strconv"
+)
+
+// protobuf wire types
+const (
+	wireVarint = 0
+	wireBytes  = 2
+)
+
+// protoMarshal encodes a struct (or pointer to struct) in protobuf wire format.
+// Every exported field needs a `pb:"<field number>"` tag, `pb:"-"` skips it.
+// Supported fields: bool, ints, uints, string, []byte, struct, *struct
+// and slices of those. Zero values are omitted like proto3 does.
+func protoMarshal(v interface{}) ([]byte, error) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return []byte{}, nil
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("unsupported type %s", rv.Type())
+	}
+	return encodeMessage(nil, rv)
+}
+
+// protoUnmarshal decodes protobuf wire format into a pointer to struct,
+// unknown fields are skipped.
+func protoUnmarshal(data []byte, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("non-pointer or nil target %T", v)
+	}
+	// targets like **ChainDoc are allowed
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			rv.Set(reflect.New(rv.Type().Elem()))
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return fmt.Errorf("unsupported type %s", rv.Type())
+	}
+	return decodeMessage(data, rv)
+}
+
+type protoField struct {
+	num   uint64
+	index int
+}
+
+func protoFields(t reflect.Type) ([]protoField, error) {
+	fields := []protoField{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" { // unexported
+			continue
+		}
+		tag := f.Tag.Get("pb")
+		if tag == "-" {
+			continue
+		}
+		if tag == "" {
+			return nil, fmt.Errorf("field %s.%s has no pb tag", t.Name(), f.Name)
+		}
+		num, err := strconv.ParseUint(tag, 10, 32)
+		if err != nil || num == 0 {
+			return nil, fmt.Errorf("field %s.%s has invalid pb tag %q", t.Name(), f.Name, tag)
+		}
+		fields = append(fields, protoField{num: num, index: i})
+	}
+	return fields, nil
+}
+
+func appendKey(buf []byte, num uint64, wire int) []byte {
+	return appendUvarint(buf, num<<3|uint64(wire))
+}
+
+func appendBytes(buf []byte, num uint64, b []byte) []byte {
+	buf = appendKey(buf, num, wireBytes)
+	buf = appendUvarint(buf, uint64(len(b)))
+	return append(buf, b...)
+}
+
+func encodeMessage(buf []byte, rv reflect.Value) ([]byte, error) {
+	fields, err := protoFields(rv.Type())
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range fields {
+		buf, err = encodeField(buf, f.num, rv.Field(f.index))
+		if err != nil {
+			return nil, fmt.Errorf("%s.%s: %w", rv.Type().Name(), rv.Type().Field(f.index).Name, err)
+		}
+	}
+	return buf, nil
+}
+
+func encodeField(buf []byte, num uint64, fv reflect.Value) ([]byte, error) {
+	switch fv.Kind() {
+	case reflect.Bool:
+		if fv.Bool() {
+			buf = appendKey(buf, num, wireVarint)
+			buf = appendUvarint(buf, 1)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if fv.Int() != 0 {
+			buf = appendKey(buf, num, wireVarint)
+			buf = appendUvarint(buf, uint64(fv.Int()))
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if fv.Uint() != 0 {
+			buf = appendKey(buf, num, wireVarint)
+			buf = appendUvarint(buf, fv.Uint())
+		}
+	case reflect.String:
+		if fv.Len() != 0 {
+			buf = appendBytes(buf, num, []byte(fv.String()))
+		}
+	case reflect.Struct:
+		msg, err := encodeMessage(nil, fv)
+		if err != nil {
+			return nil, err
+		}
+		buf = appendBytes(buf, num, msg)
+	case reflect.Ptr:
+		if fv.IsNil() {
+			return buf, nil
+		}
+		if fv.Elem().Kind() != reflect.Struct {
+			return nil, fmt.Errorf("unsupported pointer type %s", fv.Type())
+		}
+		return encodeField(buf, num, fv.Elem())
+	case reflect.Slice:
+		if fv.Type().Elem().Kind() == reflect.Uint8 {
+			if fv.Len() != 0 {
+				buf = appendBytes(buf, num, fv.Bytes())
+			}
+			return buf, nil
+		}
+		return encodeRepeated(buf, num, fv)
+	default:
+		return nil, fmt.Errorf("unsupported kind %s", fv.Kind())
+	}
+	return buf, nil
+}
+
+func encodeRepeated(buf []byte, num uint64, fv reflect.Value) ([]byte, error) {
+	if fv.Len() == 0 {
+		return buf, nil
+	}
+	switch fv.Type().Elem().Kind() {
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		// scalars are packed
+		packed := []byte{}
+		for i := 0; i < fv.Len(); i++ {
+			packed = appendUvarint(packed, scalarBits(fv.Index(i)))
+		}
+		return appendBytes(buf, num, packed), nil
+	}
+	for i := 0; i < fv.Len(); i++ {
+		ev := fv.Index(i)
+		if ev.Kind() == reflect.Ptr {
+			if ev.IsNil() {
+				return nil, fmt.Errorf("nil element in repeated field")
+			}
+			ev = ev.Elem()
+		}
+		switch ev.Kind() {
+		case reflect.String:
+			buf = appendBytes(buf, num, []byte(ev.String()))
+		case reflect.Slice:
+			if ev.Type().Elem().Kind() != reflect.Uint8 {
+				return nil, fmt.Errorf("unsupported nested slice %s", ev.Type())
+			}
+			buf = appendBytes(buf, num, ev.Bytes())
+		case reflect.Struct:
+			msg, err := encodeMessage(nil, ev)
+			if err != nil {
+				return nil, err
+			}
+			buf = appendBytes(buf, num, msg)
+		default:
+			return nil, fmt.Errorf("unsupported repeated kind %s", ev.Kind())
+		}
+	}
+	return buf, nil
+}
+
+func scalarBits(v reflect.Value) uint64 {
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			return 1
+		}
+		return 0
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return uint64(v.Int())
+	default:
+		return v.Uint()
+	}
+}
+
+func setScalar(v reflect.Value, x uint64) error {
+	switch v.Kind() {
+	case reflect.Bool:
+		v.SetBool(x != 0)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v.SetInt(int64(x))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		v.SetUint(x)
+	default:
+		return fmt.Errorf("varint for non-scalar kind %s", v.Kind())
+	}
+	return nil
+}
+
+func decodeMessage(data []byte, rv reflect.Value) error {
+	fields, err := protoFields(rv.Type())
+	if err != nil {
+		return err
+	}
+	byNum := make(map[uint64]int, len(fields))
+	for _, f := range fields {
+		byNum[f.num] = f.index
+	}
+	for len(data) > 0 {
+		key, n := binary.Uvarint(data)
+		if n <= 0 {
+			return fmt.Errorf("malformed field key")
+		}
+		data = data[n:]
+		num, wire := key>>3, int(key&7)
+
+		var (
+			x       uint64
+			payload []byte
+		)
+		switch wire {
+		case wireVarint:
+			x, n = binary.Uvarint(data)
+			if n <= 0 {
+				return fmt.Errorf("malformed varint of field %d", num)
+			}
+			data = data[n:]
+		case wireBytes:
+			l, n := binary.Uvarint(data)
+			if n <= 0 || uint64(len(data)-n) < l {
+				return fmt.Errorf("malformed length of field %d", num)
+			}
+			payload = data[n : n+int(l)]
+			data = data[n+int(l):]
+		case 1: // fixed64
+			if len(data) < 8 {
+				return fmt.Errorf("malformed fixed64 of field %d", num)
+			}
+			data = data[8:]
+			continue
+		case 5: // fixed32
+			if len(data) < 4 {
+				return fmt.Errorf("malformed fixed32 of field %d", num)
+			}
+			data = data[4:]
+			continue
+		default:
+			return fmt.Errorf("unsupported wire type %d of field %d", wire, num)
+		}
+
+		idx, ok := byNum[num]
+		if !ok {
+			continue
+		}
+		fv := rv.Field(idx)
+		if wire == wireVarint {
+			if fv.Kind() == reflect.Slice {
+				ev := reflect.New(fv.Type().Elem()).Elem()
+				if err := setScalar(ev, x); err != nil {
+					return err
+				}
+				fv.Set(reflect.Append(fv, ev))
+				continue
+			}
+			if err := setScalar(fv, x); err != nil {
+				return fmt.Errorf("%s: %w", rv.Type().Field(idx).Name, err)
+			}
+			continue
+		}
+		if err := decodeBytesField(fv, payload); err != nil {
+			return fmt.Errorf("%s: %w", rv.Type().Field(idx).Name, err)
+		}
+	}
+	return nil
+}
+
+func decodeBytesField(fv reflect.Value, payload []byte) error {
+	switch fv.Kind() {
+	case reflect.String:
+		fv.SetString(string(payload))
+	case reflect.Struct:
+		return decodeMessage(payload, fv)
+	case reflect.Ptr:
+		if fv.Type().Elem().Kind() != reflect.Struct {
+			return fmt.Errorf("unsupported pointer type %s", fv.Type())
+		}
+		if fv.IsNil() {
+			fv.Set(reflect.New(fv.Type().Elem()))
+		}
+		return decodeMessage(payload, fv.Elem())
+	case reflect.Slice:
+		et := fv.Type().Elem()
+		if et.Kind() == reflect.Uint8 {
+			fv.SetBytes(append([]byte{}, payload...))
+			return nil
+		}
+		return decodeRepeated(fv, payload)
+	default:
+		return fmt.Errorf("length-delimited value for kind %s", fv.Kind())
+	}
+	return nil
+}
+
+func decodeRepeated(fv reflect.Value, payload []byte) error {
+	et := fv.Type().Elem()
+	switch et.Kind() {
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		for len(payload) > 0 {
+			x, n := binary.Uvarint(payload)
+			if n <= 0 {
+				return fmt.Errorf("malformed packed varint")
+			}
+			payload = payload[n:]
+			ev := reflect.New(et).Elem()
+			if err := setScalar(ev, x); err != nil {
+				return err
+			}
+			fv.Set(reflect.Append(fv, ev))
+		}
+		return nil
+	}
+
+	ev := reflect.New(et).Elem()
+	target := ev
+	if et.Kind() == reflect.Ptr {
+		ev.Set(reflect.New(et.Elem()))
+		target = ev.Elem()
+	}
+	switch target.Kind() {
+	case reflect.String:
+		target.SetString(string(payload))
+	case reflect.Slice:
+		if target.Type().Elem().Kind() != reflect.Uint8 {
+			return fmt.Errorf("unsupported nested slice %s", target.Type())
+		}
+		target.SetBytes(append([]byte{}, payload...))
+	case reflect.Struct:
+		if err := decodeMessage(payload, target); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unsupported repeated kind %s", target.Kind())
+	}
+	fv.Set(reflect.Append(fv, ev))
+	return nil
+}
+
+func appendUvarint(buf []byte, x uint64) []byte {
+	var tmp [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(tmp[:], x)
+	return append(buf, tmp[:n]...)
+}
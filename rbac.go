@@ -0,0 +1,265 @@
+package bitxid
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/meshplus/bitxhub-kit/storage"
+)
+
+// Role .
+type Role string
+
+// roles which can be granted to dids
+const (
+	RoleAuditor   Role = "auditor"   // audits chain did applications and statuses
+	RoleOperator  Role = "operator"  // freezes and unfreezes dids
+	RoleRegistrar Role = "registrar" // registers and updates dids on behalf of their owners
+	RoleVCIssuer  Role = "vc-issuer" // stores and deletes credentials
+)
+
+// Permission .
+type Permission string
+
+// permissions checked by registries
+const (
+	PermAudit    Permission = "audit"
+	PermFreeze   Permission = "freeze"
+	PermRegister Permission = "register"
+	PermIssueVC  Permission = "issue-vc"
+	PermAdmin    Permission = "admin" // admin and role changes, deletion and claim types, only admins have it
+)
+
+var rolePermissions = map[Role][]Permission{
+	RoleAuditor:   {PermAudit},
+	RoleOperator:  {PermFreeze},
+	RoleRegistrar: {PermRegister},
+	RoleVCIssuer:  {PermIssueVC},
+}
+
+// Permissions gets permissions of the role
+func (role Role) Permissions() []Permission {
+	return rolePermissions[role]
+}
+
+// roleRecord is the stored roles of a did
+type roleRecord struct {
+	DID   DID    `json:"did"`
+	Roles []Role `json:"roles"`
+}
+
+// RBAC keeps roles granted to dids, and checks permissions of callers
+// taken from the context. Admins of the bound registry have all
+// permissions. Registries check permissions only if RBAC is set.
+type RBAC struct {
+	Store  storage.Storage
+	admins func() []DID
+	lock   *sync.RWMutex
+}
+
+// NewRBAC news a RBAC persisting roles in s
+func NewRBAC(s storage.Storage) (*RBAC, error) {
+	return &RBAC{Store: s, lock: &sync.RWMutex{}}, nil
+}
+
+// Roles gets roles granted to did
+func (rb *RBAC) Roles(did DID) ([]Role, error) {
+	rb.lock.RLock()
+	defer rb.lock.RUnlock()
+	rec, err := rb.getRecord(did)
+	if err != nil {
+		return nil, err
+	}
+	return rec.Roles, nil
+}
+
+// HasRole checks whether role is granted to did
+func (rb *RBAC) HasRole(did DID, role Role) (bool, error) {
+	roles, err := rb.Roles(did)
+	if err != nil {
+		return false, err
+	}
+	for _, r := range roles {
+		if r == role {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Members gets dids granted role
+func (rb *RBAC) Members(role Role) ([]DID, error) {
+	rb.lock.RLock()
+	defer rb.lock.RUnlock()
+	dids := []DID{}
+	it := rb.Store.Prefix([]byte(rolePrefix))
+	for it.Next() {
+		rec := &roleRecord{}
+		if err := decodeRecord(it.Value(), rec); err != nil {
+			return nil, fmt.Errorf("roles unmarshal %s: %w", it.Key(), err)
+		}
+		for _, r := range rec.Roles {
+			if r == role {
+				dids = append(dids, rec.DID)
+				break
+			}
+		}
+	}
+	return dids, nil
+}
+
+// Check checks whether the caller of ctx has perm, passed proposals
+// and the genesis setup are always allowed.
+func (rb *RBAC) Check(ctx context.Context, perm Permission) error {
+	if executing, _ := ctx.Value(governanceKey).(bool); executing {
+		return nil
+	}
+	caller, _ := CallerFromContext(ctx)
+	if caller != "" {
+		if rb.isAdmin(caller) {
+			return nil
+		}
+		roles, err := rb.Roles(caller)
+		if err != nil {
+			return err
+		}
+		for _, role := range roles {
+			for _, p := range role.Permissions() {
+				if p == perm {
+					return nil
+				}
+			}
+		}
+	}
+	return &PermissionDeniedError{Caller: caller, Op: string(perm)}
+}
+
+// bind gets a RBAC sharing roles with rb whose admins are admins,
+// so that admins of a registry have all permissions within it only
+func (rb *RBAC) bind(admins func() []DID) *RBAC {
+	return &RBAC{Store: rb.Store, admins: admins, lock: rb.lock}
+}
+
+func (rb *RBAC) isAdmin(caller DID) bool {
+	if rb.admins == nil {
+		return false
+	}
+	for _, admin := range rb.admins() {
+		if admin == caller {
+			return true
+		}
+	}
+	return false
+}
+
+func (rb *RBAC) grant(did DID, role Role) error {
+	if _, ok := rolePermissions[role]; !ok {
+		return &InvalidFormatError{What: "role", Reason: fmt.Sprintf("unknown role %s", role)}
+	}
+	rb.lock.Lock()
+	defer rb.lock.Unlock()
+	rec, err := rb.getRecord(did)
+	if err != nil {
+		return err
+	}
+	for _, r := range rec.Roles {
+		if r == role {
+			return &AlreadyExistsError{ID: string(role), Store: fmt.Sprintf("roles of %s", did)}
+		}
+	}
+	rec.Roles = append(rec.Roles, role)
+	return rb.putRecord(rec)
+}
+
+func (rb *RBAC) revoke(did DID, role Role) error {
+	rb.lock.Lock()
+	defer rb.lock.Unlock()
+	rec, err := rb.getRecord(did)
+	if err != nil {
+		return err
+	}
+	for i, r := range rec.Roles {
+		if r == role {
+			rec.Roles = append(rec.Roles[:i], rec.Roles[i+1:]...)
+			if len(rec.Roles) == 0 {
+				rb.Store.Delete(roleKey(did))
+				return nil
+			}
+			return rb.putRecord(rec)
+		}
+	}
+	return &NotFoundError{ID: string(role), Store: fmt.Sprintf("roles of %s", did)}
+}
+
+func (rb *RBAC) getRecord(did DID) (*roleRecord, error) {
+	rec := &roleRecord{DID: did}
+	data := rb.Store.Get(roleKey(did))
+	if data == nil {
+		return rec, nil
+	}
+	if err := decodeRecord(data, rec); err != nil {
+		return nil, fmt.Errorf("roles unmarshal %s: %w", did, err)
+	}
+	return rec, nil
+}
+
+func (rb *RBAC) putRecord(rec *roleRecord) error {
+	data, err := encodeRecord(&JSONCodec{}, rec)
+	if err != nil {
+		return fmt.Errorf("roles marshal %s: %w", rec.DID, err)
+	}
+	rb.Store.Put(roleKey(rec.DID), data)
+	return nil
+}
+
+func (rb *RBAC) backingStore() storage.Storage {
+	return rb.Store
+}
+
+// checkPermission checks perm of the caller of ctx if rb is set
+func checkPermission(ctx context.Context, rb *RBAC, perm Permission) error {
+	if rb == nil {
+		return nil
+	}
+	return rb.Check(ctx, perm)
+}
+
+// checkSelfOrPermission allows the caller of ctx acting for itself as did,
+// or having perm if rb is set. Changes authenticated by the keys of the
+// doc, e.g. key rotations, are made by the did itself.
+func checkSelfOrPermission(ctx context.Context, rb *RBAC, did DID, perm Permission) error {
+	if rb == nil {
+		return nil
+	}
+	if authenticated, _ := ctx.Value(docAuthKey).(bool); authenticated {
+		return nil
+	}
+	if caller, _ := CallerFromContext(ctx); caller != "" && caller == did {
+		return nil
+	}
+	return rb.Check(ctx, perm)
+}
+
+// grantRole grants or revokes role of did in rb and records the admin action
+func grantRole(ctx context.Context, rb *RBAC, l *AuditLog, action AuditAction, did DID, role Role) error {
+	if rb == nil {
+		return fmt.Errorf("%s: role based access control is not enabled", action)
+	}
+	var err error
+	if action == ActionGrantRole {
+		err = rb.grant(did, role)
+	} else {
+		err = rb.revoke(did, role)
+	}
+	if err != nil {
+		return err
+	}
+	return recordAuditEntry(ctx, l, &AuditEntry{Action: action, Target: did, Role: role})
+}
+
+const rolePrefix = "role-"
+
+func roleKey(did DID) []byte {
+	return []byte(rolePrefix + string(did))
+}
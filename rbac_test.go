@@ -0,0 +1,163 @@
+package bitxid
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	auditor   = DID("did:bitxhub:relayroot:auditor")
+	operator  = DID("did:bitxhub:relayroot:operator")
+	registrar = DID("did:bitxhub:relayroot:registrar")
+)
+
+func TestRBACChainDID(t *testing.T) {
+	mr, tablePath, docdbPath := newChainDIDModeInternal(t)
+	defer os.RemoveAll(tablePath)
+	defer os.RemoveAll(docdbPath)
+	l, err := NewAuditLog(mr.Table.(*KVTable).Store)
+	assert.Nil(t, err)
+	WithChainAuditLog(l)(mr)
+	rb, err := NewRBAC(mr.Table.(*KVTable).Store)
+	assert.Nil(t, err)
+	WithChainRBAC(rb)(mr)
+	// the genesis is always allowed
+	testChainDIDSetupGenesSucceed(t, mr)
+
+	assert.True(t, errors.Is(mr.GrantRoleContext(asAdmin(auditor), auditor, RoleAuditor), ErrPermissionDenied))
+	assert.Nil(t, mr.GrantRoleContext(asAdmin(superAdmin), auditor, RoleAuditor))
+	assert.Nil(t, mr.GrantRoleContext(asAdmin(superAdmin), operator, RoleOperator))
+	assert.True(t, errors.Is(mr.GrantRoleContext(asAdmin(superAdmin), auditor, RoleAuditor), ErrAlreadyExists))
+	assert.True(t, errors.Is(mr.GrantRoleContext(asAdmin(superAdmin), auditor, "root"), ErrInvalidFormat))
+	has, err := rb.HasRole(auditor, RoleAuditor)
+	assert.Nil(t, err)
+	assert.True(t, has)
+
+	// applies for itself only
+	assert.True(t, errors.Is(mr.ApplyContext(asAdmin(auditor), mcaller, chainDID), ErrPermissionDenied))
+	assert.Nil(t, mr.ApplyContext(asAdmin(mcaller), mcaller, chainDID))
+
+	err = mr.AuditApplyContext(asAdmin(operator), chainDID, true)
+	assert.True(t, errors.Is(err, ErrPermissionDenied))
+	pd := &PermissionDeniedError{}
+	assert.True(t, errors.As(err, &pd))
+	assert.Equal(t, operator, pd.Caller)
+	assert.Equal(t, string(PermAudit), pd.Op)
+	assert.True(t, errors.Is(mr.AuditApply(chainDID, true), ErrPermissionDenied))
+	assert.Nil(t, mr.AuditApplyContext(asAdmin(auditor), chainDID, true))
+
+	// registered by the owner
+	_, _, err = mr.RegisterWithDocContext(asAdmin(auditor), &mdocA)
+	assert.True(t, errors.Is(err, ErrPermissionDenied))
+	_, _, err = mr.RegisterWithDocContext(asAdmin(mcaller), &mdocA)
+	assert.Nil(t, err)
+
+	assert.True(t, errors.Is(mr.FreezeContext(asAdmin(auditor), chainDID), ErrPermissionDenied))
+	assert.Nil(t, mr.FreezeContext(asAdmin(operator), chainDID))
+	assert.Nil(t, mr.UnFreezeContext(asAdmin(operator), chainDID))
+	assert.True(t, errors.Is(mr.DeleteContext(asAdmin(operator), chainDID), ErrPermissionDenied))
+	assert.True(t, errors.Is(mr.AddAdminContext(asAdmin(operator), admin), ErrPermissionDenied))
+
+	assert.Nil(t, mr.RevokeRoleContext(asAdmin(superAdmin), operator, RoleOperator))
+	assert.True(t, errors.Is(mr.RevokeRoleContext(asAdmin(superAdmin), operator, RoleOperator), ErrNotFound))
+	assert.True(t, errors.Is(mr.FreezeContext(asAdmin(operator), chainDID), ErrPermissionDenied))
+	members, err := rb.Members(RoleAuditor)
+	assert.Nil(t, err)
+	assert.Equal(t, []DID{auditor}, members)
+
+	entries, err := l.Entries(0, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, ActionGrantRole, entries[1].Action)
+	assert.Equal(t, superAdmin, entries[1].Caller)
+	assert.Equal(t, RoleAuditor, entries[1].Role)
+	assert.Nil(t, l.Verify(nil))
+}
+
+func TestRBACAccountDIDAndVC(t *testing.T) {
+	r, drtPath, ddbPath := newDIDModeInternal(t)
+	defer os.RemoveAll(drtPath)
+	defer os.RemoveAll(ddbPath)
+	s := r.Table.(*KVTable).Store
+	rb, err := NewRBAC(s)
+	assert.Nil(t, err)
+	WithAccountRBAC(rb)(r)
+	testSetupDIDSucceed(t, r)
+	assert.Nil(t, r.GrantRoleContext(asAdmin(rootAccountDID), registrar, RoleRegistrar))
+	assert.Nil(t, r.GrantRoleContext(asAdmin(rootAccountDID), operator, RoleVCIssuer))
+
+	_, _, err = r.RegisterWithDocContext(asAdmin(operator), &accountDocA)
+	assert.True(t, errors.Is(err, ErrPermissionDenied))
+	// on behalf of the user
+	_, _, err = r.RegisterWithDocContext(asAdmin(registrar), &accountDocA)
+	assert.Nil(t, err)
+	// by the user itself
+	_, _, err = r.UpdateWithDocContext(asAdmin(testAccountDID), &accountDocA)
+	assert.Nil(t, err)
+	assert.True(t, errors.Is(r.FreezeContext(asAdmin(registrar), testAccountDID), ErrPermissionDenied))
+
+	// roles are persisted
+	rb2, err := NewRBAC(s)
+	assert.Nil(t, err)
+	vcr, err := NewVCRegistry(s, WithVCRBAC(rb2))
+	assert.Nil(t, err)
+	_, err = vcr.StoreVCContext(asAdmin(registrar), &testVC)
+	assert.True(t, errors.Is(err, ErrPermissionDenied))
+	_, err = vcr.StoreVCContext(asAdmin(operator), &testVC)
+	assert.Nil(t, err)
+	_, err = vcr.CreateClaimTypContext(asAdmin(operator), &ClaimTyp{ID: "ct"})
+	assert.True(t, errors.Is(err, ErrPermissionDenied))
+	// deletes without a caller are refused
+	assert.True(t, errors.Is(vcr.DeleteVCContext(context.Background(), testVC.ID), ErrPermissionDenied))
+	assert.True(t, errors.Is(vcr.DeleteClaimtypContext(context.Background(), "ct"), ErrPermissionDenied))
+	assert.Nil(t, vcr.DeleteVCContext(asAdmin(operator), testVC.ID))
+}
+
+func TestRBACGovernance(t *testing.T) {
+	mr, g, tablePath := newGovernedChainDID(t)
+	defer os.RemoveAll(tablePath)
+	rb, err := NewRBAC(g.Store)
+	assert.Nil(t, err)
+	WithChainRBAC(rb)(mr)
+
+	assert.True(t, errors.Is(mr.GrantRoleContext(asAdmin(superAdmin), auditor, RoleAuditor), ErrPermissionDenied))
+	p, err := g.Propose(asAdmin(superAdmin), &Proposal{Action: ActionGrantRole, Target: auditor, Role: RoleAuditor})
+	assert.Nil(t, err)
+	p, err = g.Vote(asAdmin(admin), p.ID, true)
+	assert.Nil(t, err)
+	assert.Equal(t, ProposalExecuted, p.State)
+	roles, err := rb.Roles(auditor)
+	assert.Nil(t, err)
+	assert.Equal(t, []Role{RoleAuditor}, roles)
+}
+
+func TestRBACShared(t *testing.T) {
+	mr, tablePath, docdbPath := newChainDIDModeInternal(t)
+	defer os.RemoveAll(tablePath)
+	defer os.RemoveAll(docdbPath)
+	r, drtPath, ddbPath := newDIDModeInternal(t)
+	defer os.RemoveAll(drtPath)
+	defer os.RemoveAll(ddbPath)
+	rb, err := NewRBAC(mr.Table.(*KVTable).Store)
+	assert.Nil(t, err)
+	WithChainRBAC(rb)(mr)
+	WithAccountRBAC(rb)(r)
+	testChainDIDSetupGenesSucceed(t, mr)
+	testSetupDIDSucceed(t, r)
+
+	// roles are shared while admins are scoped to their registries
+	assert.Nil(t, mr.GrantRoleContext(asAdmin(superAdmin), auditor, RoleAuditor))
+	assert.Nil(t, r.GrantRoleContext(asAdmin(rootAccountDID), registrar, RoleRegistrar))
+	has, err := rb.HasRole(registrar, RoleRegistrar)
+	assert.Nil(t, err)
+	assert.True(t, has)
+	assert.Nil(t, mr.RBAC.Check(asAdmin(superAdmin), PermAdmin))
+	assert.Nil(t, r.RBAC.Check(asAdmin(rootAccountDID), PermAdmin))
+	assert.True(t, errors.Is(rb.Check(asAdmin(superAdmin), PermAdmin), ErrPermissionDenied))
+	assert.True(t, errors.Is(mr.FreezeContext(asAdmin(rootAccountDID), rootChainDID), ErrPermissionDenied))
+	assert.True(t, errors.Is(mr.AddAdminContext(asAdmin(rootAccountDID), rootAccountDID), ErrPermissionDenied))
+	assert.True(t, errors.Is(r.FreezeContext(asAdmin(superAdmin), rootAccountDID), ErrPermissionDenied))
+}
@@ -0,0 +1,473 @@
+package bitxid
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/meshplus/bitxhub-kit/crypto"
+	"github.com/meshplus/bitxhub-kit/storage"
+)
+
+// ChangeOp .
+type ChangeOp string
+
+// operations of replicated changes
+const (
+	ChangeCreate    ChangeOp = "Create"
+	ChangeUpdate    ChangeOp = "Update"
+	ChangeTombstone ChangeOp = "Tombstone"
+)
+
+// Change is a change of a chain did item in the source registry
+type Change struct {
+	Seq      uint64     `json:"seq"` // starts from 1
+	Op       ChangeOp   `json:"op"`
+	DID      DID        `json:"did"`
+	Item     *ChainItem `json:"item,omitempty"`      // the item after the change, nil for tombstones
+	PrevHash []byte     `json:"prev_hash,omitempty"` // hash of the item before the change, nil for creations
+}
+
+// ChangeBatch is a signed batch of consecutive changes of a source registry
+type ChangeBatch struct {
+	Source    DID            `json:"source"` // genesis chain did of the source registry
+	From      uint64         `json:"from"`   // seq of the first change
+	Changes   []*Change      `json:"changes"`
+	KeyType   crypto.KeyType `json:"key_type"`
+	Signer    string         `json:"signer"` // address of the signing key
+	Signature []byte         `json:"signature,omitempty"`
+}
+
+// Digest computes the digest signed by the source registry
+func (b *ChangeBatch) Digest() ([]byte, error) {
+	c := *b
+	c.Signature = nil
+	return digestOf(&c)
+}
+
+// ChangeSource serves change batches of a registry from seq from,
+// an empty batch means no more changes
+type ChangeSource interface {
+	Batch(from uint64, limit int) (*ChangeBatch, error)
+}
+
+// ChangeLog records changes of chain did items of a registry, and serves
+// them as signed batches for replicas. It decorates the table of the
+// registry (see WithChainChangeLog) so that a change is recorded along with
+// the table write, and a change which can not be recorded is not written.
+type ChangeLog struct {
+	Table    RegistryTable // the decorated table, set by WithChainChangeLog
+	Store    storage.Storage
+	Key      crypto.PrivateKey // signs batches
+	registry *ChainDIDRegistry
+	seq      uint64
+	heads    map[DID][]byte // hash of the latest item of dids
+	lock     sync.Mutex
+}
+
+var _ RegistryTable = (*ChangeLog)(nil)
+var _ RegistryTableContext = (*ChangeLog)(nil)
+var _ ProvableTable = (*ChangeLog)(nil)
+var _ ChangeSource = (*ChangeLog)(nil)
+
+// NewChangeLog news a ChangeLog of r in s, continuing stored changes.
+// Set it to r by WithChainChangeLog to record changes.
+func NewChangeLog(r *ChainDIDRegistry, s storage.Storage, key crypto.PrivateKey) (*ChangeLog, error) {
+	l := &ChangeLog{Store: s, Key: key, registry: r, heads: make(map[DID][]byte)}
+	it := s.Prefix([]byte(chgPrefix))
+	for it.Next() {
+		c := &Change{}
+		if err := decodeRecord(it.Value(), c); err != nil {
+			return nil, fmt.Errorf("change log unmarshal %s: %w", it.Key(), err)
+		}
+		if err := l.track(c); err != nil {
+			return nil, err
+		}
+		if c.Seq > l.seq {
+			l.seq = c.Seq
+		}
+	}
+	return l, nil
+}
+
+// HasItem .
+func (l *ChangeLog) HasItem(did DID) bool {
+	return l.Table.HasItem(did)
+}
+
+// HasItemContext .
+func (l *ChangeLog) HasItemContext(ctx context.Context, did DID) (bool, error) {
+	return TableWithContext(l.Table).HasItemContext(ctx, did)
+}
+
+// GetItem .
+func (l *ChangeLog) GetItem(did DID, typ DIDType) (TableItem, error) {
+	return l.Table.GetItem(did, typ)
+}
+
+// GetItemContext .
+func (l *ChangeLog) GetItemContext(ctx context.Context, did DID, typ DIDType) (TableItem, error) {
+	return TableWithContext(l.Table).GetItemContext(ctx, did, typ)
+}
+
+// CreateItem creates item and records the creation
+func (l *ChangeLog) CreateItem(item TableItem) error {
+	return l.CreateItemContext(context.Background(), item)
+}
+
+// CreateItemContext is CreateItem with context
+func (l *ChangeLog) CreateItemContext(ctx context.Context, item TableItem) error {
+	return l.record(ChangeCreate, item.GetID(), item, func() error {
+		return TableWithContext(l.Table).CreateItemContext(ctx, item)
+	})
+}
+
+// UpdateItem updates item and records the update
+func (l *ChangeLog) UpdateItem(item TableItem) error {
+	return l.UpdateItemContext(context.Background(), item)
+}
+
+// UpdateItemContext is UpdateItem with context
+func (l *ChangeLog) UpdateItemContext(ctx context.Context, item TableItem) error {
+	return l.record(ChangeUpdate, item.GetID(), item, func() error {
+		return TableWithContext(l.Table).UpdateItemContext(ctx, item)
+	})
+}
+
+// DeleteItem deletes item of did and records a tombstone
+func (l *ChangeLog) DeleteItem(did DID) {
+	_ = l.DeleteItemContext(context.Background(), did)
+}
+
+// DeleteItemContext is DeleteItem with context, the tombstone
+// is not recorded if the item is not deleted.
+func (l *ChangeLog) DeleteItemContext(ctx context.Context, did DID) error {
+	return l.record(ChangeTombstone, did, nil, func() error {
+		return TableWithContext(l.Table).DeleteItemContext(ctx, did)
+	})
+}
+
+// Close .
+func (l *ChangeLog) Close() error {
+	return l.Table.Close()
+}
+
+// Root gets root hash of the decorated table, nil if it is not provable
+func (l *ChangeLog) Root() []byte {
+	if pt, ok := l.Table.(ProvableTable); ok {
+		return pt.Root()
+	}
+	return nil
+}
+
+// Prove gets merkle proof of did from the decorated table
+func (l *ChangeLog) Prove(did DID) (*MerkleProof, error) {
+	if pt, ok := l.Table.(ProvableTable); ok {
+		return pt.Prove(did)
+	}
+	return nil, fmt.Errorf("change log: table is not provable")
+}
+
+// record prepares the change of did, writes it to the table by write and
+// persists it under the next seq. The lock is held throughout so that
+// seqs follow the order of table writes.
+func (l *ChangeLog) record(op ChangeOp, did DID, item TableItem, write func() error) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	c := &Change{Seq: l.seq + 1, Op: op, DID: did, PrevHash: l.heads[did]}
+	var hash []byte
+	if item != nil {
+		ci, ok := item.(*ChainItem)
+		if !ok {
+			return &InvalidFormatError{What: "change", Reason: fmt.Sprintf("item of %s is not a chain did item", did)}
+		}
+		var err error
+		if hash, err = ItemHash(ci); err != nil {
+			return fmt.Errorf("change item hash: %w", err)
+		}
+		c.Item = ci
+	}
+	data, err := encodeRecord(&JSONCodec{}, c)
+	if err != nil {
+		return fmt.Errorf("change marshal: %w", err)
+	}
+	if err := write(); err != nil {
+		return err
+	}
+	l.Store.Put(chgKey(c.Seq), data)
+	l.seq = c.Seq
+	if hash == nil {
+		delete(l.heads, did)
+	} else {
+		l.heads[did] = hash
+	}
+	return nil
+}
+
+// LastSeq gets seq of the last change
+func (l *ChangeLog) LastSeq() uint64 {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.seq
+}
+
+// Batch reads at most limit changes from seq from (inclusive) as a batch
+// signed by Key, limit <= 0 means no limit.
+func (l *ChangeLog) Batch(from uint64, limit int) (*ChangeBatch, error) {
+	if from == 0 {
+		from = 1
+	}
+	b := &ChangeBatch{Source: l.registry.GenesisChainDID, From: from, Changes: []*Change{}}
+	it := l.Store.Iterator(chgKey(from), []byte(chgPrefix+"~"))
+	for it.Next() {
+		if limit > 0 && len(b.Changes) >= limit {
+			break
+		}
+		c := &Change{}
+		if err := decodeRecord(it.Value(), c); err != nil {
+			return nil, fmt.Errorf("change log unmarshal %s: %w", it.Key(), err)
+		}
+		b.Changes = append(b.Changes, c)
+	}
+	signer, err := signerOf(l.Key)
+	if err != nil {
+		return nil, fmt.Errorf("change batch signer: %w", err)
+	}
+	b.KeyType = l.Key.Type()
+	b.Signer = signer
+	digest, err := b.Digest()
+	if err != nil {
+		return nil, fmt.Errorf("change batch digest: %w", err)
+	}
+	b.Signature, err = l.Key.Sign(digest)
+	if err != nil {
+		return nil, fmt.Errorf("change batch sign: %w", err)
+	}
+	return b, nil
+}
+
+func (l *ChangeLog) track(c *Change) error {
+	if c.Item == nil {
+		delete(l.heads, c.DID)
+		return nil
+	}
+	hash, err := ItemHash(c.Item)
+	if err != nil {
+		return fmt.Errorf("change item hash: %w", err)
+	}
+	l.heads[c.DID] = hash
+	return nil
+}
+
+func (l *ChangeLog) backingStore() storage.Storage {
+	return l.Store
+}
+
+func (l *ChangeLog) decorated() RegistryTable {
+	return l.Table
+}
+
+// Replica applies change batches of a source registry to a registry.
+// Batches should be signed by Signer, and changes are applied in order
+// of seq exactly once: replayed changes are skipped, and changes not
+// matching the local items are refused as conflicts.
+type Replica struct {
+	Store    storage.Storage // keeps the seq of applied changes
+	Source   DID             // genesis chain did of the source registry
+	Signer   string          // address of the key of the source signing batches
+	registry *ChainDIDRegistry
+	applied  uint64
+	lock     sync.Mutex
+}
+
+// NewReplica news a Replica applying changes of source to r
+func NewReplica(r *ChainDIDRegistry, s storage.Storage, source DID, signer string) (*Replica, error) {
+	rp := &Replica{Store: s, Source: source, Signer: signer, registry: r}
+	if data := s.Get(repKey(source)); data != nil {
+		applied, err := strconv.ParseUint(string(data), 10, 64)
+		if err != nil {
+			return nil, &InvalidFormatError{What: "replica state", Reason: string(source), Err: err}
+		}
+		rp.applied = applied
+	}
+	return rp, nil
+}
+
+// Applied gets seq of the last applied change
+func (rp *Replica) Applied() uint64 {
+	rp.lock.Lock()
+	defer rp.lock.Unlock()
+	return rp.applied
+}
+
+// Apply verifies and applies a batch, it may overlap applied changes
+// but should not leave a gap after them.
+func (rp *Replica) Apply(ctx context.Context, b *ChangeBatch) error {
+	rp.lock.Lock()
+	defer rp.lock.Unlock()
+	if b.Source != rp.Source {
+		return &InvalidFormatError{What: "change batch", Reason: fmt.Sprintf("from %s instead of %s", b.Source, rp.Source)}
+	}
+	if b.Signer != rp.Signer {
+		return &InvalidFormatError{What: "change batch", Reason: fmt.Sprintf("signed by %s instead of %s", b.Signer, rp.Signer)}
+	}
+	digest, err := b.Digest()
+	if err != nil {
+		return fmt.Errorf("change batch digest: %w", err)
+	}
+	if err := verifySignature("change batch", b.KeyType, b.Signer, digest, b.Signature); err != nil {
+		return err
+	}
+	if err := rp.registry.checkReplicated(b); err != nil {
+		return err
+	}
+	if len(b.Changes) == 0 {
+		return nil
+	}
+	if b.From > rp.applied+1 {
+		return &InvalidFormatError{What: "change batch", Reason: fmt.Sprintf("gap: batch from %d after applied %d", b.From, rp.applied)}
+	}
+	for i, c := range b.Changes {
+		if c.Seq != b.From+uint64(i) {
+			return &InvalidFormatError{What: "change batch", Reason: fmt.Sprintf("change %d out of order", c.Seq)}
+		}
+		if c.Seq <= rp.applied {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := rp.applyChange(ctx, c); err != nil {
+			return err
+		}
+		rp.applied = c.Seq
+		rp.Store.Put(repKey(rp.Source), []byte(strconv.FormatUint(rp.applied, 10)))
+	}
+	return nil
+}
+
+// CatchUp applies changes of src after the applied ones in batches of limit
+func (rp *Replica) CatchUp(ctx context.Context, src ChangeSource, limit int) error {
+	for {
+		b, err := src.Batch(rp.Applied()+1, limit)
+		if err != nil {
+			return fmt.Errorf("catch up: %w", err)
+		}
+		if len(b.Changes) == 0 {
+			return nil
+		}
+		if err := rp.Apply(ctx, b); err != nil {
+			return err
+		}
+	}
+}
+
+// applyChange applies c idempotently: changes whose result is already
+// the local state are skipped.
+func (rp *Replica) applyChange(ctx context.Context, c *Change) error {
+	t := rp.registry.table()
+	exist, err := t.HasItemContext(ctx, c.DID)
+	if err != nil {
+		return err
+	}
+	var local []byte
+	if exist {
+		item, err := t.GetItemContext(ctx, c.DID, ChainDIDType)
+		if err != nil {
+			return fmt.Errorf("replica get %s: %w", c.DID, err)
+		}
+		if local, err = ItemHash(item.(*ChainItem)); err != nil {
+			return fmt.Errorf("replica item hash: %w", err)
+		}
+	}
+	if c.Op == ChangeTombstone {
+		switch {
+		case !exist:
+			return nil
+		case !bytes.Equal(local, c.PrevHash):
+			return &ConflictError{ID: c.DID, Seq: c.Seq, Reason: "local item differs from the deleted one"}
+		}
+		return rp.registry.applyReplicated(ctx, c.Op, c.DID, nil)
+	}
+	if c.Item == nil || c.Item.ID != c.DID {
+		return &InvalidFormatError{What: "change", Reason: fmt.Sprintf("change %d carries no item of %s", c.Seq, c.DID)}
+	}
+	hash, err := ItemHash(c.Item)
+	if err != nil {
+		return fmt.Errorf("replica item hash: %w", err)
+	}
+	switch {
+	case exist && bytes.Equal(local, hash):
+		return nil
+	case c.Op == ChangeCreate && !exist:
+		return rp.registry.applyReplicated(ctx, c.Op, c.DID, c.Item)
+	case c.Op == ChangeCreate:
+		return &ConflictError{ID: c.DID, Seq: c.Seq, Reason: "item exists"}
+	case !exist:
+		return &ConflictError{ID: c.DID, Seq: c.Seq, Reason: "item not exists"}
+	case !bytes.Equal(local, c.PrevHash):
+		return &ConflictError{ID: c.DID, Seq: c.Seq, Reason: "local item differs from the updated one"}
+	}
+	return rp.registry.applyReplicated(ctx, c.Op, c.DID, c.Item)
+}
+
+// checkReplicated checks a batch replicated to a registry under a hierarchy:
+// it should be signed by the key signing items of the registry, and changes
+// of a subordinate should be in its namespace.
+func (r *ChainDIDRegistry) checkReplicated(b *ChangeBatch) error {
+	if r.RootSigner == "" {
+		return nil
+	}
+	if r.Delegation != nil {
+		if err := r.verifyOwnDelegation(); err != nil {
+			return err
+		}
+	}
+	if expected := r.itemSigner(r.Delegation); b.Signer != expected {
+		return &InvalidFormatError{What: "change batch", Reason: fmt.Sprintf("signed by %s instead of %s", b.Signer, expected)}
+	}
+	for _, c := range b.Changes {
+		if r.Delegation != nil && !r.Delegation.Covers(c.DID) {
+			return &PermissionDeniedError{Caller: b.Source, Op: fmt.Sprintf("replicate %s out of namespace %s", c.DID, r.Delegation.Namespace)}
+		}
+	}
+	return nil
+}
+
+// applyReplicated writes a replicated change of chainDID to the table and
+// emits it, item is nil for tombstones
+func (r *ChainDIDRegistry) applyReplicated(ctx context.Context, op ChangeOp, chainDID DID, item *ChainItem) error {
+	var err error
+	switch op {
+	case ChangeCreate:
+		err = r.table().CreateItemContext(ctx, item)
+	case ChangeUpdate:
+		err = r.table().UpdateItemContext(ctx, item)
+	case ChangeTombstone:
+		if err := r.table().DeleteItemContext(ctx, chainDID); err != nil {
+			return err
+		}
+		return r.emit(ctx, EventDeleted, chainDID, Initial)
+	default:
+		return &InvalidFormatError{What: "change", Reason: fmt.Sprintf("unknown op %s of %s", op, chainDID)}
+	}
+	if err != nil {
+		return err
+	}
+	return r.emit(ctx, EventReplicated, chainDID, item.Status)
+}
+
+const (
+	chgPrefix = "chg-"
+	repPrefix = "rep-"
+)
+
+func chgKey(seq uint64) []byte {
+	return []byte(fmt.Sprintf("%s%020d", chgPrefix, seq))
+}
+
+func repKey(source DID) []byte {
+	return []byte(repPrefix + string(source))
+}
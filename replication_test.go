@@ -0,0 +1,229 @@
+package bitxid
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func assertSameItem(t *testing.T, src, dst *ChainDIDRegistry, did DID) {
+	want, err := src.Table.GetItem(did, ChainDIDType)
+	assert.Nil(t, err)
+	got, err := dst.Table.GetItem(did, ChainDIDType)
+	assert.Nil(t, err)
+	assert.Equal(t, want, got)
+}
+
+func TestReplication(t *testing.T) {
+	src, tablePath, docdbPath := newChainDIDModeInternal(t)
+	defer os.RemoveAll(tablePath)
+	defer os.RemoveAll(docdbPath)
+	dst, dstPath := newChainDIDModeExternal(t)
+	defer os.RemoveAll(dstPath)
+
+	key, signer := newRootKey(t)
+	ls, lsPath := newTestStorage(t, "replication")
+	defer os.RemoveAll(lsPath)
+	log, err := NewChangeLog(src, ls, key)
+	assert.Nil(t, err)
+	WithChainChangeLog(log)(src)
+
+	testChainDIDSetupGenesSucceed(t, src)
+	assert.Nil(t, src.Apply(mcaller, chainDID))
+	assert.Nil(t, src.AuditApply(chainDID, true))
+	assert.Equal(t, uint64(5), log.LastSeq())
+
+	rs, rsPath := newTestStorage(t, "replication")
+	defer os.RemoveAll(rsPath)
+	rp, err := NewReplica(dst, rs, rootChainDID, signer)
+	assert.Nil(t, err)
+	ctx := context.Background()
+
+	b, err := log.Batch(1, 3)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(b.Changes))
+	assert.Equal(t, ChangeCreate, b.Changes[0].Op)
+	assert.Nil(t, rp.Apply(ctx, b))
+	assert.Equal(t, uint64(3), rp.Applied())
+	assertSameItem(t, src, dst, rootChainDID)
+	// replayed batches are skipped
+	assert.Nil(t, rp.Apply(ctx, b))
+	assert.Equal(t, uint64(3), rp.Applied())
+
+	// batches leaving a gap are refused
+	b, err = log.Batch(5, 0)
+	assert.Nil(t, err)
+	assert.True(t, errors.Is(rp.Apply(ctx, b), ErrInvalidFormat))
+
+	assert.Nil(t, rp.CatchUp(ctx, log, 2))
+	assert.Equal(t, log.LastSeq(), rp.Applied())
+	assertSameItem(t, src, dst, chainDID)
+
+	// freeze is replicated as an update, delete as an update of
+	// its decision and a tombstone
+	assert.Nil(t, src.Freeze(chainDID))
+	assert.Nil(t, src.Delete(chainDID))
+	b, err = log.Batch(rp.Applied()+1, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(b.Changes))
+	assert.Equal(t, ChangeUpdate, b.Changes[0].Op)
+	assert.Equal(t, ChangeUpdate, b.Changes[1].Op)
+	assert.Equal(t, ChangeTombstone, b.Changes[2].Op)
+	b, err = log.Batch(rp.Applied()+1, 1)
+	assert.Nil(t, err)
+	assert.Nil(t, rp.Apply(ctx, b))
+	assertSameItem(t, src, dst, rootChainDID)
+
+	// changes applied without persisting their seq are applied again idempotently
+	rs.Put(repKey(rootChainDID), []byte("5"))
+	rp, err = NewReplica(dst, rs, rootChainDID, signer)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(5), rp.Applied())
+	assert.Nil(t, rp.CatchUp(ctx, log, 0))
+	assert.Equal(t, log.LastSeq(), rp.Applied())
+	assert.False(t, dst.Table.HasItem(chainDID))
+	rs.Put(repKey(rootChainDID), []byte("7"))
+	rp, err = NewReplica(dst, rs, rootChainDID, signer)
+	assert.Nil(t, err)
+	assert.Nil(t, rp.CatchUp(ctx, log, 0))
+	assert.Equal(t, log.LastSeq(), rp.Applied())
+
+	// the change log continues from its store
+	log, err = NewChangeLog(src, ls, key)
+	assert.Nil(t, err)
+	assert.Equal(t, rp.Applied(), log.LastSeq())
+}
+
+func TestReplicationInvalid(t *testing.T) {
+	src, tablePath, docdbPath := newChainDIDModeInternal(t)
+	defer os.RemoveAll(tablePath)
+	defer os.RemoveAll(docdbPath)
+	dst, dstPath := newChainDIDModeExternal(t)
+	defer os.RemoveAll(dstPath)
+
+	key, signer := newRootKey(t)
+	ls, lsPath := newTestStorage(t, "replication")
+	defer os.RemoveAll(lsPath)
+	log, err := NewChangeLog(src, ls, key)
+	assert.Nil(t, err)
+	WithChainChangeLog(log)(src)
+	testChainDIDSetupGenesSucceed(t, src)
+	assert.Nil(t, src.Apply(mcaller, chainDID))
+
+	rs, rsPath := newTestStorage(t, "replication")
+	defer os.RemoveAll(rsPath)
+	ctx := context.Background()
+
+	// batches of other signers or sources, or tampered ones are refused
+	otherKey, otherSigner := newRootKey(t)
+	rp, err := NewReplica(dst, rs, rootChainDID, otherSigner)
+	assert.Nil(t, err)
+	b, err := log.Batch(1, 0)
+	assert.Nil(t, err)
+	assert.True(t, errors.Is(rp.Apply(ctx, b), ErrInvalidFormat))
+	rp, err = NewReplica(dst, rs, chainDID, signer)
+	assert.Nil(t, err)
+	assert.True(t, errors.Is(rp.Apply(ctx, b), ErrInvalidFormat))
+	rp, err = NewReplica(dst, rs, rootChainDID, signer)
+	assert.Nil(t, err)
+	b.Changes[0].Item.Owner = mcaller
+	assert.True(t, errors.Is(rp.Apply(ctx, b), ErrInvalidFormat))
+	forged, err := NewChangeLog(src, ls, otherKey)
+	assert.Nil(t, err)
+	b, err = forged.Batch(1, 0)
+	assert.Nil(t, err)
+	assert.True(t, errors.Is(rp.Apply(ctx, b), ErrInvalidFormat))
+	assert.Equal(t, uint64(0), rp.Applied())
+
+	assert.Nil(t, rp.CatchUp(ctx, log, 0))
+
+	// local changes diverging from the source are conflicts
+	assert.Nil(t, dst.AuditApply(chainDID, false))
+	assert.Nil(t, src.AuditApply(chainDID, true))
+	err = rp.CatchUp(ctx, log, 0)
+	assert.True(t, errors.Is(err, ErrConflict))
+	var ce *ConflictError
+	assert.True(t, errors.As(err, &ce))
+	assert.Equal(t, chainDID, ce.ID)
+	assert.Equal(t, log.LastSeq(), ce.Seq)
+	assert.Equal(t, log.LastSeq()-1, rp.Applied())
+
+	// changes are recorded only along with the table writes
+	seq := log.LastSeq()
+	item, err := src.Table.GetItem(chainDID, ChainDIDType)
+	assert.Nil(t, err)
+	assert.True(t, errors.Is(src.Table.CreateItem(item), ErrAlreadyExists))
+	assert.True(t, errors.Is(src.Table.UpdateItem(&AccountItem{BasicItem: BasicItem{ID: chainDID}}), ErrInvalidFormat))
+	assert.Equal(t, seq, log.LastSeq())
+	stored, err := src.Table.GetItem(chainDID, ChainDIDType)
+	assert.Nil(t, err)
+	assert.Equal(t, item, stored)
+}
+
+func TestReplicationDecorated(t *testing.T) {
+	src, tablePath, docdbPath := newChainDIDModeInternal(t)
+	defer os.RemoveAll(tablePath)
+	defer os.RemoveAll(docdbPath)
+	dst, dstPath := newChainDIDModeExternal(t)
+	defer os.RemoveAll(dstPath)
+
+	// the change log kept apart decorates a merkle table
+	mt, err := NewMerkleTable(src.Table, backingStore(src.Table))
+	assert.Nil(t, err)
+	src.Table = mt
+	key, signer := newRootKey(t)
+	ls, lsPath := newTestStorage(t, "replication")
+	defer os.RemoveAll(lsPath)
+	log, err := NewChangeLog(src, ls, key)
+	assert.Nil(t, err)
+	WithChainChangeLog(log)(src)
+	testChainDIDSetupGenesSucceed(t, src)
+	assert.Nil(t, src.Apply(mcaller, chainDID))
+
+	item, proof, err := src.ResolveWithProof(chainDID)
+	assert.Nil(t, err)
+	ok, err := VerifyInclusionProof(log.Root(), item, proof)
+	assert.Nil(t, err)
+	assert.True(t, ok)
+
+	// both items and changes are exported
+	buf := bytes.Buffer{}
+	_, err = ExportChainDIDRegistry(&buf, src, nil)
+	assert.Nil(t, err)
+	is, isPath := newTestStorage(t, "replication")
+	defer os.RemoveAll(isPath)
+	_, err = ImportSnapshot(&buf, SnapshotTarget{Table: is, Docdb: is})
+	assert.Nil(t, err)
+	assert.NotNil(t, is.Get(tbKey(chainDID)))
+	assert.NotNil(t, is.Get(chgKey(log.LastSeq())))
+
+	// replicated changes are emitted
+	es, esPath := newTestStorage(t, "replication")
+	defer os.RemoveAll(esPath)
+	el, err := NewEventLog(es)
+	assert.Nil(t, err)
+	WithChainEventSink(el)(dst)
+	rs, rsPath := newTestStorage(t, "replication")
+	defer os.RemoveAll(rsPath)
+	rp, err := NewReplica(dst, rs, rootChainDID, signer)
+	assert.Nil(t, err)
+	ctx := context.Background()
+
+	// registries under a hierarchy only apply batches of their own signer
+	_, otherSigner := newRootKey(t)
+	WithRootRegistry(otherSigner)(dst)
+	assert.True(t, errors.Is(rp.CatchUp(ctx, log, 0), ErrInvalidFormat))
+	assert.Equal(t, uint64(0), rp.Applied())
+	WithRootRegistry(signer)(dst)
+	assert.Nil(t, rp.CatchUp(ctx, log, 0))
+	assertSameItem(t, src, dst, chainDID)
+	evs, err := el.Read(1, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, int(log.LastSeq()), len(evs))
+	assert.Equal(t, EventReplicated, evs[len(evs)-1].Kind)
+	assert.Equal(t, chainDID, evs[len(evs)-1].DID)
+}
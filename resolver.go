@@ -0,0 +1,331 @@
+package bitxid
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Resolution is the result of resolving a did
+type Resolution struct {
+	Document Doc
+	Metadata *DocumentMetadata
+}
+
+// DocumentMetadata is the metadata of a resolved doc
+type DocumentMetadata struct {
+	Created uint64     `json:"created,omitempty"`
+	Updated uint64     `json:"updated,omitempty"`
+	Status  StatusType `json:"status,omitempty"` // status of the did item
+	DocHash string     `json:"docHash,omitempty"`
+}
+
+// Resolver resolves dids to their docs. Resolvers return errors matching
+// ErrMethodNotSupported for dids they do not handle, and ErrNotFound
+// for dids without docs.
+type Resolver interface {
+	ResolveDID(ctx context.Context, did DID) (*Resolution, error)
+}
+
+// ResolverFunc adapts a function to Resolver
+type ResolverFunc func(ctx context.Context, did DID) (*Resolution, error)
+
+// ResolveDID .
+func (f ResolverFunc) ResolveDID(ctx context.Context, did DID) (*Resolution, error) {
+	return f(ctx, did)
+}
+
+var (
+	_ Resolver = (*ChainDIDRegistry)(nil)
+	_ Resolver = (*AccountDIDRegistry)(nil)
+	_ Resolver = (*Router)(nil)
+)
+
+// ResolveDID resolves a chain did with its doc
+func (r *ChainDIDRegistry) ResolveDID(ctx context.Context, did DID) (*Resolution, error) {
+	if DIDType(did.GetType()) != ChainDIDType || did.GetRootMethod() != r.GenesisChainDID.GetRootMethod() {
+		return nil, &MethodNotSupportedError{Method: routeOf(did)}
+	}
+	item, doc, exist, err := r.ResolveContext(ctx, did)
+	if err != nil {
+		return nil, err
+	}
+	if !exist || (doc == nil && item.DocAddr == "") {
+		return nil, &NotFoundError{ID: string(did), Store: "chain did registry"}
+	}
+	if doc == nil {
+		if _, doc, err = r.ResolveFullContext(ctx, did); err != nil {
+			return nil, err
+		}
+	}
+	return &Resolution{Document: doc, Metadata: newDocumentMetadata(&doc.BasicDoc, &item.BasicItem)}, nil
+}
+
+// ResolveDID resolves an account did with its doc
+func (r *AccountDIDRegistry) ResolveDID(ctx context.Context, did DID) (*Resolution, error) {
+	if DIDType(did.GetType()) != AccountDIDType || did.GetRootMethod() != r.SelfChainDID.GetRootMethod() {
+		return nil, &MethodNotSupportedError{Method: routeOf(did)}
+	}
+	item, doc, _, err := r.ResolveContext(ctx, did)
+	if err != nil {
+		return nil, err
+	}
+	if doc == nil && item.DocAddr == "" {
+		return nil, &NotFoundError{ID: string(did), Store: "account did registry"}
+	}
+	if doc == nil {
+		if _, doc, err = r.ResolveFullContext(ctx, did); err != nil {
+			return nil, err
+		}
+	}
+	return &Resolution{Document: doc, Metadata: newDocumentMetadata(&doc.BasicDoc, &item.BasicItem)}, nil
+}
+
+func newDocumentMetadata(doc *BasicDoc, item *BasicItem) *DocumentMetadata {
+	meta := &DocumentMetadata{Created: doc.Created, Updated: doc.Updated, Status: item.Status}
+	if len(item.DocHash) != 0 {
+		meta.DocHash = fmt.Sprintf("%x", item.DocHash)
+	}
+	return meta
+}
+
+// UnsupportedMethodPolicy decides how a router resolves dids of methods
+// without registered resolvers
+type UnsupportedMethodPolicy int
+
+// policies for unsupported methods
+const (
+	RejectUnsupported   UnsupportedMethodPolicy = iota // fails with MethodNotSupportedError
+	NotFoundUnsupported                                // fails with NotFoundError
+	FallbackUnsupported                                // resolves by the fallback resolver
+)
+
+// Router dispatches dids to resolvers registered for their methods.
+// Resolvers are registered for a root method (e.g. key) or a root and
+// sub method (e.g. bitxhub:appchain001); the sub method one is tried
+// first and the root one next if it does not support the did.
+// Resolutions are cached if a cache is set, the cache is invalidated by
+// events of registries registered to the router.
+type Router struct {
+	gen      uint64 // bumped by events, resolutions started before are not cached
+	Policy   UnsupportedMethodPolicy
+	Fallback Resolver
+	routes   map[string]Resolver
+	cache    *lruCache
+	ttl      time.Duration // 0 means never expire
+	now      func() time.Time
+	lock     sync.RWMutex
+}
+
+type cachedResolution struct {
+	res     *Resolution
+	expires time.Time
+}
+
+// NewRouter news a Router rejecting unsupported methods by default
+func NewRouter(opts ...func(*Router)) *Router {
+	rt := &Router{routes: make(map[string]Resolver), now: time.Now}
+	for _, opt := range opts {
+		opt(rt)
+	}
+	return rt
+}
+
+// WithRouterCache used for caching at most size resolutions for ttl
+func WithRouterCache(size int, ttl time.Duration) func(*Router) {
+	return func(rt *Router) {
+		rt.cache = newLRUCache(size)
+		rt.ttl = ttl
+	}
+}
+
+// WithUnsupportedMethodPolicy used for setting the policy of unsupported methods
+func WithUnsupportedMethodPolicy(p UnsupportedMethodPolicy) func(*Router) {
+	return func(rt *Router) {
+		rt.Policy = p
+	}
+}
+
+// WithFallbackResolver used for resolving unsupported methods by res
+func WithFallbackResolver(res Resolver) func(*Router) {
+	return func(rt *Router) {
+		rt.Policy = FallbackUnsupported
+		rt.Fallback = res
+	}
+}
+
+// Register registers res for method, which is a root method or a root
+// and sub method joined by a colon. If res is a registry and the router
+// has a cache, the router subscribes to events of the registry.
+func (rt *Router) Register(method string, res Resolver) error {
+	if !DID("did:" + method + ":x").IsValid() {
+		return &InvalidFormatError{What: "method", Reason: method}
+	}
+	rt.lock.Lock()
+	defer rt.lock.Unlock()
+	if _, ok := rt.routes[method]; ok {
+		return &AlreadyExistsError{ID: method, Store: "router"}
+	}
+	rt.routes[method] = res
+	if rt.cache != nil {
+		switch r := res.(type) {
+		case *ChainDIDRegistry:
+			r.Events = rt.subscribe(r.Events)
+		case *AccountDIDRegistry:
+			r.Events = rt.subscribe(r.Events)
+		}
+	}
+	return nil
+}
+
+// subscribe adds the router to sink, the router goes first
+// so that the cache is invalidated even if sink fails
+func (rt *Router) subscribe(sink EventSink) EventSink {
+	if sink == nil {
+		return rt
+	}
+	if ms, ok := sink.(MultiSink); ok {
+		for _, s := range ms {
+			if s == EventSink(rt) {
+				return sink
+			}
+		}
+	} else if sink == EventSink(rt) {
+		return sink
+	}
+	return MultiSink{rt, sink}
+}
+
+// Emit invalidates cached resolutions changed by ev, making the router an
+// EventSink of registries. Account dids resolve Frozen along with their
+// chain did, so events of chain dids drop the whole cache.
+func (rt *Router) Emit(ev *Event) error {
+	if rt.cache == nil || ev.DID == "" {
+		return nil
+	}
+	atomic.AddUint64(&rt.gen, 1)
+	if ev.Type == ChainDIDType {
+		rt.cache.purge()
+		return nil
+	}
+	rt.cache.remove(string(ev.DID))
+	return nil
+}
+
+// ResolveDID resolves did by the resolver registered for its method
+func (rt *Router) ResolveDID(ctx context.Context, did DID) (*Resolution, error) {
+	if !did.IsValid() {
+		return nil, &InvalidFormatError{What: "did", Reason: string(did)}
+	}
+	if res, ok := rt.cached(did); ok {
+		return res, nil
+	}
+	gen := atomic.LoadUint64(&rt.gen)
+	res, err := rt.route(ctx, did)
+	if err != nil {
+		return nil, err
+	}
+	if atomic.LoadUint64(&rt.gen) == gen {
+		rt.store(did, res)
+	}
+	return res, nil
+}
+
+// Invalidate drops the cached resolution of did
+func (rt *Router) Invalidate(did DID) {
+	if rt.cache != nil {
+		rt.cache.remove(string(did))
+	}
+}
+
+// Stats gets statistics of the cache
+func (rt *Router) Stats() CacheStats {
+	if rt.cache == nil {
+		return CacheStats{}
+	}
+	return rt.cache.getStats()
+}
+
+func (rt *Router) route(ctx context.Context, did DID) (*Resolution, error) {
+	candidates := []string{did.GetMethod()}
+	if did.IsValidFormat() {
+		candidates = []string{routeOf(did), did.GetMethod()}
+	}
+	for _, method := range candidates {
+		rt.lock.RLock()
+		res, ok := rt.routes[method]
+		rt.lock.RUnlock()
+		if !ok {
+			continue
+		}
+		r, err := res.ResolveDID(ctx, did)
+		if err == nil || !errors.Is(err, ErrMethodNotSupported) {
+			return r, err
+		}
+	}
+	switch rt.Policy {
+	case NotFoundUnsupported:
+		return nil, &NotFoundError{ID: string(did), Store: "router"}
+	case FallbackUnsupported:
+		if rt.Fallback != nil {
+			return rt.Fallback.ResolveDID(ctx, did)
+		}
+	}
+	return nil, &MethodNotSupportedError{Method: did.GetMethod()}
+}
+
+func (rt *Router) cached(did DID) (*Resolution, bool) {
+	if rt.cache == nil {
+		return nil, false
+	}
+	v, ok := rt.cache.get(string(did))
+	if !ok {
+		return nil, false
+	}
+	entry := v.(*cachedResolution)
+	if !entry.expires.IsZero() && rt.now().After(entry.expires) {
+		rt.cache.remove(string(did))
+		return nil, false
+	}
+	return cloneResolution(entry.res)
+}
+
+func (rt *Router) store(did DID, res *Resolution) {
+	if rt.cache == nil {
+		return
+	}
+	cloned, ok := cloneResolution(res)
+	if !ok {
+		return
+	}
+	entry := &cachedResolution{res: cloned}
+	if rt.ttl > 0 {
+		entry.expires = rt.now().Add(rt.ttl)
+	}
+	rt.cache.add(string(did), entry)
+}
+
+// cloneResolution clones res, resolutions of unknown doc types are not cloned
+func cloneResolution(res *Resolution) (*Resolution, bool) {
+	doc, ok := cloneDoc(res.Document)
+	if !ok {
+		return nil, false
+	}
+	c := &Resolution{Document: doc}
+	if res.Metadata != nil {
+		meta := *res.Metadata
+		c.Metadata = &meta
+	}
+	return c, true
+}
+
+// routeOf gets the root and sub method of a did of this registry
+func routeOf(did DID) string {
+	if !did.IsValidFormat() {
+		return did.GetMethod()
+	}
+	return did.GetRootMethod() + ":" + did.GetSubMethod()
+}
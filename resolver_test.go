@@ -0,0 +1,136 @@
+package bitxid
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestResolver(calls *int, typ DIDType) Resolver {
+	return ResolverFunc(func(ctx context.Context, did DID) (*Resolution, error) {
+		*calls++
+		if typ != 0 && DIDType(did.GetType()) != typ {
+			return nil, &MethodNotSupportedError{Method: routeOf(did)}
+		}
+		doc := &AccountDoc{}
+		doc.ID = did
+		return &Resolution{Document: doc, Metadata: &DocumentMetadata{Status: Normal}}, nil
+	})
+}
+
+func TestRouter(t *testing.T) {
+	var chainCalls, accountCalls, keyCalls int
+	rt := NewRouter()
+	assert.Nil(t, rt.Register("bitxhub", newTestResolver(&chainCalls, ChainDIDType)))
+	assert.Nil(t, rt.Register("bitxhub:appchain001", newTestResolver(&accountCalls, AccountDIDType)))
+	assert.Nil(t, rt.Register("key", newTestResolver(&keyCalls, 0)))
+	assert.True(t, errors.Is(rt.Register("key", newTestResolver(&keyCalls, 0)), ErrAlreadyExists))
+	assert.True(t, errors.Is(rt.Register("Key", newTestResolver(&keyCalls, 0)), ErrInvalidFormat))
+	ctx := context.Background()
+
+	res, err := rt.ResolveDID(ctx, testAccountDID)
+	assert.Nil(t, err)
+	assert.Equal(t, testAccountDID, res.Document.GetID())
+	assert.Equal(t, 1, accountCalls)
+	// chain dids fall through from the sub method to the root method
+	_, err = rt.ResolveDID(ctx, chainDID)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, accountCalls)
+	assert.Equal(t, 1, chainCalls)
+	_, err = rt.ResolveDID(ctx, "did:key:z6MkhaXgBZDvotDkL5257faiztiGiC2QtKLGpbnnEGta2doK")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, keyCalls)
+
+	_, err = rt.ResolveDID(ctx, "did:web:example.com")
+	assert.True(t, errors.Is(err, ErrMethodNotSupported))
+	_, err = rt.ResolveDID(ctx, "did:web")
+	assert.True(t, errors.Is(err, ErrInvalidFormat))
+
+	rt.Policy = NotFoundUnsupported
+	_, err = rt.ResolveDID(ctx, "did:web:example.com")
+	assert.True(t, errors.Is(err, ErrNotFound))
+
+	var webCalls int
+	WithFallbackResolver(newTestResolver(&webCalls, 0))(rt)
+	res, err = rt.ResolveDID(ctx, "did:web:example.com")
+	assert.Nil(t, err)
+	assert.Equal(t, DID("did:web:example.com"), res.Document.GetID())
+	assert.Equal(t, 1, webCalls)
+}
+
+func TestRouterCache(t *testing.T) {
+	var calls int
+	now := time.Now()
+	rt := NewRouter(WithRouterCache(2, time.Minute))
+	rt.now = func() time.Time { return now }
+	assert.Nil(t, rt.Register("bitxhub", newTestResolver(&calls, 0)))
+	ctx := context.Background()
+
+	res, err := rt.ResolveDID(ctx, testAccountDID)
+	assert.Nil(t, err)
+	res.Document.(*AccountDoc).Service = "changed"
+	res, err = rt.ResolveDID(ctx, testAccountDID)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, "", res.Document.(*AccountDoc).Service)
+	assert.Equal(t, uint64(1), rt.Stats().Hits)
+
+	rt.Invalidate(testAccountDID)
+	_, err = rt.ResolveDID(ctx, testAccountDID)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, calls)
+
+	now = now.Add(2 * time.Minute)
+	_, err = rt.ResolveDID(ctx, testAccountDID)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, calls)
+
+	// failures are not cached
+	_, err = rt.ResolveDID(ctx, "did:web:example.com")
+	assert.True(t, errors.Is(err, ErrMethodNotSupported))
+	assert.Equal(t, 1, rt.Stats().Size)
+}
+
+func TestRouterRegistryEvents(t *testing.T) {
+	mr, tablePath, docdbPath := newChainDIDModeInternal(t)
+	defer os.RemoveAll(tablePath)
+	defer os.RemoveAll(docdbPath)
+	r, drtPath, ddbPath := newDIDModeInternal(t)
+	defer os.RemoveAll(drtPath)
+	defer os.RemoveAll(ddbPath)
+	WithChainDIDResolver(mr)(r)
+	testChainDIDSetupGenesSucceed(t, mr)
+	testChainDIDApplySucceed(t, mr)
+	testChainDIDAuditApplySucceed(t, mr)
+	testChainDIDRegisterSucceedInternal(t, mr)
+	testSetupDIDSucceed(t, r)
+	testDIDRegisterSucceedInternal(t, r)
+
+	// never expires, kept fresh by events
+	rt := NewRouter(WithRouterCache(16, 0))
+	assert.Nil(t, rt.Register("bitxhub", mr))
+	assert.Nil(t, rt.Register("bitxhub:appchain001", r))
+	assert.Nil(t, rt.Register("bitxhub:relayroot", r))
+	ctx := context.Background()
+	for _, did := range []DID{chainDID, testAccountDID} {
+		res, err := rt.ResolveDID(ctx, did)
+		assert.Nil(t, err)
+		assert.Equal(t, Normal, res.Metadata.Status)
+	}
+
+	assert.Nil(t, mr.Freeze(chainDID))
+	for _, did := range []DID{chainDID, testAccountDID} {
+		res, err := rt.ResolveDID(ctx, did)
+		assert.Nil(t, err)
+		assert.Equal(t, Frozen, res.Metadata.Status)
+	}
+	assert.Nil(t, mr.UnFreeze(chainDID))
+
+	assert.Nil(t, r.Delete(testAccountDID))
+	_, err := rt.ResolveDID(ctx, testAccountDID)
+	assert.True(t, errors.Is(err, ErrNotFound))
+}
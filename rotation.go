@@ -0,0 +1,240 @@
+package bitxid
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+
+	"github.com/meshplus/bitxhub-kit/crypto"
+)
+
+// KeyRotation replaces the public keys and authentication of a doc, it is
+// signed by the current authentication keys of the doc. If the doc commits
+// to the next keys, the rotation should reveal exactly the committed ones.
+type KeyRotation struct {
+	DID               DID            `json:"did"`
+	PublicKey         []PubKey       `json:"publicKey"`
+	Authentication    []Auth         `json:"authentication"`
+	NextKeyCommitment []byte         `json:"nextKeyCommitment,omitempty"` // commitment of the keys of the next rotation
+	Timestamp         uint64         `json:"timestamp"`                   // becomes Updated of the doc, should be after the former one
+	Signatures        []KeySignature `json:"signatures,omitempty"`
+}
+
+// Digest computes the digest signed by the authentication keys
+func (rot *KeyRotation) Digest() ([]byte, error) {
+	c := *rot
+	c.Signatures = nil
+	return digestOf(&c)
+}
+
+// SignKeyRotation signs rot with key whose id is keyID in the doc,
+// Ed25519 keys sign Digest of rot themselves.
+func SignKeyRotation(rot *KeyRotation, keyID string, key crypto.PrivateKey) error {
+	digest, err := rot.Digest()
+	if err != nil {
+		return fmt.Errorf("key rotation digest: %w", err)
+	}
+	sig, err := key.Sign(digest)
+	if err != nil {
+		return fmt.Errorf("key rotation sign: %w", err)
+	}
+	rot.Signatures = append(rot.Signatures, KeySignature{KeyID: keyID, Signature: sig})
+	return nil
+}
+
+// keySet is what a KeyCommitment commits to
+type keySet struct {
+	PublicKey      []PubKey `pb:"1"`
+	Authentication []Auth   `pb:"2"`
+}
+
+// KeyCommitment computes the commitment of the keys and authentication
+// of a future rotation, which is set as NextKeyCommitment of docs
+func KeyCommitment(keys []PubKey, auths []Auth) ([]byte, error) {
+	data, err := protoMarshal(&keySet{PublicKey: keys, Authentication: auths})
+	if err != nil {
+		return nil, err
+	}
+	hash := sha256.Sum256(data)
+	return hash[:], nil
+}
+
+// Rotate applies rot to a copy of the doc. Keys of the doc not kept by rot
+// are moved to RevokedKeys, revoked at the timestamp of rot, and revoked
+// keys can not be added back.
+func (bd *BasicDoc) Rotate(rot *KeyRotation) (*BasicDoc, error) {
+	if rot.DID != bd.ID {
+		return nil, &InvalidFormatError{What: "key rotation", Reason: fmt.Sprintf("rotation of %s applied to %s", rot.DID, bd.ID)}
+	}
+	if rot.Timestamp <= bd.Updated || rot.Timestamp <= bd.Created {
+		return nil, &InvalidFormatError{What: "key rotation", Reason: fmt.Sprintf("timestamp %d is not after %d", rot.Timestamp, bd.Updated)}
+	}
+	digest, err := rot.Digest()
+	if err != nil {
+		return nil, fmt.Errorf("key rotation digest: %w", err)
+	}
+	if err := bd.VerifyAuthentication(digest, rot.Signatures); err != nil {
+		return nil, err
+	}
+	if len(bd.NextKeyCommitment) != 0 {
+		commitment, err := KeyCommitment(rot.PublicKey, rot.Authentication)
+		if err != nil {
+			return nil, fmt.Errorf("key commitment: %w", err)
+		}
+		if !bytes.Equal(commitment, bd.NextKeyCommitment) {
+			return nil, &PermissionDeniedError{Caller: bd.ID, Op: "rotate to keys not committed"}
+		}
+	}
+
+	rotated := cloneBasicDoc(*bd)
+	rotated.PublicKey = append([]PubKey{}, rot.PublicKey...)
+	rotated.Authentication = cloneBasicDoc(BasicDoc{Authentication: rot.Authentication}).Authentication
+	rotated.NextKeyCommitment = cloneBytes(rot.NextKeyCommitment)
+	rotated.Updated = rot.Timestamp
+	if err := rotated.checkKeys(); err != nil {
+		return nil, err
+	}
+	for _, pk := range bd.PublicKey {
+		if !containsKey(rotated.PublicKey, pk) {
+			rotated.RevokedKeys = append(rotated.RevokedKeys, RevokedKey{Key: pk, Revoked: rot.Timestamp})
+		}
+	}
+	return &rotated, nil
+}
+
+// checkKeys checks that keys of the doc are parsable and not revoked,
+// and its authentication is satisfiable by them
+func (bd *BasicDoc) checkKeys() error {
+	if len(bd.Authentication) == 0 {
+		return &InvalidFormatError{What: "doc", Reason: fmt.Sprintf("%s has no authentication", bd.ID)}
+	}
+	for _, pk := range bd.PublicKey {
+		key, err := ParsePubKey(pk)
+		if err != nil {
+			return err
+		}
+		for _, revoked := range bd.RevokedKeys {
+			if old, err := ParsePubKey(revoked.Key); err == nil && old.Type == key.Type && bytes.Equal(old.Key, key.Key) {
+				return &InvalidFormatError{What: "doc", Reason: fmt.Sprintf("key %s was revoked at %d", pk.ID, revoked.Revoked)}
+			}
+		}
+	}
+	for _, auth := range bd.Authentication {
+		if _, err := authThreshold(auth); err != nil {
+			return err
+		}
+		for _, id := range auth.PublicKey {
+			if _, err := bd.VerificationKey(id); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func containsKey(keys []PubKey, pk PubKey) bool {
+	for _, k := range keys {
+		if k == pk {
+			return true
+		}
+	}
+	return false
+}
+
+// checkKeysKept refuses updates not authenticated by the keys of the doc
+// which change its commitment or revoked keys, or change the keys of a doc
+// under rotation (with a commitment or revoked keys), so that commitments
+// can not be got around and revoked keys can not be added back.
+func checkKeysKept(ctx context.Context, stored, updated *BasicDoc) error {
+	if authenticated, _ := ctx.Value(docAuthKey).(bool); authenticated {
+		return nil
+	}
+	caller, _ := CallerFromContext(ctx)
+	if !bytes.Equal(stored.NextKeyCommitment, updated.NextKeyCommitment) || !sameRevokedKeys(stored.RevokedKeys, updated.RevokedKeys) {
+		return &PermissionDeniedError{Caller: caller, Op: fmt.Sprintf("change key commitment of %s without rotation", updated.ID)}
+	}
+	if len(stored.NextKeyCommitment) == 0 && len(stored.RevokedKeys) == 0 {
+		return nil
+	}
+	old, err := KeyCommitment(stored.PublicKey, stored.Authentication)
+	if err != nil {
+		return fmt.Errorf("key commitment: %w", err)
+	}
+	keys, err := KeyCommitment(updated.PublicKey, updated.Authentication)
+	if err != nil {
+		return fmt.Errorf("key commitment: %w", err)
+	}
+	if !bytes.Equal(old, keys) {
+		return &PermissionDeniedError{Caller: caller, Op: fmt.Sprintf("change keys of %s without rotation", updated.ID)}
+	}
+	return nil
+}
+
+func sameRevokedKeys(a, b []RevokedKey) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// withDocAuthentication marks ctx as making a change authenticated by the
+// keys of the doc
+func withDocAuthentication(ctx context.Context) context.Context {
+	return context.WithValue(ctx, docAuthKey, true)
+}
+
+// RotateKeys rotates keys of a chain did, docs should be stored by the
+// registry (InternalDocDB mode). Former docs are kept by CASDocDB.
+func (r *ChainDIDRegistry) RotateKeys(rot *KeyRotation) (string, []byte, error) {
+	return r.RotateKeysContext(context.Background(), rot)
+}
+
+// RotateKeysContext is RotateKeys with context
+func (r *ChainDIDRegistry) RotateKeysContext(ctx context.Context, rot *KeyRotation) (string, []byte, error) {
+	if r.Mode != InternalDocDB {
+		return "", nil, fmt.Errorf("rotate keys: docs are not stored under ExternalDocDB mode")
+	}
+	_, doc, err := r.ResolveFullContext(ctx, rot.DID)
+	if err != nil {
+		return "", nil, err
+	}
+	if doc == nil {
+		return "", nil, &NotFoundError{ID: string(rot.DID), Store: "chain did registry"}
+	}
+	bd, err := doc.Rotate(rot)
+	if err != nil {
+		return "", nil, err
+	}
+	return r.UpdateWithDocContext(withDocAuthentication(ctx), &ChainDoc{BasicDoc: *bd, Extra: cloneBytes(doc.Extra)})
+}
+
+// RotateKeys rotates keys of an account did, docs should be stored by the
+// registry (InternalDocDB mode). Former docs are kept by CASDocDB.
+func (r *AccountDIDRegistry) RotateKeys(rot *KeyRotation) (string, []byte, error) {
+	return r.RotateKeysContext(context.Background(), rot)
+}
+
+// RotateKeysContext is RotateKeys with context
+func (r *AccountDIDRegistry) RotateKeysContext(ctx context.Context, rot *KeyRotation) (string, []byte, error) {
+	if r.Mode != InternalDocDB {
+		return "", nil, fmt.Errorf("rotate keys: docs are not stored under ExternalDocDB mode")
+	}
+	_, doc, err := r.ResolveFullContext(ctx, rot.DID)
+	if err != nil {
+		return "", nil, err
+	}
+	if doc == nil {
+		return "", nil, &NotFoundError{ID: string(rot.DID), Store: "account did registry"}
+	}
+	bd, err := doc.Rotate(rot)
+	if err != nil {
+		return "", nil, err
+	}
+	return r.UpdateWithDocContext(withDocAuthentication(ctx), &AccountDoc{BasicDoc: *bd, Service: doc.Service})
+}
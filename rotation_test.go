@@ -0,0 +1,164 @@
+package bitxid
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/meshplus/bitxhub-kit/crypto"
+	"github.com/meshplus/bitxhub-kit/crypto/asym"
+	"github.com/stretchr/testify/assert"
+)
+
+func newRotationKey(t *testing.T, id string) (crypto.PrivateKey, PubKey) {
+	key, err := asym.GenerateKeyPair(crypto.Secp256k1)
+	assert.Nil(t, err)
+	vk, err := verificationKeyOf(key.PublicKey())
+	assert.Nil(t, err)
+	vk.ID = id
+	return key, vk.PubKey()
+}
+
+func TestRotateKeys(t *testing.T) {
+	r, drtPath, ddbPath := newDIDModeInternal(t)
+	defer os.RemoveAll(drtPath)
+	defer os.RemoveAll(ddbPath)
+	rb, err := NewRBAC(r.Table.(*KVTable).Store)
+	assert.Nil(t, err)
+	WithAccountRBAC(rb)(r)
+	testSetupDIDSucceed(t, r)
+	assert.Nil(t, r.GrantRoleContext(asAdmin(rootAccountDID), registrar, RoleRegistrar))
+
+	key1, pk1 := newRotationKey(t, "KEY#1")
+	key2, pk2 := newRotationKey(t, "KEY#2")
+	key3, pk3 := newRotationKey(t, "KEY#3")
+	doc := getAccountDoc(2)
+	doc.PublicKey = []PubKey{pk1}
+	doc.Authentication = []Auth{{PublicKey: []string{"KEY#1"}, Strategy: "1-of-1"}}
+	_, _, err = r.RegisterWithDocContext(asAdmin(registrar), &doc)
+	assert.Nil(t, err)
+
+	next := []Auth{{PublicKey: []string{"KEY#3"}, Strategy: "1-of-1"}}
+	commitment, err := KeyCommitment([]PubKey{pk3}, next)
+	assert.Nil(t, err)
+	rot := &KeyRotation{
+		DID:               testAccountDID,
+		PublicKey:         []PubKey{pk2},
+		Authentication:    []Auth{{PublicKey: []string{"KEY#2"}, Strategy: "1-of-1"}},
+		NextKeyCommitment: commitment,
+		Timestamp:         doc.Created + 1,
+	}
+	_, _, err = r.RotateKeys(rot)
+	assert.True(t, errors.Is(err, ErrPermissionDenied))
+	assert.Nil(t, SignKeyRotation(rot, "KEY#2", key2))
+	_, _, err = r.RotateKeys(rot)
+	assert.True(t, errors.Is(err, ErrPermissionDenied))
+	// signed by the current key, without the caller being the did
+	assert.Nil(t, SignKeyRotation(rot, "KEY#1", key1))
+	_, _, err = r.RotateKeys(rot)
+	assert.Nil(t, err)
+
+	_, rotated, err := r.ResolveFull(testAccountDID)
+	assert.Nil(t, err)
+	assert.Equal(t, []PubKey{pk2}, rotated.PublicKey)
+	assert.Equal(t, []RevokedKey{{Key: pk1, Revoked: doc.Created + 1}}, rotated.RevokedKeys)
+	assert.Equal(t, commitment, rotated.NextKeyCommitment)
+	assert.Equal(t, doc.Created+1, rotated.Updated)
+	assert.Equal(t, doc.Service, rotated.Service)
+
+	// updates can not get around the commitment
+	forged := AccountDoc{BasicDoc: cloneBasicDoc(rotated.BasicDoc), Service: "changed"}
+	forged.PublicKey = []PubKey{pk1}
+	forged.Authentication = []Auth{{PublicKey: []string{"KEY#1"}, Strategy: "1-of-1"}}
+	_, _, err = r.UpdateWithDocContext(asAdmin(registrar), &forged)
+	assert.True(t, errors.Is(err, ErrPermissionDenied))
+	forged.BasicDoc = cloneBasicDoc(rotated.BasicDoc)
+	forged.NextKeyCommitment = nil
+	_, _, err = r.UpdateWithDocContext(asAdmin(testAccountDID), &forged)
+	assert.True(t, errors.Is(err, ErrPermissionDenied))
+	forged.BasicDoc = cloneBasicDoc(rotated.BasicDoc)
+	forged.RevokedKeys = nil
+	_, _, err = r.UpdateWithDocContext(asAdmin(testAccountDID), &forged)
+	assert.True(t, errors.Is(err, ErrPermissionDenied))
+	// other fields are updated as before
+	forged.BasicDoc = cloneBasicDoc(rotated.BasicDoc)
+	_, _, err = r.UpdateWithDocContext(asAdmin(testAccountDID), &forged)
+	assert.Nil(t, err)
+	_, updated, err := r.ResolveFull(testAccountDID)
+	assert.Nil(t, err)
+	assert.Equal(t, "changed", updated.Service)
+	assert.Equal(t, rotated.PublicKey, updated.PublicKey)
+
+	// replayed
+	_, _, err = r.RotateKeys(rot)
+	assert.True(t, errors.Is(err, ErrInvalidFormat))
+
+	// keys other than the committed ones
+	rot = &KeyRotation{DID: testAccountDID, PublicKey: []PubKey{pk1, pk3}, Authentication: next, Timestamp: doc.Created + 2}
+	assert.Nil(t, SignKeyRotation(rot, "KEY#2", key2))
+	_, _, err = r.RotateKeys(rot)
+	assert.True(t, errors.Is(err, ErrPermissionDenied))
+
+	rot = &KeyRotation{DID: testAccountDID, PublicKey: []PubKey{pk3}, Authentication: next, Timestamp: doc.Created + 2}
+	assert.Nil(t, SignKeyRotation(rot, "KEY#2", key2))
+	_, _, err = r.RotateKeys(rot)
+	assert.Nil(t, err)
+	_, rotated, err = r.ResolveFull(testAccountDID)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(rotated.RevokedKeys))
+	assert.Nil(t, rotated.NextKeyCommitment)
+
+	// revoked keys can not be added back
+	rot = &KeyRotation{DID: testAccountDID, PublicKey: []PubKey{pk3, pk1}, Authentication: next, Timestamp: doc.Created + 3}
+	assert.Nil(t, SignKeyRotation(rot, "KEY#3", key3))
+	_, _, err = r.RotateKeys(rot)
+	assert.True(t, errors.Is(err, ErrInvalidFormat))
+
+	rot.DID = rootAccountDID
+	_, _, err = r.RotateKeys(rot)
+	assert.NotNil(t, err)
+}
+
+func TestBasicDocRotate(t *testing.T) {
+	pub1, priv1, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(t, err)
+	pub2, _, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(t, err)
+	pk1 := (&VerificationKey{ID: "KEY#1", Type: crypto.Ed25519, Key: pub1}).PubKey()
+	pk2 := (&VerificationKey{ID: "KEY#1", Type: crypto.Ed25519, Key: pub2}).PubKey()
+	bd := &BasicDoc{
+		ID:             testAccountDID,
+		Created:        100,
+		PublicKey:      []PubKey{pk1},
+		Authentication: []Auth{{PublicKey: []string{"KEY#1"}}},
+	}
+
+	// the same key id with another key
+	rot := &KeyRotation{DID: bd.ID, PublicKey: []PubKey{pk2}, Authentication: bd.Authentication, Timestamp: 200}
+	digest, err := rot.Digest()
+	assert.Nil(t, err)
+	rot.Signatures = []KeySignature{{KeyID: "KEY#1", Signature: ed25519.Sign(priv1, digest)}}
+	rotated, err := bd.Rotate(rot)
+	assert.Nil(t, err)
+	assert.Equal(t, []PubKey{pk2}, rotated.PublicKey)
+	assert.Equal(t, []RevokedKey{{Key: pk1, Revoked: 200}}, rotated.RevokedKeys)
+	assert.Equal(t, []PubKey{pk1}, bd.PublicKey)
+	assert.Nil(t, bd.RevokedKeys)
+
+	// authentication referring to missing keys
+	rot.Authentication = []Auth{{PublicKey: []string{"KEY#2"}}}
+	digest, err = rot.Digest()
+	assert.Nil(t, err)
+	rot.Signatures = []KeySignature{{KeyID: "KEY#1", Signature: ed25519.Sign(priv1, digest)}}
+	_, err = bd.Rotate(rot)
+	assert.True(t, errors.Is(err, ErrNotFound))
+
+	// revoked keys survive encoding
+	data, err := (&ProtoCodec{}).Marshal(&AccountDoc{BasicDoc: *rotated})
+	assert.Nil(t, err)
+	decoded := &AccountDoc{}
+	assert.Nil(t, (&ProtoCodec{}).Unmarshal(data, decoded))
+	assert.Equal(t, rotated.RevokedKeys, decoded.RevokedKeys)
+}
@@ -0,0 +1,394 @@
+package bitxid
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"time"
+
+	"github.com/meshplus/bitxhub-kit/storage"
+)
+
+// SnapshotVersion is the version of snapshot archive format
+const SnapshotVersion = 1
+
+const snapshotManifestName = "manifest.json"
+
+// name of snapshot sections
+const (
+	TableSection = "table"
+	DocdbSection = "docdb"
+	VCSection    = "vc"
+)
+
+var snapshotPrefixes = map[string][]string{
+	TableSection: {tbPrefix, smtPrefix, evtPrefix, auditPrefix, govPrefix, rolePrefix, chgPrefix, repPrefix},
+	DocdbSection: {docPrefix, edocPrefix},
+	VCSection:    {claimPrefix, vcPrefix},
+}
+
+// SnapshotManifest describes a registry snapshot archive,
+// the admin set of the registry is kept in Admins and the fields following it.
+type SnapshotManifest struct {
+	Version           int               `json:"version"`
+	Registry          DIDType           `json:"registry"` // type of the registry
+	SelfID            DID               `json:"selfId"`
+	Mode              RegistryMode      `json:"mode"`
+	Admins            []DID             `json:"admins"`
+	AdminPolicy       AdminPolicy       `json:"adminPolicy"`
+	AdminChanges      []*AdminChange    `json:"adminChanges,omitempty"` // pending admin changes
+	LastAdminChangeID uint64            `json:"lastAdminChangeId,omitempty"`
+	IsRoot            bool              `json:"isRoot,omitempty"`      // the chain did registry is the root of a hierarchy
+	RootSigner        string            `json:"rootSigner,omitempty"`  // address of the key of the root
+	Delegation        *Delegation       `json:"delegation,omitempty"`  // authorizes a subordinate chain did registry
+	Delegations       []*Delegation     `json:"delegations,omitempty"` // delegations issued by the root
+	ClaimTyps         []string          `json:"claimTyps"`             // claim type list of vc registry
+	Created           int64             `json:"created"`
+	Sections          []SnapshotSection `json:"sections"`
+}
+
+// SnapshotSection describes a section of a snapshot archive
+type SnapshotSection struct {
+	Name     string `json:"name"`
+	Entries  int    `json:"entries"`
+	Checksum string `json:"checksum"` // hex of sha256 of section file
+}
+
+// SnapshotTarget represents fresh stores a snapshot is imported into,
+// stores of the same section may be shared.
+type SnapshotTarget struct {
+	Table storage.Storage
+	Docdb storage.Storage
+	VC    storage.Storage
+}
+
+// storeBacked is implemented by tables and docdbs persisted in a storage.Storage
+type storeBacked interface {
+	backingStore() storage.Storage
+}
+
+func backingStore(v interface{}) storage.Storage {
+	if sb, ok := v.(storeBacked); ok {
+		return sb.backingStore()
+	}
+	return nil
+}
+
+// tableDecorator is implemented by tables decorating another table
+type tableDecorator interface {
+	decorated() RegistryTable
+}
+
+// tableStores gets the distinct stores backing table and the tables
+// it decorates, e.g. a change log kept apart from the items.
+func tableStores(table RegistryTable) []storage.Storage {
+	stores := []storage.Storage{}
+	for table != nil {
+		if s := backingStore(table); s != nil && !containsStore(stores, s) {
+			stores = append(stores, s)
+		}
+		d, ok := table.(tableDecorator)
+		if !ok {
+			break
+		}
+		table = d.decorated()
+	}
+	return stores
+}
+
+func containsStore(stores []storage.Storage, s storage.Storage) bool {
+	for _, store := range stores {
+		if store == s {
+			return true
+		}
+	}
+	return false
+}
+
+// ExportChainDIDRegistry exports table items, docs, admins and vc data (if vcr is not nil)
+// of a chain did registry into a snapshot archive.
+func ExportChainDIDRegistry(w io.Writer, r *ChainDIDRegistry, vcr *VCRegistry) (*SnapshotManifest, error) {
+	m := &SnapshotManifest{
+		Registry:    ChainDIDType,
+		SelfID:      r.GetSelfID(),
+		Mode:        r.Mode,
+		IsRoot:      r.IsRoot,
+		RootSigner:  r.RootSigner,
+		Delegation:  r.Delegation,
+		Delegations: r.Delegations,
+	}
+	m.setAdminSet(&r.AdminSet)
+	return exportSnapshot(w, m, r.Table, r.Docdb, vcr)
+}
+
+// ExportAccountDIDRegistry exports table items, docs, admins and vc data (if vcr is not nil)
+// of an account did registry into a snapshot archive.
+func ExportAccountDIDRegistry(w io.Writer, r *AccountDIDRegistry, vcr *VCRegistry) (*SnapshotManifest, error) {
+	m := &SnapshotManifest{
+		Registry: AccountDIDType,
+		SelfID:   r.GetSelfID(),
+		Mode:     r.Mode,
+	}
+	m.setAdminSet(&r.AdminSet)
+	return exportSnapshot(w, m, r.Table, r.Docdb, vcr)
+}
+
+func (m *SnapshotManifest) setAdminSet(s *AdminSet) {
+	m.Admins = s.Admins
+	m.AdminPolicy = s.AdminPolicy
+	m.AdminChanges = s.AdminChanges
+	m.LastAdminChangeID = s.LastChangeID
+}
+
+func (m *SnapshotManifest) adminSet() AdminSet {
+	return AdminSet{
+		Admins:       m.Admins,
+		AdminPolicy:  m.AdminPolicy,
+		AdminChanges: m.AdminChanges,
+		LastChangeID: m.LastAdminChangeID,
+	}
+}
+
+func exportSnapshot(w io.Writer, m *SnapshotManifest, table RegistryTable, docdb DocDB, vcr *VCRegistry) (*SnapshotManifest, error) {
+	m.Version = SnapshotVersion
+	m.Created = time.Now().Unix()
+
+	stores := map[string][]storage.Storage{}
+	ts := tableStores(table)
+	if len(ts) == 0 {
+		return nil, fmt.Errorf("snapshot: table is not backed by a storage")
+	}
+	stores[TableSection] = ts
+	if m.Mode == InternalDocDB {
+		ds := backingStore(docdb)
+		if ds == nil {
+			return nil, fmt.Errorf("snapshot: docdb is not backed by a storage")
+		}
+		stores[DocdbSection] = []storage.Storage{ds}
+	}
+	if vcr != nil {
+		stores[VCSection] = []storage.Storage{vcr.Store}
+		m.ClaimTyps = append([]string{}, vcr.CTlist...)
+	}
+
+	sections := map[string][]byte{}
+	for _, name := range []string{TableSection, DocdbSection, VCSection} {
+		s, ok := stores[name]
+		if !ok {
+			continue
+		}
+		data, entries := dumpSection(s, snapshotPrefixes[name])
+		sum := sha256.Sum256(data)
+		sections[name] = data
+		m.Sections = append(m.Sections, SnapshotSection{
+			Name:     name,
+			Entries:  entries,
+			Checksum: hex.EncodeToString(sum[:]),
+		})
+	}
+
+	mb, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("snapshot manifest marshal: %w", err)
+	}
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+	if err := writeTarFile(tw, snapshotManifestName, mb); err != nil {
+		return nil, err
+	}
+	for _, sec := range m.Sections {
+		if err := writeTarFile(tw, sec.Name, sections[sec.Name]); err != nil {
+			return nil, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, fmt.Errorf("snapshot tar close: %w", err)
+	}
+	if err := gw.Close(); err != nil {
+		return nil, fmt.Errorf("snapshot gzip close: %w", err)
+	}
+	return m, nil
+}
+
+// dumpSection encodes all key-value pairs under prefixes in stores as
+// uvarint(len(key)) | key | uvarint(len(value)) | value
+func dumpSection(stores []storage.Storage, prefixes []string) ([]byte, int) {
+	buf := bytes.Buffer{}
+	entries := 0
+	seen := map[string]bool{}
+	for _, s := range stores {
+		for _, prefix := range prefixes {
+			it := s.Prefix([]byte(prefix))
+			for it.Next() {
+				if seen[string(it.Key())] {
+					continue
+				}
+				seen[string(it.Key())] = true
+				buf.Write(appendUvarint(nil, uint64(len(it.Key()))))
+				buf.Write(it.Key())
+				buf.Write(appendUvarint(nil, uint64(len(it.Value()))))
+				buf.Write(it.Value())
+				entries++
+			}
+		}
+	}
+	return buf.Bytes(), entries
+}
+
+type snapshotEntry struct {
+	key   []byte
+	value []byte
+}
+
+func parseSection(data []byte) ([]snapshotEntry, error) {
+	entries := []snapshotEntry{}
+	for len(data) > 0 {
+		var kv [2][]byte
+		for i := range kv {
+			l, n := binary.Uvarint(data)
+			if n <= 0 || uint64(len(data)-n) < l {
+				return nil, fmt.Errorf("malformed entry %d", len(entries))
+			}
+			kv[i] = data[n : n+int(l)]
+			data = data[n+int(l):]
+		}
+		entries = append(entries, snapshotEntry{key: kv[0], value: kv[1]})
+	}
+	return entries, nil
+}
+
+func hasAnyPrefix(key []byte, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if bytes.HasPrefix(key, []byte(prefix)) {
+			return true
+		}
+	}
+	return false
+}
+
+func writeTarFile(tw *tar.Writer, name string, data []byte) error {
+	err := tw.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    0600,
+		Size:    int64(len(data)),
+		ModTime: time.Now(),
+	})
+	if err != nil {
+		return fmt.Errorf("snapshot write %s header: %w", name, err)
+	}
+	if _, err := tw.Write(data); err != nil {
+		return fmt.Errorf("snapshot write %s: %w", name, err)
+	}
+	return nil
+}
+
+// readSnapshot reads and validates a snapshot archive,
+// it returns the manifest and the verified sections.
+func readSnapshot(rd io.Reader) (*SnapshotManifest, map[string][]snapshotEntry, error) {
+	gr, err := gzip.NewReader(rd)
+	if err != nil {
+		return nil, nil, fmt.Errorf("snapshot gzip: %w", err)
+	}
+	defer gr.Close()
+	tr := tar.NewReader(gr)
+	files := map[string][]byte{}
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("snapshot tar: %w", err)
+		}
+		data, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return nil, nil, fmt.Errorf("snapshot read %s: %w", hdr.Name, err)
+		}
+		files[hdr.Name] = data
+	}
+
+	mb, ok := files[snapshotManifestName]
+	if !ok {
+		return nil, nil, fmt.Errorf("snapshot has no manifest")
+	}
+	m := &SnapshotManifest{}
+	if err := json.Unmarshal(mb, m); err != nil {
+		return nil, nil, fmt.Errorf("snapshot manifest unmarshal: %w", err)
+	}
+	if m.Version != SnapshotVersion {
+		return nil, nil, fmt.Errorf("unsupported snapshot version: %d", m.Version)
+	}
+
+	sections := map[string][]snapshotEntry{}
+	for _, sec := range m.Sections {
+		if _, ok := snapshotPrefixes[sec.Name]; !ok {
+			return nil, nil, fmt.Errorf("snapshot unknown section %s", sec.Name)
+		}
+		data, ok := files[sec.Name]
+		if !ok {
+			return nil, nil, fmt.Errorf("snapshot section %s missing", sec.Name)
+		}
+		sum := sha256.Sum256(data)
+		if hex.EncodeToString(sum[:]) != sec.Checksum {
+			return nil, nil, fmt.Errorf("snapshot section %s checksum mismatch", sec.Name)
+		}
+		entries, err := parseSection(data)
+		if err != nil {
+			return nil, nil, fmt.Errorf("snapshot section %s: %w", sec.Name, err)
+		}
+		if len(entries) != sec.Entries {
+			return nil, nil, fmt.Errorf("snapshot section %s has %d entries, manifest says %d", sec.Name, len(entries), sec.Entries)
+		}
+		for _, e := range entries {
+			if !hasAnyPrefix(e.key, snapshotPrefixes[sec.Name]) {
+				return nil, nil, fmt.Errorf("snapshot section %s has foreign key %q", sec.Name, e.key)
+			}
+		}
+		sections[sec.Name] = entries
+	}
+	return m, sections, nil
+}
+
+// ImportSnapshot validates a snapshot archive and replays it into fresh stores.
+// The admin set, the hierarchy of chain did registries and claim types are
+// returned in the manifest for the caller to set up the new registries, e.g.
+// by WithChainSnapshot or WithAccountSnapshot.
+func ImportSnapshot(rd io.Reader, target SnapshotTarget) (*SnapshotManifest, error) {
+	m, sections, err := readSnapshot(rd)
+	if err != nil {
+		return nil, err
+	}
+
+	stores := map[string]storage.Storage{
+		TableSection: target.Table,
+		DocdbSection: target.Docdb,
+		VCSection:    target.VC,
+	}
+	// check all targets before writing anything
+	for name := range sections {
+		s := stores[name]
+		if s == nil {
+			return nil, fmt.Errorf("snapshot import: no target store for section %s", name)
+		}
+		for _, prefix := range snapshotPrefixes[name] {
+			if s.Prefix([]byte(prefix)).Next() {
+				return nil, fmt.Errorf("snapshot import: target store of section %s is not empty", name)
+			}
+		}
+	}
+	for name, entries := range sections {
+		batch := stores[name].NewBatch()
+		for _, e := range entries {
+			batch.Put(e.key, e.value)
+		}
+		batch.Commit()
+	}
+	return m, nil
+}
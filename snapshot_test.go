@@ -0,0 +1,163 @@
+package bitxid
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/meshplus/bitxhub-kit/storage"
+	"github.com/meshplus/bitxhub-kit/storage/leveldb"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestStorage(t *testing.T, name string) (storage.Storage, string) {
+	dir, err := ioutil.TempDir("", name)
+	assert.Nil(t, err)
+	s, err := leveldb.New(dir)
+	assert.Nil(t, err)
+	return s, dir
+}
+
+func TestSnapshotExportImport(t *testing.T) {
+	mr, tablePath, docdbPath := newChainDIDModeInternal(t)
+	defer os.RemoveAll(tablePath)
+	defer os.RemoveAll(docdbPath)
+	testChainDIDSetupGenesSucceed(t, mr)
+	testChainDIDAddAdminsSucceed(t, mr)
+	testChainDIDApplySucceed(t, mr)
+	testChainDIDAuditApplySucceed(t, mr)
+	testChainDIDRegisterSucceedInternal(t, mr)
+	WithChainAdminPolicy(AdminPolicy{MinAdmins: 1, Timelock: time.Minute})(mr)
+	assert.Nil(t, mr.AddAdminContext(asAdmin(superAdmin), admin2))
+
+	vs, vcPath := newTestStorage(t, "vc.store")
+	defer os.RemoveAll(vcPath)
+	vcr, err := NewVCRegistry(vs)
+	assert.Nil(t, err)
+	testCreateClaimTyp(t, vcr)
+	testStoreVC(t, vcr)
+
+	buf := bytes.Buffer{}
+	m, err := ExportChainDIDRegistry(&buf, mr, vcr)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(m.Sections))
+	assert.Equal(t, 2, m.Sections[0].Entries) // genesis and appchain
+	archive := buf.Bytes()
+
+	ts, tsPath := newTestStorage(t, "chainDID.table")
+	defer os.RemoveAll(tsPath)
+	ds, dsPath := newTestStorage(t, "chainDID.docdb")
+	defer os.RemoveAll(dsPath)
+	vs2, vs2Path := newTestStorage(t, "vc.store")
+	defer os.RemoveAll(vs2Path)
+
+	m2, err := ImportSnapshot(bytes.NewReader(archive), SnapshotTarget{Table: ts, Docdb: ds, VC: vs2})
+	assert.Nil(t, err)
+	assert.Equal(t, []DID{superAdmin, admin}, m2.Admins)
+	assert.Equal(t, rootChainDID, m2.SelfID)
+
+	// the admin set is restored with its policy and pending changes
+	mr2, err := NewChainDIDRegistry(ts, loggerGet(loggerChainDID), WithChainDocStorage(ds), WithChainSnapshot(m2))
+	assert.Nil(t, err)
+	assert.Equal(t, mr.AdminSet, mr2.AdminSet)
+	assert.Equal(t, 1, len(mr2.PendingAdminChanges()))
+	item, doc, _, err := mr2.Resolve(chainDID)
+	assert.Nil(t, err)
+	assert.Equal(t, &mdocA, doc)
+	assert.Equal(t, mcaller, item.Owner)
+
+	vcr2, err := NewVCRegistry(vs2)
+	assert.Nil(t, err)
+	vcr2.CTlist = m2.ClaimTyps
+	testGetClaimTyp(t, vcr2)
+	testGetVC(t, vcr2)
+
+	// target stores must be fresh
+	_, err = ImportSnapshot(bytes.NewReader(archive), SnapshotTarget{Table: ts, Docdb: ds, VC: vs2})
+	assert.NotNil(t, err)
+
+	// tampered section is detected
+	tampered := repackSnapshot(t, archive, func(name string, data []byte) []byte {
+		if name == TableSection {
+			data[len(data)-1] ^= 0xff
+		}
+		return data
+	})
+	ts3, ts3Path := newTestStorage(t, "chainDID.table")
+	defer os.RemoveAll(ts3Path)
+	_, err = ImportSnapshot(bytes.NewReader(tampered), SnapshotTarget{Table: ts3, Docdb: ts3, VC: ts3})
+	assert.NotNil(t, err)
+	assert.False(t, ts3.Prefix([]byte(tbPrefix)).Next())
+}
+
+func repackSnapshot(t *testing.T, archive []byte, fn func(name string, data []byte) []byte) []byte {
+	gr, err := gzip.NewReader(bytes.NewReader(archive))
+	assert.Nil(t, err)
+	tr := tar.NewReader(gr)
+	buf := bytes.Buffer{}
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		assert.Nil(t, err)
+		data, err := ioutil.ReadAll(tr)
+		assert.Nil(t, err)
+		err = writeTarFile(tw, hdr.Name, fn(hdr.Name, data))
+		assert.Nil(t, err)
+	}
+	assert.Nil(t, tw.Close())
+	assert.Nil(t, gw.Close())
+	return buf.Bytes()
+}
+
+func TestSnapshotHierarchy(t *testing.T) {
+	root, tablePath, docdbPath := newChainDIDModeInternal(t)
+	defer os.RemoveAll(tablePath)
+	defer os.RemoveAll(docdbPath)
+	key, signer := newRootKey(t)
+	_, subSigner := newRootKey(t)
+	WithRootRegistry(signer)(root)
+	testChainDIDSetupGenesSucceed(t, root)
+	d, err := root.Delegate(subChainDID, subSigner, "fabric", key, 0)
+	assert.Nil(t, err)
+
+	buf := bytes.Buffer{}
+	_, err = ExportChainDIDRegistry(&buf, root, nil)
+	assert.Nil(t, err)
+	ts, tsPath := newTestStorage(t, "chainDID.table")
+	defer os.RemoveAll(tsPath)
+	m, err := ImportSnapshot(&buf, SnapshotTarget{Table: ts, Docdb: ts})
+	assert.Nil(t, err)
+	root2, err := NewChainDIDRegistry(ts, loggerGet(loggerChainDID), WithChainDocStorage(ts), WithChainSnapshot(m))
+	assert.Nil(t, err)
+	assert.True(t, root2.IsRoot)
+	assert.Equal(t, signer, root2.RootSigner)
+	assert.Equal(t, root.Delegations, root2.Delegations)
+	// the restored root keeps refusing delegated chain dids
+	assert.True(t, errors.Is(root2.Apply(mcaller, subMemberDID), ErrPermissionDenied))
+
+	sub, subPath := newSubChainDID(t, d, signer)
+	defer os.RemoveAll(subPath)
+	assert.Nil(t, sub.SetupGenesis())
+	buf.Reset()
+	_, err = ExportChainDIDRegistry(&buf, sub, nil)
+	assert.Nil(t, err)
+	ss, ssPath := newTestStorage(t, "subChainDID.table")
+	defer os.RemoveAll(ssPath)
+	m, err = ImportSnapshot(&buf, SnapshotTarget{Table: ss, Docdb: ss})
+	assert.Nil(t, err)
+	sub2, err := NewChainDIDRegistry(ss, loggerGet(loggerChainDID), WithChainDocStorage(ss), WithChainSnapshot(m))
+	assert.Nil(t, err)
+	assert.False(t, sub2.IsRoot)
+	assert.Equal(t, d, sub2.Delegation)
+	assert.True(t, errors.Is(sub2.Apply(mcaller, outsideDID), ErrPermissionDenied))
+}
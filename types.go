@@ -74,34 +74,74 @@ type DocInfo struct {
 
 // BasicDoc is the fundamental part of doc structure
 type BasicDoc struct {
-	ID             DID      `json:"id"`
-	Type           int      `json:"type"`
-	Created        uint64   `json:"created"`
-	Updated        uint64   `json:"updated"`
-	Controller     DID      `json:"controller"`
-	PublicKey      []PubKey `json:"publicKey"`
-	Authentication []Auth   `json:"authentication"`
+	ID             DID      `json:"id" pb:"1"`
+	Type           int      `json:"type" pb:"2"`
+	Created        uint64   `json:"created" pb:"3"`
+	Updated        uint64   `json:"updated" pb:"4"`
+	Controller     DID      `json:"controller" pb:"5"`
+	PublicKey      []PubKey `json:"publicKey" pb:"6"`
+	Authentication []Auth   `json:"authentication" pb:"7"`
+	// KeyCommitment of the keys of the next rotation, which should reveal them if set
+	NextKeyCommitment []byte       `json:"nextKeyCommitment,omitempty" pb:"8"`
+	RevokedKeys       []RevokedKey `json:"revokedKeys,omitempty" pb:"9"` // keys replaced by rotations
 }
 
 // BasicItem is the fundamental part of item structure
 type BasicItem struct {
-	ID      DID
-	DocAddr string     // addr where the doc file stored
-	DocHash []byte     // hash of the doc file
-	Status  StatusType // status of the item
+	ID        DID        `json:"id" pb:"1"`
+	DocAddr   string     `json:"docAddr" pb:"2"`             // addr where the doc file stored
+	DocHash   []byte     `json:"docHash" pb:"3"`             // hash of the doc file
+	Status    StatusType `json:"status" pb:"4"`              // status of the item
+	Decisions []Decision `json:"decisions,omitempty" pb:"5"` // latest admin decisions on the item, oldest first
+}
+
+// ReasonCode .
+type ReasonCode string
+
+// common reason codes, other codes are allowed
+const (
+	ReasonUnspecified       ReasonCode = ""
+	ReasonInvalidDoc        ReasonCode = "InvalidDoc"
+	ReasonIncompleteInfo    ReasonCode = "IncompleteInfo"
+	ReasonKeyCompromised    ReasonCode = "KeyCompromised"
+	ReasonPolicyViolation   ReasonCode = "PolicyViolation"
+	ReasonFraud             ReasonCode = "Fraud"
+	ReasonRequestedByHolder ReasonCode = "RequestedByHolder"
+)
+
+// Reason explains an admin decision
+type Reason struct {
+	Code     ReasonCode `json:"code" pb:"1"`
+	Comment  string     `json:"comment,omitempty" pb:"2"`
+	Evidence []string   `json:"evidence,omitempty" pb:"3"` // references to evidence, e.g. urls or cids
+}
+
+// Decision represents an admin decision on an item
+type Decision struct {
+	Action    AuditAction `json:"action" pb:"1"`
+	Status    StatusType  `json:"status" pb:"2"` // status after the decision
+	Reason    Reason      `json:"reason" pb:"3"`
+	Caller    DID         `json:"caller,omitempty" pb:"4"`
+	Timestamp int64       `json:"timestamp" pb:"5"` // unix nano of ContextWithTimestamp, 0 if not set
 }
 
 // PubKey represents publick key
 type PubKey struct {
-	ID           string `json:"id"`
-	Type         string `json:"type"`
-	PublicKeyPem string `json:"publicKeyPem"`
+	ID           string `json:"id" pb:"1"`
+	Type         string `json:"type" pb:"2"`
+	PublicKeyPem string `json:"publicKeyPem" pb:"3"`
+}
+
+// RevokedKey represents a public key revoked by a key rotation
+type RevokedKey struct {
+	Key     PubKey `json:"key" pb:"1"`
+	Revoked uint64 `json:"revoked" pb:"2"` // timestamp of the rotation
 }
 
 // Auth represents authentication information
 type Auth struct {
-	PublicKey []string `json:"publicKey"` // ID of PublicKey
-	Strategy  string   `json:"strategy"`  // strategy of publicKey combination
+	PublicKey []string `json:"publicKey" pb:"1"` // ID of PublicKey
+	Strategy  string   `json:"strategy" pb:"2"`  // strategy of publicKey combination
 }
 
 // IsValidFormat checks whether did is valid format
@@ -113,6 +153,38 @@ func (did DID) IsValidFormat() bool {
 	return true
 }
 
+// IsValid checks whether did follows the generic did syntax
+// did:method:method-specific-id, where the id may contain colons.
+// dids of this registry should be checked by IsValidFormat.
+func (did DID) IsValid() bool {
+	s := strings.SplitN(string(did), ":", 3)
+	if len(s) != 3 || s[0] != "did" || s[1] == "" || s[2] == "" {
+		return false
+	}
+	for _, c := range s[1] {
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9') {
+			return false
+		}
+	}
+	return !strings.HasSuffix(s[2], ":") && !strings.ContainsAny(s[2], "/?# ")
+}
+
+// GetMethod gets method from did of the generic syntax
+func (did DID) GetMethod() string {
+	if !did.IsValid() {
+		return ""
+	}
+	return strings.SplitN(string(did), ":", 3)[1]
+}
+
+// GetMethodSpecificID gets method specific id from did of the generic syntax
+func (did DID) GetMethodSpecificID() string {
+	if !did.IsValid() {
+		return ""
+	}
+	return strings.SplitN(string(did), ":", 3)[2]
+}
+
 // GetRootMethod get root method from did-format string
 func (did DID) GetRootMethod() string {
 	if !did.IsValidFormat() {
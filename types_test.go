@@ -46,3 +46,21 @@ func TestIsValidFormat(t *testing.T) {
 	res = method.IsValidFormat()
 	assert.Equal(t, false, res)
 }
+
+func TestIsValid(t *testing.T) {
+	for _, did := range []DID{
+		testDid,
+		"did:key:z6MkhaXgBZDvotDkL5257faiztiGiC2QtKLGpbnnEGta2doK",
+		"did:web:example.com:user:alice",
+		"did:web:localhost%3A8443",
+	} {
+		assert.True(t, did.IsValid(), did)
+	}
+	for _, did := range []DID{"did:key", "did::x", "did:Key:x", "did:web:", "did:web:a:", "did:web:a/b", "uri:web:a"} {
+		assert.False(t, did.IsValid(), did)
+	}
+	did := DID("did:web:example.com:user:alice")
+	assert.Equal(t, "web", did.GetMethod())
+	assert.Equal(t, "example.com:user:alice", did.GetMethodSpecificID())
+	assert.Equal(t, "", did.GetRootMethod())
+}
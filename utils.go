@@ -2,7 +2,9 @@ package bitxid
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"encoding/gob"
+	"encoding/json"
 	"fmt"
 )
 
@@ -63,3 +65,28 @@ func MarshalChainDoc(docStruct ChainDoc) ([]byte, error) {
 	}
 	return docBytes, nil
 }
+
+// HashDoc computes hash of a doc encoded by codec c,
+// under ExternalDocDB mode callers should use it to get the doc hash to register.
+func HashDoc(c Codec, doc Doc) ([]byte, error) {
+	if c == nil {
+		c = DefaultCodec()
+	}
+	docBytes, err := c.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	docHash := sha256.Sum256(docBytes)
+	return docHash[:], nil
+}
+
+// digestOf computes sha256 of the json encoding of v,
+// callers clear the signatures of v before.
+func digestOf(v interface{}) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	hash := sha256.Sum256(data)
+	return hash[:], nil
+}
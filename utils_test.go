@@ -48,15 +48,14 @@ func TestMarshal(t *testing.T) {
 		A: "aaa",
 		B: 1,
 	}
-	expectedByte := []byte{27, 255, 161, 3, 1, 1, 1, 115,
-		1, 255, 162, 0, 1, 2, 1, 1,
-		65, 1, 12, 0, 1, 1, 66, 1,
-		4, 0, 0, 0, 10, 255, 162, 1,
-		3, 97, 97, 97, 1, 2, 0}
 
 	testBytes1, err := Marshal(testStruct)
 	assert.Nil(t, err)
-	assert.Equal(t, expectedByte, testBytes1)
+	// gob type ids depend on the types encoded by former tests,
+	// so the encoding is checked by decoding it
+	var decoded s
+	assert.Nil(t, Unmarshal(testBytes1, &decoded))
+	assert.Equal(t, testStruct, decoded)
 	testBytes = testBytes1
 }
 
@@ -0,0 +1,354 @@
+package bitxid
+
+import (
+	stdecdsa "crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/meshplus/bitxhub-kit/crypto"
+	"github.com/meshplus/bitxhub-kit/crypto/asym/ecdsa"
+)
+
+// types of PubKey, other spellings such as Ed25519VerificationKey2018
+// or EcdsaSecp256r1VerificationKey2019 are accepted by ParsePubKey
+const (
+	PubKeyEd25519   = "Ed25519"
+	PubKeySecp256k1 = "Secp256k1"
+	PubKeyP256      = "P256"
+)
+
+// VerificationKey is a parsed public key of a doc
+type VerificationKey struct {
+	ID   string
+	Type crypto.KeyType // Ed25519, Secp256k1 or ECDSA_P256
+	Key  []byte         // raw Ed25519 key, or compressed point of ecdsa keys
+}
+
+// ParsePubKey parses pk of a doc. Ed25519 keys are base58 encoded,
+// ecdsa keys are hex encoded points or PEM encoded keys or certificates.
+func ParsePubKey(pk PubKey) (*VerificationKey, error) {
+	var typ crypto.KeyType
+	switch t := strings.ToLower(pk.Type); {
+	case strings.HasPrefix(t, "ed25519"):
+		typ = crypto.Ed25519
+	case strings.Contains(t, "secp256k1"):
+		typ = crypto.Secp256k1
+	case strings.Contains(t, "p256"), strings.Contains(t, "p-256"), strings.Contains(t, "secp256r1"):
+		typ = crypto.ECDSA_P256
+	default:
+		return nil, &InvalidFormatError{What: "public key", Reason: fmt.Sprintf("%s: unsupported type %s", pk.ID, pk.Type)}
+	}
+	raw, err := decodePubKey(typ, strings.TrimSpace(pk.PublicKeyPem))
+	if err != nil {
+		return nil, &InvalidFormatError{What: "public key", Reason: pk.ID, Err: err}
+	}
+	key, err := normalizeKey(typ, raw)
+	if err != nil {
+		return nil, &InvalidFormatError{What: "public key", Reason: pk.ID, Err: err}
+	}
+	return &VerificationKey{ID: pk.ID, Type: typ, Key: key}, nil
+}
+
+// PubKey encodes k as a PubKey of docs
+func (k *VerificationKey) PubKey() PubKey {
+	pk := PubKey{ID: k.ID, PublicKeyPem: hex.EncodeToString(k.Key)}
+	switch k.Type {
+	case crypto.Ed25519:
+		pk.Type = PubKeyEd25519
+		pk.PublicKeyPem = base58Encode(k.Key)
+	case crypto.Secp256k1:
+		pk.Type = PubKeySecp256k1
+	case crypto.ECDSA_P256:
+		pk.Type = PubKeyP256
+	}
+	return pk
+}
+
+// Verify verifies sig of digest. Ed25519 signs digest as the message,
+// secp256k1 signatures are [R || S] or [R || S || V], and P-256 ones are
+// ASN.1 encoded, with or without the public key as bitxhub-kit does.
+func (k *VerificationKey) Verify(digest, sig []byte) bool {
+	switch k.Type {
+	case crypto.Ed25519:
+		return len(k.Key) == ed25519.PublicKeySize && ed25519.Verify(k.Key, digest, sig)
+	case crypto.Secp256k1:
+		if len(digest) != 32 || (len(sig) != 64 && len(sig) != 65) {
+			return false
+		}
+		return ecdsa.VerifySignature(k.Key, digest, sig[:64])
+	case crypto.ECDSA_P256:
+		pub, err := decompressPoint(elliptic.P256(), k.Key)
+		if err != nil {
+			return false
+		}
+		r, s, ok := parseECDSASig(sig)
+		return ok && stdecdsa.Verify(pub, digest, r, s)
+	}
+	return false
+}
+
+// KeySignature is a signature made by a key of a doc
+type KeySignature struct {
+	KeyID     string
+	Signature []byte
+}
+
+// VerificationKey gets the parsed public key with id of the doc
+func (bd *BasicDoc) VerificationKey(id string) (*VerificationKey, error) {
+	for _, pk := range bd.PublicKey {
+		if pk.ID == id {
+			return ParsePubKey(pk)
+		}
+	}
+	return nil, &NotFoundError{ID: id, Store: fmt.Sprintf("public keys of %s", bd.ID)}
+}
+
+// VerifyAuthentication verifies that sigs of digest satisfy one of the
+// Authentication entries of the doc. An entry with strategy "m-of-n"
+// needs valid signatures of m of its n keys, and one without strategy
+// needs all of them.
+func (bd *BasicDoc) VerifyAuthentication(digest []byte, sigs []KeySignature) error {
+	if len(bd.Authentication) == 0 {
+		return &InvalidFormatError{What: "doc", Reason: fmt.Sprintf("%s has no authentication", bd.ID)}
+	}
+	var lastErr error
+	for _, auth := range bd.Authentication {
+		need, err := authThreshold(auth)
+		if err != nil {
+			return err
+		}
+		valid := 0
+		for _, id := range auth.PublicKey {
+			key, err := bd.VerificationKey(id)
+			if err != nil {
+				return err
+			}
+			for _, sig := range sigs {
+				if sig.KeyID == id && key.Verify(digest, sig.Signature) {
+					valid++
+					break
+				}
+			}
+		}
+		if valid >= need {
+			return nil
+		}
+		lastErr = &PermissionDeniedError{Caller: bd.ID, Op: fmt.Sprintf("authenticate with %d of %d required signatures", valid, need)}
+	}
+	return lastErr
+}
+
+// authThreshold gets the number of signatures required by auth,
+// key ids of auth should be distinct since each is counted once
+func authThreshold(auth Auth) (int, error) {
+	seen := make(map[string]bool, len(auth.PublicKey))
+	for _, id := range auth.PublicKey {
+		if seen[id] {
+			return 0, &InvalidFormatError{What: "authentication", Reason: fmt.Sprintf("duplicate key %s", id)}
+		}
+		seen[id] = true
+	}
+	if auth.Strategy == "" {
+		return len(auth.PublicKey), nil
+	}
+	parts := strings.Split(auth.Strategy, "-of-")
+	if len(parts) == 2 {
+		m, err1 := strconv.Atoi(parts[0])
+		n, err2 := strconv.Atoi(parts[1])
+		if err1 == nil && err2 == nil && m > 0 && m <= n && n == len(auth.PublicKey) {
+			return m, nil
+		}
+	}
+	return 0, &InvalidFormatError{What: "authentication strategy", Reason: fmt.Sprintf("%s of %d keys", auth.Strategy, len(auth.PublicKey))}
+}
+
+func decodePubKey(typ crypto.KeyType, s string) ([]byte, error) {
+	if strings.HasPrefix(s, "-----BEGIN") {
+		return decodePEMKey(s)
+	}
+	if typ == crypto.Ed25519 {
+		return base58Decode(s)
+	}
+	return hex.DecodeString(strings.TrimPrefix(s, "0x"))
+}
+
+// decodePEMKey decodes a PEM encoded ecdsa key or certificate to a point
+func decodePEMKey(s string) ([]byte, error) {
+	block, _ := pem.Decode([]byte(s))
+	if block == nil {
+		return nil, fmt.Errorf("bad pem")
+	}
+	var pub interface{}
+	if block.Type == "CERTIFICATE" {
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		pub = cert.PublicKey
+	} else {
+		var err error
+		if pub, err = x509.ParsePKIXPublicKey(block.Bytes); err != nil {
+			return nil, err
+		}
+	}
+	k, ok := pub.(*stdecdsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("not an ecdsa key")
+	}
+	return elliptic.Marshal(k.Curve, k.X, k.Y), nil
+}
+
+// normalizeKey checks raw key of typ and compresses ecdsa points
+func normalizeKey(typ crypto.KeyType, raw []byte) ([]byte, error) {
+	switch typ {
+	case crypto.Ed25519:
+		if len(raw) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("ed25519 key of %d bytes", len(raw))
+		}
+		return raw, nil
+	case crypto.Secp256k1:
+		var pub *stdecdsa.PublicKey
+		var err error
+		if len(raw) == 33 {
+			pub, err = ecdsa.DecompressPubkey(raw)
+		} else {
+			pub, err = ecdsa.UnmarshalPubkey(raw)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return ecdsa.CompressPubkey(pub), nil
+	case crypto.ECDSA_P256:
+		pub, err := decompressPoint(elliptic.P256(), raw)
+		if err != nil {
+			return nil, err
+		}
+		return compressPoint(pub.X, pub.Y), nil
+	}
+	return nil, fmt.Errorf("unsupported key type %d", typ)
+}
+
+func compressPoint(x, y *big.Int) []byte {
+	out := make([]byte, 33)
+	out[0] = byte(2 + y.Bit(0))
+	xb := x.Bytes()
+	copy(out[33-len(xb):], xb)
+	return out
+}
+
+// decompressPoint parses a compressed or uncompressed point of a curve with a = -3
+func decompressPoint(curve elliptic.Curve, data []byte) (*stdecdsa.PublicKey, error) {
+	if len(data) == 65 && data[0] == 4 {
+		x, y := elliptic.Unmarshal(curve, data)
+		if x == nil {
+			return nil, fmt.Errorf("point not on curve")
+		}
+		return &stdecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	if len(data) != 33 || (data[0] != 2 && data[0] != 3) {
+		return nil, fmt.Errorf("bad point of %d bytes", len(data))
+	}
+	params := curve.Params()
+	x := new(big.Int).SetBytes(data[1:])
+	// y^2 = x^3 - 3x + b
+	y2 := new(big.Int).Exp(x, big.NewInt(3), params.P)
+	y2.Sub(y2, new(big.Int).Mul(x, big.NewInt(3)))
+	y2.Add(y2, params.B)
+	y2.Mod(y2, params.P)
+	y := new(big.Int).ModSqrt(y2, params.P)
+	if y == nil {
+		return nil, fmt.Errorf("point not on curve")
+	}
+	if y.Bit(0) != uint(data[0]&1) {
+		y.Sub(params.P, y)
+	}
+	if !curve.IsOnCurve(x, y) {
+		return nil, fmt.Errorf("point not on curve")
+	}
+	return &stdecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+}
+
+// parseECDSASig parses ASN.1 signatures, with the public key as
+// bitxhub-kit does or without it, and raw [R || S] signatures
+func parseECDSASig(sig []byte) (*big.Int, *big.Int, bool) {
+	kitSig := &ecdsa.Sig{}
+	if rest, err := asn1.Unmarshal(sig, kitSig); err == nil && len(rest) == 0 {
+		return kitSig.R, kitSig.S, true
+	}
+	var rs struct{ R, S *big.Int }
+	if rest, err := asn1.Unmarshal(sig, &rs); err == nil && len(rest) == 0 {
+		return rs.R, rs.S, true
+	}
+	if len(sig) == 64 {
+		return new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:]), true
+	}
+	return nil, nil, false
+}
+
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+func base58Encode(data []byte) string {
+	zeros := 0
+	for zeros < len(data) && data[zeros] == 0 {
+		zeros++
+	}
+	// big endian base58 digits
+	digits := make([]byte, 0, len(data)*138/100+1)
+	for _, b := range data[zeros:] {
+		carry := int(b)
+		for i := range digits {
+			carry += int(digits[i]) << 8
+			digits[i] = byte(carry % 58)
+			carry /= 58
+		}
+		for carry > 0 {
+			digits = append(digits, byte(carry%58))
+			carry /= 58
+		}
+	}
+	out := make([]byte, zeros+len(digits))
+	for i := 0; i < zeros; i++ {
+		out[i] = base58Alphabet[0]
+	}
+	for i, d := range digits {
+		out[len(out)-1-i] = base58Alphabet[d]
+	}
+	return string(out)
+}
+
+func base58Decode(s string) ([]byte, error) {
+	zeros := 0
+	for zeros < len(s) && s[zeros] == base58Alphabet[0] {
+		zeros++
+	}
+	// little endian bytes
+	bytes := make([]byte, 0, len(s)*733/1000+1)
+	for i := zeros; i < len(s); i++ {
+		carry := strings.IndexByte(base58Alphabet, s[i])
+		if carry < 0 {
+			return nil, fmt.Errorf("bad base58 character %q", s[i])
+		}
+		for j := range bytes {
+			carry += int(bytes[j]) * 58
+			bytes[j] = byte(carry)
+			carry >>= 8
+		}
+		for carry > 0 {
+			bytes = append(bytes, byte(carry))
+			carry >>= 8
+		}
+	}
+	out := make([]byte, zeros+len(bytes))
+	for i, b := range bytes {
+		out[len(out)-1-i] = b
+	}
+	return out, nil
+}
@@ -0,0 +1,119 @@
+package bitxid
+
+import (
+	stdecdsa "crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"testing"
+
+	"github.com/meshplus/bitxhub-kit/crypto"
+	"github.com/meshplus/bitxhub-kit/crypto/asym"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBase58(t *testing.T) {
+	assert.Equal(t, "StV1DL6CwTryKyV", base58Encode([]byte("hello world")))
+	data, err := base58Decode("StV1DL6CwTryKyV")
+	assert.Nil(t, err)
+	assert.Equal(t, "hello world", string(data))
+	data, err = base58Decode(base58Encode([]byte{0, 0, 1, 2}))
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{0, 0, 1, 2}, data)
+	_, err = base58Decode("0OIl")
+	assert.NotNil(t, err)
+}
+
+func TestParsePubKey(t *testing.T) {
+	doc := getAccountDoc(1)
+	key, err := ParsePubKey(doc.PublicKey[0])
+	assert.Nil(t, err)
+	assert.EqualValues(t, crypto.Ed25519, key.Type)
+	doc = getAccountDoc(2)
+	key, err = ParsePubKey(doc.PublicKey[0])
+	assert.Nil(t, err)
+	assert.EqualValues(t, crypto.Secp256k1, key.Type)
+	assert.Equal(t, doc.PublicKey[0].PublicKeyPem, key.PubKey().PublicKeyPem)
+
+	// PEM encoded keys are compressed
+	priv, err := stdecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	der, err := x509.MarshalPKIXPublicKey(&priv.PublicKey)
+	assert.Nil(t, err)
+	pemKey := string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+	key, err = ParsePubKey(PubKey{ID: "KEY#1", Type: "EcdsaSecp256r1VerificationKey2019", PublicKeyPem: pemKey})
+	assert.Nil(t, err)
+	assert.EqualValues(t, crypto.ECDSA_P256, key.Type)
+	assert.Equal(t, compressPoint(priv.X, priv.Y), key.Key)
+	again, err := ParsePubKey(key.PubKey())
+	assert.Nil(t, err)
+	assert.Equal(t, key, again)
+
+	for _, pk := range []PubKey{
+		{ID: "KEY#1", Type: "RSA", PublicKeyPem: "00"},
+		{ID: "KEY#1", Type: PubKeyEd25519, PublicKeyPem: "abc"},
+		{ID: "KEY#1", Type: PubKeyP256, PublicKeyPem: "02ffff"},
+		{ID: "KEY#1", Type: PubKeyP256, PublicKeyPem: "-----BEGIN PUBLIC KEY-----"},
+	} {
+		_, err = ParsePubKey(pk)
+		assert.True(t, errors.Is(err, ErrInvalidFormat), pk.PublicKeyPem)
+	}
+}
+
+func TestVerifyAuthentication(t *testing.T) {
+	digest := sha256.Sum256([]byte("interchain tx"))
+	edPub, edPriv, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(t, err)
+	k1, err := asym.GenerateKeyPair(crypto.Secp256k1)
+	assert.Nil(t, err)
+	k2, err := asym.GenerateKeyPair(crypto.ECDSA_P256)
+	assert.Nil(t, err)
+
+	doc := &BasicDoc{ID: testAccountDID}
+	ed := &VerificationKey{ID: "KEY#1", Type: crypto.Ed25519, Key: edPub}
+	doc.PublicKey = append(doc.PublicKey, ed.PubKey())
+	for i, k := range []crypto.PrivateKey{k1, k2} {
+		pub, err := k.PublicKey().Bytes()
+		assert.Nil(t, err)
+		if k.Type() == crypto.ECDSA_P256 {
+			ek, err := ParsePubKey(PubKey{Type: PubKeyP256, PublicKeyPem: string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pub}))})
+			assert.Nil(t, err)
+			pub = ek.Key
+		}
+		vk := &VerificationKey{ID: []string{"KEY#2", "KEY#3"}[i], Type: k.Type(), Key: pub}
+		doc.PublicKey = append(doc.PublicKey, vk.PubKey())
+	}
+	doc.Authentication = []Auth{{PublicKey: []string{"KEY#1", "KEY#2", "KEY#3"}, Strategy: "2-of-3"}}
+
+	sig1 := ed25519.Sign(edPriv, digest[:])
+	sig2, err := k1.Sign(digest[:])
+	assert.Nil(t, err)
+	sig3, err := k2.Sign(digest[:])
+	assert.Nil(t, err)
+
+	err = doc.VerifyAuthentication(digest[:], []KeySignature{{"KEY#1", sig1}})
+	assert.True(t, errors.Is(err, ErrPermissionDenied))
+	// signatures are counted once per key, and only if valid
+	err = doc.VerifyAuthentication(digest[:], []KeySignature{{"KEY#1", sig1}, {"KEY#1", sig1}, {"KEY#2", sig3}})
+	assert.True(t, errors.Is(err, ErrPermissionDenied))
+	assert.Nil(t, doc.VerifyAuthentication(digest[:], []KeySignature{{"KEY#1", sig1}, {"KEY#2", sig2}}))
+	assert.Nil(t, doc.VerifyAuthentication(digest[:], []KeySignature{{"KEY#3", sig3}, {"KEY#2", sig2}}))
+
+	// keys without strategy are all required
+	doc.Authentication = []Auth{{PublicKey: []string{"KEY#1", "KEY#3"}}}
+	assert.True(t, errors.Is(doc.VerifyAuthentication(digest[:], []KeySignature{{"KEY#3", sig3}}), ErrPermissionDenied))
+	assert.Nil(t, doc.VerifyAuthentication(digest[:], []KeySignature{{"KEY#3", sig3}, {"KEY#1", sig1}}))
+
+	doc.Authentication = []Auth{{PublicKey: []string{"KEY#1"}, Strategy: "2-of-1"}}
+	assert.True(t, errors.Is(doc.VerifyAuthentication(digest[:], nil), ErrInvalidFormat))
+	doc.Authentication = []Auth{{PublicKey: []string{"KEY#4"}, Strategy: "1-of-1"}}
+	assert.True(t, errors.Is(doc.VerifyAuthentication(digest[:], nil), ErrNotFound))
+	// a key listed twice is not two signers
+	doc.Authentication = []Auth{{PublicKey: []string{"KEY#1", "KEY#1"}, Strategy: "2-of-2"}}
+	assert.True(t, errors.Is(doc.VerifyAuthentication(digest[:], []KeySignature{{"KEY#1", sig1}}), ErrInvalidFormat))
+	assert.True(t, errors.Is(doc.checkKeys(), ErrInvalidFormat))
+}